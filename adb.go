@@ -2,6 +2,7 @@ package adb
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"strconv"
 	"strings"
@@ -13,8 +14,14 @@ import (
 const (
 	CommandTimeoutShortDefault = time.Second * 2
 	CommandTimeoutLongDefault  = time.Second * 30
+
+	// KillServerTimeout is how long KillServer waits for the server to release its port.
+	KillServerTimeout = time.Second * 5
 )
 
+// ErrServerVersionMismatch is returned when the running server and the adb executable are different versions.
+var ErrServerVersionMismatch = errors.New("ServerVersionMismatch")
+
 // Adb communicates with host services on the adb server.
 // Eg.
 //
@@ -25,11 +32,19 @@ const (
 // TODO(z): Finish implementing host services.
 type Adb struct {
 	server server
+
+	// shared by the sync transfers of all its devices, see SetRateLimit
+	rateLimiter wire.RateLimiter
 }
 
-// New creates a new Adb client that uses the default ServerConfig.
+// New creates a new Adb client that uses the ServerConfig from the standard adb environment
+// variables, see ServerConfigFromEnv.
 func New() (*Adb, error) {
-	return NewWithConfig(ServerConfig{})
+	config, err := ServerConfigFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	return NewWithConfig(config)
 }
 
 func NewWithConfig(config ServerConfig) (*Adb, error) {
@@ -37,7 +52,7 @@ func NewWithConfig(config ServerConfig) (*Adb, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &Adb{server}, nil
+	return &Adb{server: server}, nil
 }
 
 // Dial establishes a connection with the adb server.
@@ -46,22 +61,98 @@ func (c *Adb) Dial() (wire.IConn, error) {
 }
 
 // Starts the adb server if it’s not running.
+// A running server of another version than the adb executable is restarted, like adb does.
 func (c *Adb) StartServer() error {
-	return c.server.Start()
+	if err := c.server.Start(); err != nil {
+		return err
+	}
+	if _, ok := c.server.(*realServer); !ok {
+		return nil
+	}
+	if err := c.CheckServerVersion(); errors.Is(err, ErrServerVersionMismatch) {
+		return c.RestartServer()
+	}
+	return nil
 }
 
+// RestartServer kills the server, waits for its port to be released, and starts it again.
+func (c *Adb) RestartServer() error {
+	if err := c.KillServer(); err != nil && !errors.Is(err, wire.ErrServerNotAvailable) {
+		return fmt.Errorf("RestartServer: %w", err)
+	}
+	if err := c.server.Start(); err != nil {
+		return fmt.Errorf("RestartServer: %w", err)
+	}
+	return nil
+}
+
+// AdbVersion returns the version of the adb executable, like `adb --version`.
+func (c *Adb) AdbVersion() (AdbVersion, error) {
+	s, ok := c.server.(*realServer)
+	if !ok {
+		return AdbVersion{}, fmt.Errorf("AdbVersion: %w: no adb executable", wire.ErrServerNotAvailable)
+	}
+	v, err := s.binaryVersion()
+	if err != nil {
+		return v, fmt.Errorf("AdbVersion: %w", err)
+	}
+	return v, nil
+}
+
+// CheckServerVersion returns ErrServerVersionMismatch if the running server is not the
+// version of the adb executable.
+func (c *Adb) CheckServerVersion() error {
+	v, err := c.AdbVersion()
+	if err != nil {
+		return err
+	}
+	serverVersion, err := c.ServerVersion()
+	if err != nil {
+		return err
+	}
+	if serverVersion != v.ServerVersion {
+		return fmt.Errorf("%w: server %d, client %d (%s)", ErrServerVersionMismatch, serverVersion, v.ServerVersion, v.Path)
+	}
+	return nil
+}
+
+// Device returns a client of the device matching descriptor.
+// AnyDevice is resolved to ServerConfig.DefaultSerial if set, like adb honours ANDROID_SERIAL.
 func (c *Adb) Device(descriptor DeviceDescriptor) *Device {
+	if descriptor.descriptorType == DeviceAny {
+		if s, ok := c.server.(*realServer); ok && s.config.DefaultSerial != "" {
+			descriptor = DeviceWithSerial(s.config.DefaultSerial)
+		}
+	}
 	return &Device{
 		server:          c.server,
 		descriptor:      descriptor,
 		deviceListFunc:  c.ListDevices,
+		adbRateLimiter:  &c.rateLimiter,
 		CmdTimeoutShort: CommandTimeoutShortDefault,
 		CmdTimeoutLong:  CommandTimeoutLongDefault,
 	}
 }
 
+// SetRateLimit limits the total throughput of the sync transfers of all the devices of c, in
+// bytes per second, eg. to spare a USB hub pushing to many devices. 0 or less is unlimited.
+// It can be changed during transfers, see also Device.SetRateLimit.
+func (c *Adb) SetRateLimit(bytesPerSecond int64) {
+	c.rateLimiter.SetLimit(bytesPerSecond)
+}
+
+// RateLimit returns the limit set by SetRateLimit.
+func (c *Adb) RateLimit() int64 {
+	return c.rateLimiter.Limit()
+}
+
 func (c *Adb) NewDeviceWatcher() *DeviceWatcher {
-	return newDeviceWatcher(c.server)
+	return newDeviceWatcher(c.server, DeviceWatcherOptions{})
+}
+
+// NewDeviceWatcherWithOptions is NewDeviceWatcher configured by opts, eg. with auto-heal.
+func (c *Adb) NewDeviceWatcherWithOptions(opts DeviceWatcherOptions) *DeviceWatcher {
+	return newDeviceWatcher(c.server, opts)
 }
 
 // ServerVersion asks the ADB server for its internal version number.
@@ -86,7 +177,8 @@ func (c *Adb) HostFeatures() (map[string]bool, error) {
 	return featuresStrToMap(string(resp)), nil
 }
 
-// KillServer tells the server to quit immediately.
+// KillServer tells the server to quit immediately, and waits until its port is released,
+// so a new server can be started right after.
 // Corresponds to the command:
 //
 //	adb kill-server
@@ -100,6 +192,15 @@ func (c *Adb) KillServer() error {
 	if err = conn.SendMessage([]byte("host:kill")); err != nil {
 		return fmt.Errorf("KillServer: %w", err)
 	}
+	// the server may exit before answering OKAY
+	conn.SetReadDeadline(time.Now().Add(KillServerTimeout))
+	conn.ReadStatus("host:kill")
+
+	if s, ok := c.server.(*realServer); ok {
+		if err = s.waitReleased(KillServerTimeout); err != nil {
+			return fmt.Errorf("KillServer: %w", err)
+		}
+	}
 	return nil
 }
 
@@ -146,15 +247,70 @@ func (c *Adb) ListDevices() ([]*DeviceInfo, error) {
 // Corresponds to the command:
 //
 //	adb connect ip:port
+//
+// The server replies OKAY even if it can't connect, the result is in the message:
+//
+//	connected to 192.168.1.100:5555
+//	already connected to 192.168.1.100:5555
+//	failed to connect to '192.168.1.100:5555': Connection refused
+//	cannot connect to 192.168.1.100:5555: No route to host (113)
 func (c *Adb) Connect(addr string) error {
 	// connect may slow in internet, set 5 second timeout
-	_, err := roundTripSingleResponseTimeout(c.server, "host:connect:"+addr, time.Second*5)
+	resp, err := roundTripSingleResponseTimeout(c.server, "host:connect:"+addr, time.Second*5)
 	if err != nil {
 		return fmt.Errorf("Connect: %w", err)
 	}
+	if msg := string(bytes.TrimSpace(resp)); !strings.Contains(msg, "connected to") {
+		return fmt.Errorf("Connect: %w: %s", wire.ErrAdb, msg)
+	}
 	return nil
 }
 
+// MdnsCheck returns the version of the mdns backend of the server.
+// Corresponds to the command:
+//
+//	adb mdns check
+//
+// eg. "mdns daemon version [Openscreen discovery 0.0.0]"
+func (c *Adb) MdnsCheck() (string, error) {
+	resp, err := roundTripSingleResponse(c.server, "host:mdns:check")
+	if err != nil {
+		return "", fmt.Errorf("MdnsCheck: %w", err)
+	}
+	return string(bytes.TrimSpace(resp)), nil
+}
+
+// MdnsService is a service discovered by the server, Addr can be passed to Connect.
+type MdnsService struct {
+	Instance string // adb-R58M12345-AbCdEf
+	Service  string // _adb-tls-connect._tcp
+	Addr     string // 192.168.1.23:37777
+}
+
+// MdnsServices lists the services discovered by the mdns backend of the server.
+// Corresponds to the command:
+//
+//	adb mdns services
+func (c *Adb) MdnsServices() ([]MdnsService, error) {
+	resp, err := roundTripSingleResponse(c.server, "host:mdns:services")
+	if err != nil {
+		return nil, fmt.Errorf("MdnsServices: %w", err)
+	}
+	return parseMdnsServices(resp), nil
+}
+
+// parseMdnsServices parses lines of "<instance>\t<service>\t<ip>:<port>"
+func parseMdnsServices(resp []byte) (list []MdnsService) {
+	for _, line := range strings.Split(string(resp), "\n") {
+		fields := strings.Split(strings.TrimSpace(line), "\t")
+		if len(fields) != 3 {
+			continue
+		}
+		list = append(list, MdnsService{Instance: fields[0], Service: fields[1], Addr: fields[2]})
+	}
+	return
+}
+
 func (c *Adb) DisconnectAll() error {
 	_, err := roundTripSingleResponse(c.server, "host:disconnect:")
 	if err != nil {
@@ -171,6 +327,18 @@ func (c *Adb) Disconnect(addr string) error {
 	return nil
 }
 
+// ReconnectOffline kicks all offline transports so the server reconnects them.
+// Corresponds to the command:
+//
+//	adb reconnect offline
+func (c *Adb) ReconnectOffline() error {
+	_, err := roundTripSingleResponse(c.server, "host:reconnect-offline")
+	if err != nil {
+		return fmt.Errorf("ReconnectOffline: %w", err)
+	}
+	return nil
+}
+
 func (c *Adb) ListForward() ([]ForwardEntry, error) {
 	resp, err := roundTripSingleResponse(c.server, "host:list-forward")
 	if err != nil {
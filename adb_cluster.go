@@ -0,0 +1,237 @@
+package adb
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/prife/goadb/wire"
+)
+
+// ClusterSerialSeparator joins the server name and the device serial in cluster serials,
+// eg. "lab-2/emulator-5554".
+const ClusterSerialSeparator = "/"
+
+// ClusterServer is one adb server of an AdbCluster.
+type ClusterServer struct {
+	// Name tags the devices of this server, eg. "lab-2". Defaults to "host:port",
+	// it must be set for servers on unix sockets.
+	Name string
+	ServerConfig
+}
+
+// AdbCluster federates several adb servers, eg. servers of other hosts forwarded through
+// ssh tunnels on local ports:
+//
+//	cluster, err := adb.NewCluster(
+//		adb.ClusterServer{Name: "lab-1", ServerConfig: adb.ServerConfig{Port: 15037}},
+//		adb.ClusterServer{Name: "lab-2", ServerConfig: adb.ServerConfig{Port: 25037}},
+//	)
+//	devices, err := cluster.ListDevices()
+//	device, err := cluster.Device("lab-2/emulator-5554")
+//
+// The same serial may show up on several servers (eg. emulators), so devices are identified
+// by their cluster serial "<server>/<serial>".
+type AdbCluster struct {
+	names   []string
+	servers map[string]*Adb
+}
+
+// NewCluster creates an AdbCluster, names of servers must be unique.
+func NewCluster(servers ...ClusterServer) (*AdbCluster, error) {
+	names := make([]string, len(servers))
+	clients := make([]*Adb, len(servers))
+	for i, s := range servers {
+		client, err := NewWithConfig(s.ServerConfig)
+		if err != nil {
+			return nil, fmt.Errorf("NewCluster: server %d: %w", i, err)
+		}
+		names[i] = s.Name
+		if names[i] == "" {
+			names[i] = client.server.(*realServer).address
+		}
+		clients[i] = client
+	}
+	return newCluster(names, clients)
+}
+
+func newCluster(names []string, clients []*Adb) (*AdbCluster, error) {
+	c := &AdbCluster{servers: make(map[string]*Adb, len(names))}
+	for i, name := range names {
+		if strings.Contains(name, ClusterSerialSeparator) {
+			return nil, fmt.Errorf("NewCluster: %w: server name '%s' contains '%s'", wire.ErrAssertion, name, ClusterSerialSeparator)
+		}
+		if _, ok := c.servers[name]; ok {
+			return nil, fmt.Errorf("NewCluster: %w: duplicated server name '%s'", wire.ErrAssertion, name)
+		}
+		c.names = append(c.names, name)
+		c.servers[name] = clients[i]
+	}
+	return c, nil
+}
+
+// Servers returns the names of the servers, in the order given to NewCluster.
+func (c *AdbCluster) Servers() []string {
+	return append([]string(nil), c.names...)
+}
+
+// Server returns the client of the server name, or nil.
+func (c *AdbCluster) Server(name string) *Adb {
+	return c.servers[name]
+}
+
+// ClusterDeviceInfo is a DeviceInfo tagged with the name of its server.
+type ClusterDeviceInfo struct {
+	Server string
+	*DeviceInfo
+}
+
+// ClusterSerial returns "<server>/<serial>", which is unique in the cluster.
+func (d *ClusterDeviceInfo) ClusterSerial() string {
+	return d.Server + ClusterSerialSeparator + d.Serial
+}
+
+// ListDevices lists the devices of all servers concurrently, ordered by server.
+// Devices of reachable servers are returned even if others fail, along with the joined errors.
+func (c *AdbCluster) ListDevices() ([]*ClusterDeviceInfo, error) {
+	results := make([][]*DeviceInfo, len(c.names))
+	errs := make([]error, len(c.names))
+
+	var wg sync.WaitGroup
+	for i, name := range c.names {
+		wg.Add(1)
+		go func(i int, client *Adb) {
+			defer wg.Done()
+			results[i], errs[i] = client.ListDevices()
+		}(i, c.servers[name])
+	}
+	wg.Wait()
+
+	var devices []*ClusterDeviceInfo
+	for i, name := range c.names {
+		if errs[i] != nil {
+			errs[i] = fmt.Errorf("server %s: %w", name, errs[i])
+			continue
+		}
+		for _, info := range results[i] {
+			devices = append(devices, &ClusterDeviceInfo{Server: name, DeviceInfo: info})
+		}
+	}
+	return devices, errors.Join(errs...)
+}
+
+// Device returns the device of a cluster serial "<server>/<serial>".
+// A bare serial is looked up on all servers, and must be attached to exactly one of them.
+func (c *AdbCluster) Device(serial string) (*Device, error) {
+	if name, rest, ok := strings.Cut(serial, ClusterSerialSeparator); ok {
+		if client, ok := c.servers[name]; ok {
+			return client.Device(DeviceWithSerial(rest)), nil
+		}
+	}
+
+	devices, err := c.ListDevices()
+	var found []*ClusterDeviceInfo
+	for _, info := range devices {
+		if info.Serial == serial {
+			found = append(found, info)
+		}
+	}
+	switch len(found) {
+	case 0:
+		if err != nil {
+			return nil, fmt.Errorf("Device(%s): %w: %w", serial, wire.ErrDeviceNotFound, err)
+		}
+		return nil, fmt.Errorf("Device(%s): %w", serial, wire.ErrDeviceNotFound)
+	case 1:
+		return c.servers[found[0].Server].Device(DeviceWithSerial(serial)), nil
+	default:
+		var where []string
+		for _, info := range found {
+			where = append(where, info.ClusterSerial())
+		}
+		return nil, fmt.Errorf("Device(%s): %w: ambiguous serial, found %s", serial, wire.ErrAssertion, strings.Join(where, ", "))
+	}
+}
+
+// ClusterDeviceEvent is a DeviceStateChangedEvent tagged with the name of its server.
+type ClusterDeviceEvent struct {
+	Server string
+	DeviceStateChangedEvent
+}
+
+// ClusterSerial returns "<server>/<serial>", which is unique in the cluster.
+func (e ClusterDeviceEvent) ClusterSerial() string {
+	return e.Server + ClusterSerialSeparator + e.Serial
+}
+
+// ClusterWatcher merges the DeviceWatchers of all servers of a cluster.
+type ClusterWatcher struct {
+	watchers  map[string]*DeviceWatcher
+	eventChan chan ClusterDeviceEvent
+	stop      chan struct{}
+	stopOnce  sync.Once
+	err       error
+}
+
+// NewDeviceWatcher watches the devices of all servers.
+func (c *AdbCluster) NewDeviceWatcher() *ClusterWatcher {
+	w := &ClusterWatcher{
+		watchers:  make(map[string]*DeviceWatcher, len(c.names)),
+		eventChan: make(chan ClusterDeviceEvent),
+		stop:      make(chan struct{}),
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var errs []error
+	for _, name := range c.names {
+		watcher := c.servers[name].NewDeviceWatcher()
+		w.watchers[name] = watcher
+
+		wg.Add(1)
+		go func(name string, watcher *DeviceWatcher) {
+			defer wg.Done()
+			for event := range watcher.C() {
+				select {
+				case w.eventChan <- ClusterDeviceEvent{Server: name, DeviceStateChangedEvent: event}:
+				case <-w.stop:
+					return
+				}
+			}
+			if err := watcher.Err(); err != nil {
+				mu.Lock()
+				errs = append(errs, fmt.Errorf("server %s: %w", name, err))
+				mu.Unlock()
+			}
+		}(name, watcher)
+	}
+
+	go func() {
+		wg.Wait()
+		w.err = errors.Join(errs...)
+		close(w.eventChan)
+	}()
+	return w
+}
+
+// C returns the channel of events of all servers.
+// It is closed when all watchers failed, or Shutdown is called.
+func (w *ClusterWatcher) C() <-chan ClusterDeviceEvent {
+	return w.eventChan
+}
+
+// Err returns the errors of the watchers which failed, once C is closed.
+func (w *ClusterWatcher) Err() error {
+	return w.err
+}
+
+// Shutdown stops all watchers and closes the channel returned from C.
+func (w *ClusterWatcher) Shutdown() {
+	w.stopOnce.Do(func() {
+		close(w.stop)
+		for _, watcher := range w.watchers {
+			watcher.Shutdown()
+		}
+	})
+}
@@ -0,0 +1,154 @@
+package adb
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prife/goadb/wire"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestCluster(t *testing.T, lists ...string) (*AdbCluster, []*MockServer) {
+	var names []string
+	var clients []*Adb
+	var servers []*MockServer
+	for i, list := range lists {
+		s := &MockServer{Status: wire.StatusSuccess, Messages: []string{list}}
+		names = append(names, []string{"lab-1", "lab-2", "lab-3"}[i])
+		clients = append(clients, &Adb{server: s})
+		servers = append(servers, s)
+	}
+	cluster, err := newCluster(names, clients)
+	assert.NoError(t, err)
+	return cluster, servers
+}
+
+func TestNewCluster_InvalidNames(t *testing.T) {
+	_, err := newCluster([]string{"lab", "lab"}, []*Adb{{}, {}})
+	assert.ErrorIs(t, err, wire.ErrAssertion)
+
+	_, err = newCluster([]string{"lab/1"}, []*Adb{{}})
+	assert.ErrorIs(t, err, wire.ErrAssertion)
+}
+
+func TestAdbCluster_ListDevices(t *testing.T) {
+	cluster, _ := newTestCluster(t,
+		"emulator-5554 device product:sdk model:sdk device:generic transport_id:1\n",
+		"emulator-5554 device product:sdk model:sdk device:generic transport_id:3\n"+
+			"R58M12345 device usb:1-1 product:a51 model:SM_A515F device:a51 transport_id:4\n",
+	)
+
+	devices, err := cluster.ListDevices()
+	assert.NoError(t, err)
+	var serials []string
+	for _, d := range devices {
+		serials = append(serials, d.ClusterSerial())
+	}
+	assert.Equal(t, []string{"lab-1/emulator-5554", "lab-2/emulator-5554", "lab-2/R58M12345"}, serials)
+	assert.Equal(t, 4, devices[2].TransportID)
+}
+
+func TestAdbCluster_ListDevicesPartialFailure(t *testing.T) {
+	cluster, servers := newTestCluster(t,
+		"emulator-5554 device transport_id:1\n",
+		"",
+	)
+	servers[1].Errs = []error{wire.ErrServerNotAvailable}
+
+	devices, err := cluster.ListDevices()
+	assert.ErrorIs(t, err, wire.ErrServerNotAvailable)
+	assert.ErrorContains(t, err, "server lab-2")
+	assert.Len(t, devices, 1)
+	assert.Equal(t, "lab-1", devices[0].Server)
+}
+
+func TestAdbCluster_Device(t *testing.T) {
+	list := "emulator-5554 device transport_id:1\n"
+	cluster, servers := newTestCluster(t, list, list+"R58M12345 device usb:1-1 transport_id:4\n")
+
+	// qualified serials don't need to list devices
+	d, err := cluster.Device("lab-1/emulator-5554")
+	assert.NoError(t, err)
+	assert.Equal(t, DeviceWithSerial("emulator-5554"), d.descriptor)
+	assert.Same(t, servers[0], d.server)
+	assert.Empty(t, servers[0].Requests)
+
+	d, err = cluster.Device("R58M12345")
+	assert.NoError(t, err)
+	assert.Same(t, servers[1], d.server)
+
+	cluster, _ = newTestCluster(t, list, list)
+	_, err = cluster.Device("emulator-5554")
+	assert.ErrorIs(t, err, wire.ErrAssertion)
+	assert.ErrorContains(t, err, "lab-1/emulator-5554, lab-2/emulator-5554")
+
+	cluster, _ = newTestCluster(t, list, list)
+	_, err = cluster.Device("nope")
+	assert.ErrorIs(t, err, wire.ErrDeviceNotFound)
+}
+
+// trackServer answers track-devices with msgs, and keeps the connection open until the
+// watcher closes it.
+func trackServer(msgs ...string) *pipeServer {
+	return &pipeServer{handler: func(conn *wire.Conn) {
+		if _, err := conn.ReadMessage(); err != nil {
+			return
+		}
+		conn.Write([]byte(wire.StatusSuccess))
+		for _, msg := range msgs {
+			writeHexMessage(conn, msg)
+		}
+		conn.ReadUntilEof()
+	}}
+}
+
+func TestAdbCluster_NewDeviceWatcher(t *testing.T) {
+	cluster, err := newCluster([]string{"lab-1", "lab-2"}, []*Adb{
+		{server: trackServer("emulator-5554\tdevice\n")},
+		{server: trackServer("emulator-5554\toffline\n", "malformed\n")},
+	})
+	assert.NoError(t, err)
+	watcher := cluster.NewDeviceWatcher()
+
+	var serials []string
+	for i := 0; i < 2; i++ {
+		select {
+		case event := <-watcher.C():
+			serials = append(serials, event.ClusterSerial())
+			if event.Server == "lab-1" {
+				assert.Equal(t, StateOnline, event.NewState)
+			} else {
+				assert.Equal(t, StateOffline, event.NewState)
+			}
+		case <-time.After(time.Second * 2):
+			t.Fatal("missing events")
+		}
+	}
+	assert.ElementsMatch(t, []string{"lab-1/emulator-5554", "lab-2/emulator-5554"}, serials)
+
+	// lab-2 failed, lab-1 is still watched
+	assert.Eventually(t, func() bool { return watcher.watchers["lab-2"].Err() != nil }, time.Second*2, time.Millisecond*10)
+	assert.NoError(t, watcher.watchers["lab-1"].Err())
+	watcher.Shutdown()
+	for range watcher.C() {
+	}
+	assert.ErrorIs(t, watcher.Err(), wire.ErrParse)
+	assert.ErrorContains(t, watcher.Err(), "server lab-2")
+	assert.NotContains(t, watcher.Err().Error(), "lab-1")
+
+	// C is closed once all servers failed
+	cluster, err = newCluster([]string{"lab-1", "lab-2"}, []*Adb{
+		{server: trackServer("malformed\n")},
+		{server: trackServer("malformed\n")},
+	})
+	assert.NoError(t, err)
+	watcher = cluster.NewDeviceWatcher()
+	select {
+	case _, ok := <-watcher.C():
+		assert.False(t, ok)
+	case <-time.After(time.Second * 2):
+		t.Fatal("watcher not closed after all servers failed")
+	}
+	assert.ErrorContains(t, watcher.Err(), "server lab-1")
+	assert.ErrorContains(t, watcher.Err(), "server lab-2")
+}
@@ -12,7 +12,7 @@ func TestGetServerVersion(t *testing.T) {
 		Status:   wire.StatusSuccess,
 		Messages: []string{"000a"},
 	}
-	client := &Adb{s}
+	client := &Adb{server: s}
 
 	v, err := client.ServerVersion()
 	assert.Equal(t, "host:version", s.Requests[0])
@@ -98,3 +98,31 @@ func TestAdb_DisconnectAll(t *testing.T) {
 	err := adbclient.DisconnectAll()
 	assert.Nil(t, err)
 }
+
+func TestAdb_MdnsServices(t *testing.T) {
+	s := &MockServer{
+		Status: wire.StatusSuccess,
+		Messages: []string{"adb-R58M12345-AbCdEf\t_adb-tls-connect._tcp\t192.168.1.23:37777\n" +
+			"adb-R58M12345-AbCdEf\t_adb-tls-pairing._tcp\t192.168.1.23:41234\n"},
+	}
+	list, err := (&Adb{server: s}).MdnsServices()
+	assert.NoError(t, err)
+	assert.Equal(t, "host:mdns:services", s.Requests[0])
+	assert.Equal(t, []MdnsService{
+		{"adb-R58M12345-AbCdEf", "_adb-tls-connect._tcp", "192.168.1.23:37777"},
+		{"adb-R58M12345-AbCdEf", "_adb-tls-pairing._tcp", "192.168.1.23:41234"},
+	}, list)
+}
+
+func TestAdb_DeviceDefaultSerial(t *testing.T) {
+	s, err := newServer(ServerConfig{
+		DefaultSerial: "emulator-5554",
+		PathToAdb:     "/bin/adb",
+		fs:            &filesystem{IsExecutableFile: func(string) error { return nil }},
+	})
+	assert.NoError(t, err)
+	client := &Adb{server: s}
+
+	assert.Equal(t, DeviceWithSerial("emulator-5554"), client.Device(AnyDevice()).descriptor)
+	assert.Equal(t, AnyUsbDevice(), client.Device(AnyUsbDevice()).descriptor)
+}
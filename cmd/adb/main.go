@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"encoding/hex"
 	"errors"
 	"fmt"
@@ -13,6 +14,7 @@ import (
 	"github.com/alecthomas/kingpin/v2"
 	"github.com/cheggaaa/pb"
 	adb "github.com/prife/goadb"
+	"github.com/prife/goadb/mdns"
 	"github.com/prife/goadb/wire"
 )
 
@@ -75,6 +77,16 @@ var (
 		"Path of destination file on device.").
 		Required().
 		String()
+
+	mdnsCommand = kingpin.Command("mdns",
+		"Discover wireless devices with mDNS.")
+	mdnsConnectFlag = mdnsCommand.Flag("connect",
+		"Connect to each discovered device.").
+		Bool()
+	mdnsTimeoutFlag = mdnsCommand.Flag("timeout",
+		"How long to browse.").
+		Default("5s").
+		Duration()
 )
 
 var client *adb.Adb
@@ -83,7 +95,7 @@ func main() {
 	var exitCode int
 
 	var err error
-	client, err = adb.NewWithConfig(adb.ServerConfig{})
+	client, err = adb.New()
 	if err != nil {
 		fmt.Fprintln(os.Stderr, "error:", err)
 		os.Exit(1)
@@ -102,6 +114,8 @@ func main() {
 		exitCode = push(*pushProgressFlag, *pushLocalArg, *pushRemoteArg, parseDevice())
 	case "push2":
 		exitCode = push2(parseDevice(), *pushLocalArg2, *pushRemoteArg2)
+	case "mdns":
+		exitCode = browseMdns(*mdnsConnectFlag, *mdnsTimeoutFlag)
 	}
 
 	os.Exit(exitCode)
@@ -149,6 +163,28 @@ func listDevices(long bool) int {
 	return 0
 }
 
+func browseMdns(connect bool, timeout time.Duration) int {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	browser := &mdns.Browser{}
+	endpoints, err := browser.Browse(ctx, mdns.ServiceTlsConnect)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	}
+
+	for ep := range endpoints {
+		fmt.Printf("%s\t%s\t%s\n", ep.Instance, ep.Service, ep.Addr())
+		if connect {
+			if err := client.Connect(ep.Addr()); err != nil {
+				fmt.Fprintln(os.Stderr, "error:", err)
+			}
+		}
+	}
+	return 0
+}
+
 func runShellCommand(commandAndArgs []string, device adb.DeviceDescriptor) int {
 	if len(commandAndArgs) == 0 {
 		fmt.Fprintln(os.Stderr, "error: no command")
@@ -1,10 +1,13 @@
 package adb
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"regexp"
 	"strconv"
+
+	"github.com/prife/goadb/wire"
 )
 
 type DfEntry struct {
@@ -237,3 +240,30 @@ func (d *Device) GetDiskSize() (sizeInBytes uint64, err error) {
 	}
 	return
 }
+
+// DFPath returns the df entry of the file system of name, which must exist. It uses
+// `df -k name` of toybox, in exact KiB. The toolbox of Android 5 and 6 has no -k, its entry
+// is human readable, so rounded, and it is named after name rather than the mount point.
+func (d *Device) DFPath(name string) (DfEntry, error) {
+	resp, err := d.RunCommand("df -k " + shellQuote(name))
+	if err != nil {
+		return DfEntry{}, err
+	}
+
+	// toolbox reports '-k' as a missing file, followed by the entry of name
+	var list []DfEntry
+	if bytes.Contains(resp, []byte("1K-blocks")) {
+		list = unpackDfV2(resp)
+		for i := range list {
+			list[i].Size *= 1024
+			list[i].Used *= 1024
+			list[i].Avail *= 1024
+		}
+	} else {
+		list = unpackDfV1(resp)
+	}
+	if len(list) == 0 {
+		return DfEntry{}, fmt.Errorf("df %s: %w: %s", name, wire.ErrParse, bytes.TrimSpace(resp))
+	}
+	return list[len(list)-1], nil
+}
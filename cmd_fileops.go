@@ -0,0 +1,319 @@
+package adb
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prife/goadb/wire"
+)
+
+// ErrReadOnly is the error of a file operation on a read-only file system, eg. /system.
+var ErrReadOnly = errors.New("ReadOnlyFileSystem")
+
+// maxFileOpCommandLen is the max length of a command line of the file operations, under
+// wire.MaxPayloadV1Length with "shell:" and the echo of the exit status.
+const maxFileOpCommandLen = 4000
+
+// fileOpErrorMessages maps the strerror of the device to the typed errors.
+var fileOpErrorMessages = []struct {
+	msg string
+	err error
+}{
+	{"No such file or directory", fs.ErrNotExist},
+	{"Permission denied", fs.ErrPermission},
+	{"Operation not permitted", fs.ErrPermission},
+	{"Read-only file system", ErrReadOnly},
+	{"File exists", fs.ErrExist},
+}
+
+// fileOpPathRegexes find the path in the error lines, in order.
+var fileOpPathRegexes = []*regexp.Regexp{
+	// mv: '/sdcard/a': No such file or directory
+	regexp.MustCompile(`'([^']*)'`),
+	// toolbox: mkdir failed for /a, Read-only file system
+	regexp.MustCompile(`failed for (.+), [^,]+$`),
+	// toolbox: Unable to chmod /data/a: Operation not permitted
+	regexp.MustCompile(`^Unable to \w+ (.+): [^:]+$`),
+	// chmod: /a: Operation not permitted
+	regexp.MustCompile(`^[\w.-]+: (.+): [^:]+$`),
+}
+
+// parseFileOpError converts an error line of toybox or toolbox into a *fs.PathError of op,
+// matched by errors.Is for fs.ErrNotExist, fs.ErrPermission, fs.ErrExist or ErrReadOnly.
+// The other lines are returned as they are.
+//
+// # Android 14, toybox
+//
+//	mv: '/sdcard/a': No such file or directory
+//	chmod: /system/bin/sh: Read-only file system
+//	ln: '/sdcard/link': File exists
+//
+// # Android 5.1, toolbox
+//
+//	mkdir failed for /a, Read-only file system
+//	Unable to chmod /data/a: Operation not permitted
+//	failed on '/sdcard/a' - No such file or directory
+func parseFileOpError(op string, line string) error {
+	var target error
+	for _, m := range fileOpErrorMessages {
+		if strings.HasSuffix(line, m.msg) {
+			target = m.err
+			break
+		}
+	}
+	if target == nil {
+		return errors.New(line)
+	}
+
+	var name string
+	for _, re := range fileOpPathRegexes {
+		if m := re.FindStringSubmatch(line); m != nil {
+			name = m[1]
+			break
+		}
+	}
+	return &fs.PathError{Op: op, Path: name, Err: target}
+}
+
+// parseFileOpErrors parses each line of resp with parseFileOpError.
+func parseFileOpErrors(op string, resp []byte) (errs []error) {
+	scanner := bufio.NewScanner(bytes.NewReader(resp))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" {
+			errs = append(errs, parseFileOpError(op, line))
+		}
+	}
+	return
+}
+
+// shellBatches quotes args and appends them to cmd, in as many command lines as needed
+// to stay under maxFileOpCommandLen.
+func shellBatches(cmd string, args []string) ([]string, error) {
+	var lines []string
+	line := cmd
+	for _, arg := range args {
+		quoted := " " + shellQuote(arg)
+		if len(cmd)+len(quoted) > maxFileOpCommandLen {
+			return nil, fmt.Errorf("%w: argument too long: %.64s...", wire.ErrAssertion, arg)
+		}
+		if len(line)+len(quoted) > maxFileOpCommandLen {
+			lines = append(lines, line)
+			line = cmd
+		}
+		line += quoted
+	}
+	if line != cmd {
+		lines = append(lines, line)
+	}
+	return lines, nil
+}
+
+// runFileOp runs cmdline, it returns the output, or the typed errors of its error lines
+// if it fails.
+func (c *Device) runFileOp(op, cmdline string) ([]byte, error) {
+	return c.runFileOpCtx(context.Background(), c.CmdTimeoutShort, op, cmdline)
+}
+
+// runFileOpCtx is runFileOp with the timeout of the output, 0 for none, stopped when ctx is done.
+func (c *Device) runFileOpCtx(ctx context.Context, timeout time.Duration, op, cmdline string) ([]byte, error) {
+	conn, err := c.RunShellCommand(false, fmt.Sprintf("%s; echo %s$?", cmdline, exitStatusMarker))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer conn.Close()
+	defer closeOnDone(ctx, conn)()
+	if timeout > 0 {
+		if err = conn.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+	resp, err := io.ReadAll(conn)
+	if ctx.Err() != nil {
+		return nil, fmt.Errorf("%s failed by ctx done: %w", op, ctx.Err())
+	} else if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if err = parseExitStatus(resp); err == nil {
+		return resp[:bytes.LastIndex(resp, []byte(exitStatusMarker))], nil
+	} else if errors.Is(err, wire.ErrParse) {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	errs := parseFileOpErrors(op, resp[:bytes.LastIndex(resp, []byte(exitStatusMarker))])
+	if len(errs) == 0 {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return nil, errors.Join(errs...)
+}
+
+// runFileOpBatches runs cmd on args by shellBatches, the errors of all batches are joined.
+func (c *Device) runFileOpBatches(op, cmd string, args []string) error {
+	lines, err := shellBatches(cmd, args)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	var errs []error
+	for _, line := range lines {
+		if _, err := c.runFileOp(op, line); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Rename renames (moves) oldpath to newpath on the device, with mv. A move across file
+// systems copies the data, it may take up to CmdTimeoutLong, see RenameCtx.
+func (c *Device) Rename(oldpath, newpath string) error {
+	_, err := c.runFileOpCtx(context.Background(), c.CmdTimeoutLong, "rename", "mv "+shellQuote(oldpath)+" "+shellQuote(newpath))
+	return err
+}
+
+// RenameCtx is Rename without timeout, mv is stopped when ctx is done.
+func (c *Device) RenameCtx(ctx context.Context, oldpath, newpath string) error {
+	_, err := c.runFileOpCtx(ctx, 0, "rename", "mv "+shellQuote(oldpath)+" "+shellQuote(newpath))
+	return err
+}
+
+// Copy copies src to dst on the device, directories recursively, with cp -R. It may take up
+// to CmdTimeoutLong, see CopyCtx.
+func (c *Device) Copy(src, dst string) error {
+	_, err := c.runFileOpCtx(context.Background(), c.CmdTimeoutLong, "copy", "cp -R "+shellQuote(src)+" "+shellQuote(dst))
+	return err
+}
+
+// CopyCtx is Copy without timeout, cp is stopped when ctx is done.
+func (c *Device) CopyCtx(ctx context.Context, src, dst string) error {
+	_, err := c.runFileOpCtx(ctx, 0, "copy", "cp -R "+shellQuote(src)+" "+shellQuote(dst))
+	return err
+}
+
+// Chmod changes the permissions of paths to mode.Perm(), in batches under the payload limit.
+// The errors of the paths are joined.
+func (c *Device) Chmod(mode fs.FileMode, paths ...string) error {
+	return c.runFileOpBatches("chmod", fmt.Sprintf("chmod %04o", mode.Perm()), paths)
+}
+
+// Chown changes the owner of paths, and their group unless it is empty, in batches like Chmod.
+// Owner and group are names or numeric ids, eg. "shell" or "2000".
+func (c *Device) Chown(owner, group string, paths ...string) error {
+	spec := owner
+	if group != "" {
+		spec += ":" + group
+	}
+	return c.runFileOpBatches("chown", "chown "+shellQuote(spec), paths)
+}
+
+// Symlink creates newname as a symbolic link to oldname, like os.Symlink.
+func (c *Device) Symlink(oldname, newname string) error {
+	_, err := c.runFileOp("symlink", "ln -s "+shellQuote(oldname)+" "+shellQuote(newname))
+	return err
+}
+
+// Readlink returns the target of the symbolic link name, like os.Readlink.
+func (c *Device) Readlink(name string) (string, error) {
+	resp, err := c.runFileOp("readlink", "readlink "+shellQuote(name))
+	if err != nil {
+		var pathErr *fs.PathError
+		if errors.As(err, &pathErr) {
+			return "", err
+		}
+		// readlink fails silently if name is missing or not a link
+		if exists, serr := c.Exists(name); serr == nil && !exists {
+			return "", &fs.PathError{Op: "readlink", Path: name, Err: fs.ErrNotExist}
+		}
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: fs.ErrInvalid}
+	}
+	return strings.TrimRight(string(resp), "\r\n"), nil
+}
+
+// Touch sets the access and modification times of paths to mtime, creating the missing
+// files, in batches like Chmod. The zero mtime is the current time of the device.
+// It needs the touch of toybox, from Android 6.
+func (c *Device) Touch(mtime time.Time, paths ...string) error {
+	cmd := "touch"
+	if !mtime.IsZero() {
+		cmd += " -d @" + strconv.FormatInt(mtime.Unix(), 10)
+	}
+	return c.runFileOpBatches("touch", cmd, paths)
+}
+
+// Truncate changes the size of the file name to size, creating it if missing.
+// It needs the truncate of toybox, from Android 6.
+func (c *Device) Truncate(name string, size int64) error {
+	_, err := c.runFileOp("truncate", fmt.Sprintf("truncate -s %d %s", size, shellQuote(name)))
+	return err
+}
+
+// Exists returns true if name exists on the device, a broken symlink too. It uses the lstat
+// of sync, so it has no error for a missing name.
+func (c *Device) Exists(name string) (bool, error) {
+	_, err := c.Stat(name)
+	if errors.Is(err, wire.ErrFileNoExist) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// globBracketRegex matches the bracket expressions which are safe unquoted.
+var globBracketRegex = regexp.MustCompile(`^\[!?[\w.-]+\]`)
+
+// globQuote quotes pattern for sh, except its wildcards *, ? and simple bracket expressions.
+func globQuote(pattern string) string {
+	var sb strings.Builder
+	var literal strings.Builder
+	flush := func() {
+		if literal.Len() > 0 {
+			sb.WriteString(shellQuote(literal.String()))
+			literal.Reset()
+		}
+	}
+	for i := 0; i < len(pattern); i++ {
+		switch ch := pattern[i]; ch {
+		case '*', '?':
+			flush()
+			sb.WriteByte(ch)
+		case '[':
+			if m := globBracketRegex.FindString(pattern[i:]); m != "" {
+				flush()
+				sb.WriteString(m)
+				i += len(m) - 1
+				continue
+			}
+			literal.WriteByte(ch)
+		default:
+			literal.WriteByte(ch)
+		}
+	}
+	flush()
+	return sb.String()
+}
+
+// Glob returns the sorted paths matching pattern, expanded by sh on the device, like
+// filepath.Glob. Wildcards are *, ? and bracket expressions of letters, digits, '_', '.' and '-'.
+func (c *Device) Glob(pattern string) ([]string, error) {
+	// sh leaves a pattern without match as is
+	cmd := fmt.Sprintf(`for f in %s; do if [ -e "$f" -o -L "$f" ]; then echo "$f"; fi; done`, globQuote(pattern))
+	resp, err := c.runFileOp("glob", cmd)
+	if err != nil {
+		return nil, err
+	}
+	var matches []string
+	scanner := bufio.NewScanner(bytes.NewReader(resp))
+	for scanner.Scan() {
+		if line := strings.TrimRight(scanner.Text(), "\r"); line != "" {
+			matches = append(matches, line)
+		}
+	}
+	sort.Strings(matches)
+	return matches, nil
+}
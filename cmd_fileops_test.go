@@ -0,0 +1,165 @@
+package adb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prife/goadb/wire"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseFileOpError(t *testing.T) {
+	for _, tt := range []struct {
+		line string
+		path string
+		err  error
+	}{
+		// Android 14
+		{"mv: '/sdcard/a': No such file or directory", "/sdcard/a", fs.ErrNotExist},
+		{"chmod: /system/bin/sh: Read-only file system", "/system/bin/sh", ErrReadOnly},
+		{"ln: '/sdcard/link': File exists", "/sdcard/link", fs.ErrExist},
+		{"touch: '/data/a': Permission denied", "/data/a", fs.ErrPermission},
+		// Android 5.1
+		{"mkdir failed for /a, Read-only file system", "/a", ErrReadOnly},
+		{"Unable to chmod /data/a: Operation not permitted", "/data/a", fs.ErrPermission},
+		{"failed on '/sdcard/my a' - No such file or directory", "/sdcard/my a", fs.ErrNotExist},
+	} {
+		err := parseFileOpError("op", tt.line)
+		var pathErr *fs.PathError
+		assert.True(t, errors.As(err, &pathErr), tt.line)
+		assert.Equal(t, tt.path, pathErr.Path, tt.line)
+		assert.ErrorIs(t, err, tt.err, tt.line)
+	}
+
+	err := parseFileOpError("op", "chown: bad user 'nobody2'")
+	assert.EqualError(t, err, "chown: bad user 'nobody2'")
+}
+
+func TestShellBatches(t *testing.T) {
+	lines, err := shellBatches("chmod 0644", []string{"/a", "/it's"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{`chmod 0644 '/a' '/it'\''s'`}, lines)
+
+	var args []string
+	for i := 0; i < 1000; i++ {
+		args = append(args, fmt.Sprintf("/sdcard/%03d", i))
+	}
+	lines, err = shellBatches("rm", args)
+	assert.NoError(t, err)
+	assert.Len(t, lines, 4)
+	var n int
+	for _, line := range lines {
+		assert.LessOrEqual(t, len(line), maxFileOpCommandLen)
+		n += strings.Count(line, "'/sdcard/")
+	}
+	assert.Equal(t, 1000, n)
+
+	lines, err = shellBatches("rm", nil)
+	assert.NoError(t, err)
+	assert.Empty(t, lines)
+
+	_, err = shellBatches("rm", []string{strings.Repeat("a", maxFileOpCommandLen)})
+	assert.ErrorIs(t, err, wire.ErrAssertion)
+}
+
+func TestGlobQuote(t *testing.T) {
+	assert.Equal(t, `'/sdcard/my dir/'*'.txt'`, globQuote("/sdcard/my dir/*.txt"))
+	assert.Equal(t, `'/data/log'[0-9]'.'?`, globQuote("/data/log[0-9].?"))
+	assert.Equal(t, `'/data/[$(reboot)]'`, globQuote("/data/[$(reboot)]"))
+}
+
+func TestDevice_FileOps(t *testing.T) {
+	f := newFakeDevice(t)
+	var cmds []string
+	f.Service = func(service string, conn *wire.Conn) {
+		cmd, _, _ := strings.Cut(strings.TrimPrefix(service, "shell:"), "; echo "+exitStatusMarker)
+		cmds = append(cmds, cmd)
+		switch {
+		case strings.HasPrefix(cmd, "chmod "):
+			io.WriteString(conn, "chmod: /system/a: Read-only file system\nchmod: '/data/none': No such file or directory\n")
+			fmt.Fprintf(conn, "%s1\n", exitStatusMarker)
+		case strings.HasPrefix(cmd, "readlink '/data/link'"):
+			fmt.Fprintf(conn, "a.txt\n%s0\n", exitStatusMarker)
+		case strings.HasPrefix(cmd, "readlink "):
+			fmt.Fprintf(conn, "%s1\n", exitStatusMarker)
+		case strings.HasPrefix(cmd, "for f in "):
+			fmt.Fprintf(conn, "/data/b.txt\n/data/a.txt\n%s0\n", exitStatusMarker)
+		default:
+			fmt.Fprintf(conn, "%s0\n", exitStatusMarker)
+		}
+	}
+	d := f.Device()
+	f.WriteFile(t, "data/a.txt", "hello", someMtime)
+
+	err := d.Chmod(0755, "/system/a", "/data/none")
+	assert.ErrorIs(t, err, ErrReadOnly)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	assert.NotErrorIs(t, err, os.ErrPermission)
+
+	assert.NoError(t, d.Chown("shell", "", "/data/a"))
+	assert.NoError(t, d.Touch(someMtime, "/data/a"))
+	assert.NoError(t, d.Rename("/data/a", "/data/my b"))
+	assert.NoError(t, d.Truncate("/data/a", 1024))
+
+	target, err := d.Readlink("/data/link")
+	assert.NoError(t, err)
+	assert.Equal(t, "a.txt", target)
+	_, err = d.Readlink("/data/a.txt")
+	assert.ErrorIs(t, err, fs.ErrInvalid)
+	_, err = d.Readlink("/data/none")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+
+	matches, err := d.Glob("/data/*.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"/data/a.txt", "/data/b.txt"}, matches)
+
+	exists, err := d.Exists("/data/a.txt")
+	assert.NoError(t, err)
+	assert.True(t, exists)
+	exists, err = d.Exists("/data/none")
+	assert.NoError(t, err)
+	assert.False(t, exists)
+
+	assert.Equal(t, []string{
+		"chmod 0755 '/system/a' '/data/none'",
+		"chown 'shell' '/data/a'",
+		fmt.Sprintf("touch -d @%d '/data/a'", someMtime.Unix()),
+		"mv '/data/a' '/data/my b'",
+		"truncate -s 1024 '/data/a'",
+		"readlink '/data/link'",
+		"readlink '/data/a.txt'",
+		"readlink '/data/none'",
+		`for f in '/data/'*'.txt'; do if [ -e "$f" -o -L "$f" ]; then echo "$f"; fi; done`,
+	}, cmds)
+}
+
+func TestDevice_CopyCtx(t *testing.T) {
+	f := newFakeDevice(t)
+	f.Service = func(service string, conn *wire.Conn) {
+		if strings.Contains(service, "'/data/big'") {
+			// copying, until killed
+			conn.ReadUntilEof()
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+		fmt.Fprintf(conn, "%s0\n", exitStatusMarker)
+	}
+	d := f.Device()
+
+	// copying data takes longer than the short timeout
+	d.CmdTimeoutShort = 10 * time.Millisecond
+	assert.NoError(t, d.Copy("/data/a", "/data/b"))
+	assert.NoError(t, d.Rename("/data/a", "/sdcard/a"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := d.CopyCtx(ctx, "/data/big", "/data/big2")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
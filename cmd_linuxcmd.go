@@ -3,10 +3,7 @@ package adb
 import (
 	"bytes"
 	"context"
-	"errors"
 	"fmt"
-	"io"
-	"os"
 	"regexp"
 	"strconv"
 	"strings"
@@ -343,15 +340,9 @@ func (d *Device) GetCpuInfo() (cpuInfo CpuInfo, err error) {
 	return
 }
 
-// Reboot the device
+// Reboot the device with 'reboot:' service
 func (d *Device) Reboot(ctx context.Context, waitToBootCompleted bool) error {
-	_, err := d.RunCommand("reboot")
-	if errors.Is(err, os.ErrDeadlineExceeded) {
-		// pass
-		// err is "read tcp 127.0.0.1:65357->127.0.0.1:5037: i/o timeout"
-	} else if err == io.EOF {
-		// pass
-	} else if err != nil {
+	if err := d.triggerReboot(RebootSystem); err != nil {
 		return fmt.Errorf("reboot failed: %w", err)
 	}
 
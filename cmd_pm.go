@@ -134,6 +134,15 @@ func (d *Device) PmUninstall(packageName string) (err error) {
 
 func (d *Device) PmInstall(ctx context.Context, apkPath string, reinstall bool, grantPermission bool,
 	allowDowngrade bool) error {
+	// the apk is copied to /data/app
+	if d.StoragePreflight {
+		if size, _, _, err := d.remoteFileStat(apkPath); err == nil {
+			if err := d.storagePreflight("/data/app", size); err != nil {
+				return fmt.Errorf("pm install %s: %w", apkPath, err)
+			}
+		}
+	}
+
 	var args string
 	if reinstall {
 		args += "-r "
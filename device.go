@@ -6,6 +6,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/prife/goadb/wire"
@@ -28,7 +29,7 @@ const (
 	FeatureFixedPushSymlinkTimestamp = "fixed_push_symlink_timestamp"
 	FeatureAbbExec                   = "abb_exec"
 	FeatureRemountShell              = "remount_shell"
-	//track_app
+	FeatureTrackApp                  = "track_app"
 	//sendrecv_v2
 	//sendrecv_v2_brotli
 	//sendrecv_v2_lz4
@@ -46,10 +47,20 @@ type Device struct {
 
 	// Used to get device info.
 	deviceListFunc func() ([]*DeviceInfo, error)
+	featuresMu     sync.Mutex
 	deviceFeatures map[string]bool
 
+	// throttle the sync transfers, see SetRateLimit
+	rateLimiter    wire.RateLimiter
+	adbRateLimiter *wire.RateLimiter
+
 	CmdTimeoutShort time.Duration
 	CmdTimeoutLong  time.Duration
+
+	// StoragePreflight enables the free space check before every push of files, directories,
+	// or of a PushReader of known size, and before PmInstall. It costs a few round trips and
+	// a df, see CheckStorage.
+	StoragePreflight bool
 }
 
 func (c *Device) String() string {
@@ -77,12 +88,30 @@ func (c *Device) DeviceFeatures() (features map[string]bool, err error) {
 	return
 }
 
+// hasFeature reports whether the device has the feature name, the features are asked once.
+func (c *Device) hasFeature(name string) bool {
+	c.featuresMu.Lock()
+	defer c.featuresMu.Unlock()
+	if c.deviceFeatures == nil {
+		features, err := c.DeviceFeatures()
+		if err != nil {
+			return false
+		}
+		c.deviceFeatures = features
+	}
+	return c.deviceFeatures[name]
+}
+
 func (c *Device) State() (DeviceState, error) {
 	attr, err := c.getAttribute("get-state")
 	if err != nil {
 		if strings.Contains(err.Error(), "unauthorized") {
 			return StateUnauthorized, nil
 		}
+		// server error: insufficient permissions for device: missing udev rules? user is in the plugdev group
+		if strings.Contains(err.Error(), "insufficient permissions") {
+			return StateNoPermissions, nil
+		}
 		return StateInvalid, wrapClientError(err, c, "State")
 	}
 	state, err := parseDeviceState(attr)
@@ -216,15 +245,26 @@ func (c *Device) DoRemoveForward(local string) (err error) {
 //	that.
 //
 // Source: https://android.googlesource.com/platform/system/core/+/master/adb/SERVICES.TXT
+//
+// The 'remount:' service streams its output until it's done, eg.
+//
+//	remount succeeded
+//	Not running as root. Try "adb root" first.
+//	remount failed
 func (c *Device) Remount() (string, error) {
-	conn, err := c.dialDevice(c.CmdTimeoutShort)
+	resp, err := c.runService("remount:", c.CmdTimeoutLong)
 	if err != nil {
-		return "", wrapClientError(err, c, "Remount")
+		return resp, wrapClientError(err, c, "Remount")
 	}
-	defer conn.Close()
 
-	resp, err := conn.RoundTripSingleResponse([]byte("remount"))
-	return string(resp), wrapClientError(err, c, "Remount")
+	msg := strings.TrimSpace(resp)
+	if strings.Contains(msg, "Not running as root") {
+		return resp, wrapClientError(fmt.Errorf("%w: %s", ErrNotRoot, msg), c, "Remount")
+	}
+	if strings.Contains(msg, "remount failed") || strings.Contains(msg, "failed to remount") {
+		return resp, wrapClientError(fmt.Errorf("remount failed: %s", msg), c, "Remount")
+	}
+	return resp, nil
 }
 
 func (c *Device) Stat(path string) (*wire.DirEntry, error) {
@@ -312,7 +352,21 @@ func (c *Device) NewSyncConn() (*wire.SyncConn, error) {
 	}
 
 	// FIXME: refactor in soon
-	return wire.NewSyncConn(conn.(*wire.Conn)), nil
+	syncConn := wire.NewSyncConn(conn.(*wire.Conn))
+	syncConn.SetRateLimiters(&c.rateLimiter, c.adbRateLimiter)
+	return syncConn, nil
+}
+
+// SetRateLimit limits the throughput of the sync transfers of c, in bytes per second,
+// 0 or less is unlimited. It can be changed during transfers, and adds up with the limit
+// of Adb.SetRateLimit. The transfers of exec:, like PushDirTar, are not limited.
+func (c *Device) SetRateLimit(bytesPerSecond int64) {
+	c.rateLimiter.SetLimit(bytesPerSecond)
+}
+
+// RateLimit returns the limit set by SetRateLimit.
+func (c *Device) RateLimit() int64 {
+	return c.rateLimiter.Limit()
 }
 
 // dialDevice switches the connection to communicate directly with the device
@@ -78,3 +78,17 @@ func (d DeviceDescriptor) getTransportDescriptor() string {
 		panic(fmt.Sprintf("invalid DeviceDescriptorType: %v", d.descriptorType))
 	}
 }
+
+// getWaitForTransport returns the <transport> part of host:wait-for-<transport>-<state>.
+func (d DeviceDescriptor) getWaitForTransport() string {
+	switch d.descriptorType {
+	case DeviceUsb:
+		return "usb"
+	case DeviceLocal:
+		return "local"
+	case DeviceAny, DeviceSerial:
+		return "any"
+	default:
+		panic(fmt.Sprintf("invalid DeviceDescriptorType: %v", d.descriptorType))
+	}
+}
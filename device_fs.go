@@ -0,0 +1,428 @@
+package adb
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prife/goadb/wire"
+)
+
+// DeviceFSMaxIdleConns is the number of idle sync connections kept by a DeviceFS.
+const DeviceFSMaxIdleConns = 4
+
+var (
+	errNotDir = errors.New("not a directory")
+	errIsDir  = errors.New("is a directory")
+	// errUnreadableDir is the error of a directory adbd can't list, which is not reported
+	// by LIST, it matches fs.ErrPermission.
+	errUnreadableDir = fmt.Errorf("unreadable directory: %w", fs.ErrPermission)
+)
+
+// DeviceFS is a read-only fs.FS of the device filesystem, over the sync protocol.
+// It implements fs.StatFS, fs.ReadDirFS and fs.ReadFileFS, so fs.WalkDir, fs.Glob,
+// template.ParseFS or http.FS can be used with a device:
+//
+//	fsys := device.FS("/sdcard")
+//	defer fsys.Close()
+//	fs.WalkDir(fsys, ".", func(path string, d fs.DirEntry, err error) error { ... })
+//
+// Sync connections are pooled, and reused between calls. Closing a file before reading it
+// to the end discards its connection, since the pending data can't be skipped.
+//
+// The sync protocol only has lstat: symlinks are reported as symlinks by ReadDir, like
+// os.ReadDir, and followed by Stat and Open only if they point to a directory.
+type DeviceFS struct {
+	device *Device
+	root   string
+
+	mu   sync.Mutex
+	idle []*wire.SyncConn
+}
+
+var (
+	_ fs.StatFS     = (*DeviceFS)(nil)
+	_ fs.ReadDirFS  = (*DeviceFS)(nil)
+	_ fs.ReadFileFS = (*DeviceFS)(nil)
+)
+
+// FS returns a DeviceFS rooted at the remote directory root, eg. "/sdcard".
+func (c *Device) FS(root string) *DeviceFS {
+	if root == "" {
+		root = "/"
+	}
+	return &DeviceFS{device: c, root: root}
+}
+
+// Close closes the idle connections.
+func (fsys *DeviceFS) Close() error {
+	fsys.mu.Lock()
+	defer fsys.mu.Unlock()
+	for _, conn := range fsys.idle {
+		conn.Close()
+	}
+	fsys.idle = nil
+	return nil
+}
+
+func (fsys *DeviceFS) getConn() (*wire.SyncConn, error) {
+	fsys.mu.Lock()
+	if n := len(fsys.idle); n > 0 {
+		conn := fsys.idle[n-1]
+		fsys.idle = fsys.idle[:n-1]
+		fsys.mu.Unlock()
+		return conn, nil
+	}
+	fsys.mu.Unlock()
+	return fsys.device.NewSyncConn()
+}
+
+// putConn returns conn to the pool, or closes it if err broke the connection.
+// adbd ends the sync session after a failed request, only a missing file is reported by a
+// successful STAT.
+func (fsys *DeviceFS) putConn(conn *wire.SyncConn, err error) {
+	if err != nil && !errors.Is(err, wire.ErrFileNoExist) && !errors.Is(err, errNotDir) && !errors.Is(err, errUnreadableDir) {
+		conn.Close()
+		return
+	}
+	fsys.mu.Lock()
+	defer fsys.mu.Unlock()
+	if len(fsys.idle) >= DeviceFSMaxIdleConns {
+		conn.Close()
+		return
+	}
+	fsys.idle = append(fsys.idle, conn)
+}
+
+// remotePath maps a name of fs.FS to the remote path.
+func (fsys *DeviceFS) remotePath(name string) string {
+	if name == "." {
+		return fsys.root
+	}
+	return path.Join(fsys.root, name)
+}
+
+func pathError(op, name string, err error) error {
+	switch {
+	case errors.Is(err, wire.ErrFileNoExist):
+		err = fs.ErrNotExist
+	case err != nil && strings.Contains(err.Error(), "Permission denied"):
+		err = fs.ErrPermission
+	}
+	return &fs.PathError{Op: op, Path: name, Err: err}
+}
+
+// stat returns the lstat of name, following symlinks to directories.
+func (fsys *DeviceFS) stat(conn *wire.SyncConn, name string) (*fileInfo, error) {
+	remote := fsys.remotePath(name)
+	entry, err := conn.Stat(remote)
+	if err != nil {
+		return nil, err
+	}
+	if entry.Mode&fs.ModeSymlink != 0 {
+		// lstat of "link/" resolves link if it points to a directory
+		if target, err := conn.Stat(remote + "/"); err == nil && target.Mode.IsDir() {
+			entry = target
+		}
+	}
+	return fsys.newFileInfo(path.Base(name), remote, entry), nil
+}
+
+// Stat implements fs.StatFS.
+func (fsys *DeviceFS) Stat(name string) (fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, pathError("stat", name, fs.ErrInvalid)
+	}
+	conn, err := fsys.getConn()
+	if err != nil {
+		return nil, pathError("stat", name, err)
+	}
+	info, err := fsys.stat(conn, name)
+	fsys.putConn(conn, err)
+	if err != nil {
+		return nil, pathError("stat", name, err)
+	}
+	return info, nil
+}
+
+// ReadDir implements fs.ReadDirFS, entries are sorted by name.
+func (fsys *DeviceFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, pathError("readdir", name, fs.ErrInvalid)
+	}
+	conn, err := fsys.getConn()
+	if err != nil {
+		return nil, pathError("readdir", name, err)
+	}
+	entries, err := fsys.readDir(conn, name)
+	fsys.putConn(conn, err)
+	if err != nil {
+		return nil, pathError("readdir", name, err)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+func (fsys *DeviceFS) readDir(conn *wire.SyncConn, name string) ([]fs.DirEntry, error) {
+	info, err := fsys.stat(conn, name)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, errNotDir
+	}
+
+	dr, err := conn.SendList(fsys.remotePath(name))
+	if err != nil {
+		return nil, err
+	}
+	list, err := dr.ReadDir(-1)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	// adbd sends no entry, not even "." and "..", for a directory it can't open
+	if len(list) == 0 {
+		return nil, errUnreadableDir
+	}
+	entries := make([]fs.DirEntry, 0, len(list))
+	for _, entry := range list {
+		if entry.Name == "." || entry.Name == ".." {
+			continue
+		}
+		entries = append(entries, fsys.newFileInfo(entry.Name, path.Join(fsys.remotePath(name), entry.Name), entry))
+	}
+	return entries, nil
+}
+
+// ReadFile implements fs.ReadFileFS.
+func (fsys *DeviceFS) ReadFile(name string) ([]byte, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return nil, pathError("read", name, errIsDir)
+	}
+	data := make([]byte, 0, syncSize(info))
+	for {
+		n, err := f.Read(data[len(data):cap(data)])
+		data = data[:len(data)+n]
+		if err == io.EOF {
+			return data, nil
+		} else if err != nil {
+			return nil, err
+		}
+		if len(data) == cap(data) {
+			data = append(data, 0)[:len(data)]
+		}
+	}
+}
+
+// Open implements fs.FS. Files are read with RECV on the first Read, directories with LIST
+// on the first ReadDir.
+func (fsys *DeviceFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, pathError("open", name, fs.ErrInvalid)
+	}
+	conn, err := fsys.getConn()
+	if err != nil {
+		return nil, pathError("open", name, err)
+	}
+	info, err := fsys.stat(conn, name)
+	if err != nil {
+		fsys.putConn(conn, err)
+		return nil, pathError("open", name, err)
+	}
+	if info.IsDir() {
+		fsys.putConn(conn, nil)
+		return &deviceDir{fsys: fsys, name: name, info: info}, nil
+	}
+	return &deviceFile{fsys: fsys, name: name, info: info, conn: conn}, nil
+}
+
+// deviceFile is an opened regular file, it owns conn until closed.
+type deviceFile struct {
+	fsys   *DeviceFS
+	name   string
+	info   *fileInfo
+	conn   *wire.SyncConn
+	reader *wire.SyncFileReader
+	eof    bool
+	err    error
+}
+
+func (f *deviceFile) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
+
+func (f *deviceFile) Read(b []byte) (int, error) {
+	if f.conn == nil {
+		return 0, pathError("read", f.name, fs.ErrClosed)
+	}
+	if f.eof {
+		return 0, io.EOF
+	}
+	if f.err != nil {
+		return 0, f.err
+	}
+	if f.reader == nil {
+		if f.reader, f.err = f.conn.Recv(f.fsys.remotePath(f.name)); f.err != nil {
+			f.err = pathError("read", f.name, f.err)
+			return 0, f.err
+		}
+	}
+
+	n, err := f.reader.Read(b)
+	if err == io.EOF {
+		f.eof = true
+	} else if err != nil {
+		f.err = pathError("read", f.name, err)
+		return n, f.err
+	}
+	return n, err
+}
+
+// Close returns the connection to the pool if the file has been read to the end, or not read at all.
+// A failed RECV ends the sync session, its connection is closed.
+func (f *deviceFile) Close() error {
+	if f.conn == nil {
+		return pathError("close", f.name, fs.ErrClosed)
+	}
+	if f.err == nil && (f.reader == nil || f.eof) {
+		f.fsys.putConn(f.conn, nil)
+	} else {
+		f.conn.Close()
+	}
+	f.conn = nil
+	return nil
+}
+
+// deviceDir is an opened directory.
+type deviceDir struct {
+	fsys    *DeviceFS
+	name    string
+	info    *fileInfo
+	entries []fs.DirEntry
+	listed  bool
+	closed  bool
+}
+
+func (d *deviceDir) Stat() (fs.FileInfo, error) {
+	return d.info, nil
+}
+
+func (d *deviceDir) Read([]byte) (int, error) {
+	return 0, pathError("read", d.name, errIsDir)
+}
+
+func (d *deviceDir) Close() error {
+	if d.closed {
+		return pathError("close", d.name, fs.ErrClosed)
+	}
+	d.closed = true
+	return nil
+}
+
+// ReadDir implements fs.ReadDirFile.
+func (d *deviceDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if d.closed {
+		return nil, pathError("readdir", d.name, fs.ErrClosed)
+	}
+	if !d.listed {
+		entries, err := d.fsys.ReadDir(d.name)
+		if err != nil {
+			return nil, err
+		}
+		d.entries, d.listed = entries, true
+	}
+
+	if n <= 0 {
+		entries := d.entries
+		d.entries = nil
+		return entries, nil
+	}
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(d.entries) {
+		n = len(d.entries)
+	}
+	entries := d.entries[:n]
+	d.entries = d.entries[n:]
+	return entries, nil
+}
+
+// fileInfo implements fs.FileInfo and fs.DirEntry for a wire.DirEntry.
+type fileInfo struct {
+	name   string
+	entry  *wire.DirEntry
+	fsys   *DeviceFS
+	remote string
+
+	sizeOnce sync.Once
+	size     int64
+}
+
+func (fsys *DeviceFS) newFileInfo(name, remote string, entry *wire.DirEntry) *fileInfo {
+	return &fileInfo{name: name, entry: entry, fsys: fsys, remote: remote}
+}
+
+func (fi *fileInfo) Name() string { return fi.name }
+
+// Size is sent as 32 bits by LIST and STAT, so the size of a regular file is asked again
+// on the first call, see remoteSize. If that fails, sizes over 4GB are truncated.
+func (fi *fileInfo) Size() int64 {
+	fi.sizeOnce.Do(func() {
+		fi.size = int64(uint32(fi.entry.Size))
+		if fi.entry.Mode.IsRegular() {
+			if size, err := fi.fsys.remoteSize(fi.remote); err == nil {
+				fi.size = size
+			}
+		}
+	})
+	return fi.size
+}
+
+// remoteSize returns the 64-bit size of remote, not following symlinks: by LST2 if the
+// device has FeatureStat2, from Android 8, in a single sync round trip, else by stat(1).
+func (fsys *DeviceFS) remoteSize(remote string) (int64, error) {
+	if !fsys.device.hasFeature(FeatureStat2) {
+		size, _, _, err := fsys.device.remoteFileStat(remote)
+		return size, err
+	}
+	conn, err := fsys.getConn()
+	if err != nil {
+		return 0, err
+	}
+	_, size, err := conn.LstatV2(remote)
+	fsys.putConn(conn, err)
+	return size, err
+}
+
+// syncSize returns the size of info without the round trip of fileInfo.Size, for comparisons
+// and progress: the entries of DeviceFS are truncated to 32 bits.
+func syncSize(info fs.FileInfo) int64 {
+	if fi, ok := info.(*fileInfo); ok {
+		return int64(uint32(fi.entry.Size))
+	}
+	return info.Size()
+}
+
+func (fi *fileInfo) Mode() fs.FileMode          { return fi.entry.Mode }
+func (fi *fileInfo) ModTime() time.Time         { return fi.entry.ModifiedAt }
+func (fi *fileInfo) IsDir() bool                { return fi.entry.Mode.IsDir() }
+func (fi *fileInfo) Sys() any                   { return fi.entry }
+func (fi *fileInfo) Type() fs.FileMode          { return fi.entry.Mode.Type() }
+func (fi *fileInfo) Info() (fs.FileInfo, error) { return fi, nil }
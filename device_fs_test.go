@@ -0,0 +1,153 @@
+package adb
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/prife/goadb/wire"
+	"github.com/stretchr/testify/assert"
+)
+
+var someMtime = time.Date(2023, 11, 14, 10, 20, 30, 0, time.UTC)
+
+func TestDeviceFS(t *testing.T) {
+	f := newFakeDevice(t)
+	f.WriteFile(t, "sdcard/a.txt", "hello", someMtime)
+	f.WriteFile(t, "sdcard/dir/b.txt", strings.Repeat("x", 100*1024), someMtime)
+	f.WriteFile(t, "sdcard/dir/sub/c.log", "", someMtime)
+	assert.NoError(t, os.Mkdir(f.local("sdcard/empty"), 0755))
+
+	fsys := f.Device().FS("/sdcard")
+	defer fsys.Close()
+	assert.NoError(t, fstest.TestFS(fsys, "a.txt", "dir/b.txt", "dir/sub/c.log", "empty"))
+
+	data, err := fsys.ReadFile("dir/b.txt")
+	assert.NoError(t, err)
+	assert.Len(t, data, 100*1024)
+
+	info, err := fsys.Stat("a.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), info.Size())
+	assert.Equal(t, someMtime, info.ModTime().UTC())
+
+	matches, err := fs.Glob(fsys, "dir/*.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"dir/b.txt"}, matches)
+
+	_, err = fsys.Stat("missing")
+	assert.True(t, errors.Is(err, fs.ErrNotExist))
+	_, err = fsys.Open("../etc")
+	assert.True(t, errors.Is(err, fs.ErrInvalid))
+}
+
+func TestDeviceFS_PooledConn(t *testing.T) {
+	f := newFakeDevice(t)
+	f.WriteFile(t, "data/a.txt", "hello", someMtime)
+	fsys := f.Device().FS("/data")
+	defer fsys.Close()
+
+	for i := 0; i < 3; i++ {
+		_, err := fsys.ReadFile("a.txt")
+		assert.NoError(t, err)
+		_, err = fsys.ReadDir(".")
+		assert.NoError(t, err)
+	}
+	// a partially read file can't return its conn
+	file, err := fsys.Open("a.txt")
+	assert.NoError(t, err)
+	_, err = io.ReadFull(file, make([]byte, 1))
+	assert.NoError(t, err)
+	assert.NoError(t, file.Close())
+	_, err = fsys.Stat("a.txt")
+	assert.NoError(t, err)
+
+	var dials int
+	for _, service := range f.Services() {
+		if service == "sync:" {
+			dials++
+		}
+	}
+	assert.Equal(t, 2, dials)
+}
+
+func TestDeviceFS_LargeSize(t *testing.T) {
+	f := newFakeDevice(t)
+	f.WriteFile(t, "data/big.img", "truncated", someMtime)
+	f.Service = func(service string, conn *wire.Conn) {
+		if strings.HasPrefix(service, "shell:stat -c ") {
+			fmt.Fprintf(conn, "5000000000 %d 644\n%s0\n", someMtime.Unix(), exitStatusMarker)
+		}
+	}
+	fsys := f.Device().FS("/data")
+	defer fsys.Close()
+
+	info, err := fsys.Stat("big.img")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5000000000), info.Size())
+	entries, err := fsys.ReadDir(".")
+	assert.NoError(t, err)
+	info, err = entries[0].Info()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5000000000), info.Size())
+	assert.Contains(t, f.Services(), "shell:stat -c '%s %Y %a' '/data/big.img'; echo exit-status:$?")
+}
+
+func TestDeviceFS_LargeSizeStat2(t *testing.T) {
+	f := newFakeDevice(t)
+	f.Features = "shell_v2,stat_v2"
+	f.WriteFile(t, "data/big.img", "", someMtime)
+	assert.NoError(t, os.Truncate(f.local("data/big.img"), 5000000000))
+	fsys := f.Device().FS("/data")
+	defer fsys.Close()
+
+	entries, err := fsys.ReadDir(".")
+	assert.NoError(t, err)
+	for _, entry := range entries {
+		info, err := entry.Info()
+		assert.NoError(t, err)
+		assert.Equal(t, int64(5000000000), info.Size())
+	}
+	// by LST2, on a pooled sync conn, without stat(1)
+	services := f.Services()
+	assert.Contains(t, services, "sync:LST2 /data/big.img")
+	var dials int
+	for _, service := range services {
+		assert.False(t, strings.HasPrefix(service, "shell:"), service)
+		if service == "sync:" {
+			dials++
+		}
+	}
+	assert.Equal(t, 1, dials)
+}
+
+func TestDeviceFS_FailedRecv(t *testing.T) {
+	f := newFakeDevice(t)
+	f.WriteFile(t, "data/a.txt", "hello", someMtime)
+	fsys := f.Device().FS("/data")
+	defer fsys.Close()
+
+	file, err := fsys.Open("a.txt")
+	assert.NoError(t, err)
+	assert.NoError(t, os.Remove(f.local("data/a.txt")))
+	_, err = file.Read(make([]byte, 1))
+	assert.Error(t, err)
+	assert.NoError(t, file.Close())
+
+	// the conn of the failed RECV was not pooled
+	_, err = fsys.Stat(".")
+	assert.NoError(t, err)
+	var dials int
+	for _, service := range f.Services() {
+		if service == "sync:" {
+			dials++
+		}
+	}
+	assert.Equal(t, 2, dials)
+}
@@ -15,6 +15,8 @@ type DeviceInfo struct {
 	Serial string
 
 	State string
+	// Help text adb appends to the state, only set for 'no permissions' devices.
+	StateReason string
 	// Product, device, and model are not set in the short form.
 	Product     string
 	Model       string
@@ -30,6 +32,12 @@ func (d *DeviceInfo) IsUsb() bool {
 	return d.Usb != ""
 }
 
+// DeviceState parses State, it returns StateInvalid if the state is unknown.
+func (d *DeviceInfo) DeviceState() DeviceState {
+	state, _ := parseDeviceState(d.State)
+	return state
+}
+
 func newDevice(serial, state string, attrs map[string]string) (*DeviceInfo, error) {
 	if serial == "" {
 		return nil, fmt.Errorf("%w: device serial cannot be blank", wire.ErrAssertion)
@@ -44,9 +52,15 @@ func newDevice(serial, state string, attrs map[string]string) (*DeviceInfo, erro
 		}
 	}
 
+	var reason string
+	if s, r, err := parseDeviceStateReason(state); err == nil && s == StateNoPermissions {
+		state, reason = stateNoPermissions, r
+	}
+
 	return &DeviceInfo{
 		Serial:      serial,
 		State:       state,
+		StateReason: reason,
 		Product:     attrs["product"],
 		Model:       attrs["model"],
 		DeviceInfo:  attrs["device"],
@@ -70,8 +84,12 @@ func parseDeviceList(list string, lineParseFunc func(string) (*DeviceInfo, error
 	return devices, nil
 }
 
+// parseDeviceShort parses a 'serial\tstate' line, the state may contain spaces, eg. 'no permissions (...)'
 func parseDeviceShort(line string) (*DeviceInfo, error) {
-	fields := strings.Fields(line)
+	fields := strings.SplitN(strings.TrimSpace(line), "\t", 2)
+	if len(fields) != 2 {
+		fields = strings.Fields(line)
+	}
 	if len(fields) != 2 {
 		return nil, fmt.Errorf("%w: malformed device line, expected 2 fields but found %d", wire.ErrParse, len(fields))
 	}
@@ -110,14 +128,12 @@ func parseDeviceLongE(line string) (*DeviceInfo, error) {
 		return nil, invalidErr
 	}
 
-	// Read state
-	state, err := readBuff(buf, true)
-	if err != nil {
-		return nil, invalidErr
-	}
-	if _, err = readBuff(buf, false); err != nil {
+	// Read state, 'no permissions (...); see [...]' contains spaces
+	state, remain := splitDeviceState(buf.String())
+	if remain == "" {
 		return nil, invalidErr
 	}
+	buf = bytes.NewBufferString(remain)
 
 	// Read attributes
 	attrs := map[string]string{}
@@ -145,7 +161,7 @@ func parseDeviceLongE(line string) (*DeviceInfo, error) {
 		// get the next key
 		key = string(rbuf[bi+1 : len(rbuf)-1])
 	}
-	return newDevice(string(serial), string(state), attrs)
+	return newDevice(string(serial), state, attrs)
 }
 
 func parseDeviceLong(line string) (*DeviceInfo, error) {
@@ -24,6 +24,14 @@ func TestParseDeviceShort(t *testing.T) {
 		State:  "device"}, dev)
 }
 
+func TestParseDeviceShortNoPermissions(t *testing.T) {
+	dev, err := parseDeviceShort("0123456789ABCDEF\tno permissions (missing udev rules? user is in the plugdev group); see [http://developer.android.com/tools/device.html]\n")
+	assert.NoError(t, err)
+	assert.Equal(t, "0123456789ABCDEF", dev.Serial)
+	assert.Equal(t, "no permissions", dev.State)
+	assert.Equal(t, StateNoPermissions, dev.DeviceState())
+}
+
 func TestParseDeviceLong(t *testing.T) {
 	dev, err := parseDeviceLong("SERIAL    device product:PRODUCT model:MODEL device:DEVICE\n")
 	assert.NoError(t, err)
@@ -111,6 +119,26 @@ func Test_parseDeviceLongE(t *testing.T) {
 				TransportID: 24,
 			},
 		},
+		{
+			"0123456789ABCDEF       no permissions (missing udev rules? user is in the plugdev group); see [http://developer.android.com/tools/device.html] usb:3-1 transport_id:2", &DeviceInfo{
+				Serial:      "0123456789ABCDEF",
+				State:       "no permissions",
+				StateReason: "(missing udev rules? user is in the plugdev group); see [http://developer.android.com/tools/device.html]",
+				Usb:         "3-1",
+				TransportID: 2,
+			},
+		},
+		{
+			"R58M12345    sideload usb:1-2 product:PRODUCT model:MODEL device:DEVICE transport_id:5", &DeviceInfo{
+				Serial:      "R58M12345",
+				State:       "sideload",
+				Usb:         "1-2",
+				Product:     "PRODUCT",
+				Model:       "MODEL",
+				DeviceInfo:  "DEVICE",
+				TransportID: 5,
+			},
+		},
 	}
 
 	for _, tt := range tests {
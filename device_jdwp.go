@@ -0,0 +1,97 @@
+package adb
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prife/goadb/jdwp"
+	"github.com/prife/goadb/wire"
+)
+
+// TrackJdwp streams the pids of the processes with a JDWP transport, ie. debuggable apps,
+// with the 'track-jdwp' service, like `adb track-jdwp`.
+// handler is called with the full list of pids each time it changes, the first call is
+// the current list. It blocks until ctx is done or the connection fails.
+func (c *Device) TrackJdwp(ctx context.Context, handler func(pids []int)) error {
+	conn, err := c.dialDevice(c.CmdTimeoutShort)
+	if err != nil {
+		return wrapClientError(err, c, "TrackJdwp")
+	}
+	defer conn.Close()
+
+	if err = conn.SendMessage([]byte("track-jdwp")); err != nil {
+		return wrapClientError(err, c, "TrackJdwp")
+	}
+	if _, err = readStatusWithTimeout(conn, "track-jdwp", c.CmdTimeoutShort); err != nil {
+		return wrapClientError(err, c, "TrackJdwp")
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	for {
+		msg, err := conn.ReadMessage()
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return wrapClientError(err, c, "TrackJdwp")
+		}
+		pids, err := parseJdwpPids(string(msg))
+		if err != nil {
+			return wrapClientError(err, c, "TrackJdwp")
+		}
+		handler(pids)
+	}
+}
+
+// parseJdwpPids parses the pids separated by newlines.
+func parseJdwpPids(msg string) ([]int, error) {
+	pids := []int{}
+	for _, line := range strings.Fields(msg) {
+		pid, err := strconv.Atoi(line)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid jdwp pid '%s'", wire.ErrParse, line)
+		}
+		pids = append(pids, pid)
+	}
+	return pids, nil
+}
+
+// ConnectJdwp connects to the JDWP transport of the process pid, and does the JDWP handshake.
+// The returned conn can be passed to jdwp.NewClient, or forwarded to a debugger.
+// Only one debugger can be attached to a process at a time.
+func (c *Device) ConnectJdwp(pid int) (net.Conn, error) {
+	conn, err := c.dialDevice(c.CmdTimeoutShort)
+	if err != nil {
+		return nil, wrapClientError(err, c, "ConnectJdwp(%d)", pid)
+	}
+
+	req := fmt.Sprintf("jdwp:%d", pid)
+	if err = conn.SendMessage([]byte(req)); err != nil {
+		conn.Close()
+		return nil, wrapClientError(err, c, "ConnectJdwp(%d)", pid)
+	}
+	if _, err = readStatusWithTimeout(conn, req, c.CmdTimeoutShort); err != nil {
+		conn.Close()
+		return nil, wrapClientError(err, c, "ConnectJdwp(%d)", pid)
+	}
+	conn.SetDeadline(time.Now().Add(c.CmdTimeoutShort))
+	if err = jdwp.Handshake(conn); err != nil {
+		conn.Close()
+		return nil, wrapClientError(err, c, "ConnectJdwp(%d)", pid)
+	}
+	conn.SetDeadline(time.Time{})
+	return conn, nil
+}
@@ -0,0 +1,55 @@
+package adb
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/prife/goadb/jdwp"
+	"github.com/prife/goadb/wire"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDevice_TrackJdwp(t *testing.T) {
+	s := &MockServer{
+		Status:   wire.StatusSuccess,
+		Messages: []string{"1234\n", "1234\n5678\n", ""},
+	}
+	d := (&Adb{server: s}).Device(DeviceWithSerial("serial"))
+
+	var updates [][]int
+	err := d.TrackJdwp(context.Background(), func(pids []int) {
+		updates = append(updates, pids)
+	})
+	assert.ErrorIs(t, err, io.EOF)
+	assert.Equal(t, []string{"host:transport:serial", "track-jdwp"}, s.Requests)
+	assert.Equal(t, [][]int{{1234}, {1234, 5678}, {}}, updates)
+}
+
+func TestDevice_ConnectJdwp(t *testing.T) {
+	services := make(chan string, 1)
+	s := &pipeServer{handler: func(conn *wire.Conn) {
+		service, err := acceptTransport(conn)
+		if err != nil {
+			return
+		}
+		services <- service
+		handshake := make([]byte, len(jdwp.HandshakeString))
+		if _, err = io.ReadFull(conn, handshake); err != nil {
+			return
+		}
+		conn.Write(handshake)
+		conn.Write([]byte("ready"))
+	}}
+	d := (&Adb{server: s}).Device(DeviceWithSerial("serial"))
+
+	conn, err := d.ConnectJdwp(1234)
+	assert.NoError(t, err)
+	defer conn.Close()
+	assert.Equal(t, "jdwp:1234", <-services)
+
+	buf := make([]byte, 5)
+	_, err = io.ReadFull(conn, buf)
+	assert.NoError(t, err)
+	assert.Equal(t, "ready", string(buf))
+}
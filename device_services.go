@@ -0,0 +1,322 @@
+package adb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrRootNotAllowed adbd refused to restart as root, eg. on production builds.
+	ErrRootNotAllowed = errors.New("RootNotAllowed")
+	// ErrNotRoot the service needs adbd running as root, see Root.
+	ErrNotRoot = errors.New("NotRoot")
+	// ErrVerityNotAllowed dm-verity can't be changed on this build, eg. user builds or locked bootloader.
+	ErrVerityNotAllowed = errors.New("VerityNotAllowed")
+)
+
+// RebootTarget is the mode the device should reboot into, see `adb reboot [bootloader|recovery|sideload|sideload-auto-reboot|fastboot]`
+type RebootTarget string
+
+const (
+	RebootSystem             RebootTarget = ""
+	RebootBootloader         RebootTarget = "bootloader"
+	RebootRecovery           RebootTarget = "recovery"
+	RebootSideload           RebootTarget = "sideload"
+	RebootSideloadAutoReboot RebootTarget = "sideload-auto-reboot"
+	RebootFastboot           RebootTarget = "fastboot"
+)
+
+// waitState returns the state passed to the wait-for service once the device
+// has rebooted into target.
+// bootloader and fastbootd are not adb transports, so we can only wait the device leaving.
+func (t RebootTarget) waitState() string {
+	switch t {
+	case RebootSystem:
+		return "device"
+	case RebootRecovery:
+		return "recovery"
+	case RebootSideload, RebootSideloadAutoReboot:
+		return "sideload"
+	default:
+		return "disconnect"
+	}
+}
+
+// runService opens a device service, eg. 'root:', 'remount:', and reads its output until the stream is closed.
+func (c *Device) runService(service string, timeout time.Duration) (string, error) {
+	conn, err := c.dialDevice(c.CmdTimeoutShort)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	if err = conn.SendMessage([]byte(service)); err != nil {
+		return "", err
+	}
+	if _, err = readStatusWithTimeout(conn, service, c.CmdTimeoutShort); err != nil {
+		return "", err
+	}
+
+	if err = conn.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+		return "", err
+	}
+	resp, err := conn.ReadUntilEof()
+	return string(resp), err
+}
+
+// waitFor blocks until the device reaches state, with the host service:
+//
+//	<host-prefix>:wait-for-<transport>-<state>
+//
+// state is one of "device", "recovery", "rescue", "sideload", "bootloader" or "disconnect".
+// The server replies OKAY once the request is accepted, and a second OKAY when the state is reached.
+func (c *Device) waitFor(ctx context.Context, state string) error {
+	conn, err := c.server.Dial()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	req := fmt.Sprintf("%s:wait-for-%s-%s", c.descriptor.getHostPrefix(), c.descriptor.getWaitForTransport(), state)
+	if err = conn.SendMessage([]byte(req)); err != nil {
+		return err
+	}
+
+	// the server never times out a wait-for request, close conn to abort it
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	for i := 0; i < 2; i++ {
+		if _, err = conn.ReadStatus(req); err != nil {
+			if ctx.Err() != nil {
+				return fmt.Errorf("'%s' failed: %w", req, ctx.Err())
+			}
+			return fmt.Errorf("'%s' failed: %w", req, err)
+		}
+	}
+	return nil
+}
+
+// WaitForDevice blocks until the device is online, like `adb wait-for-device`.
+func (c *Device) WaitForDevice(ctx context.Context) error {
+	return wrapClientError(c.waitFor(ctx, "device"), c, "WaitForDevice")
+}
+
+// WaitForDisconnect blocks until the device is gone, like `adb wait-for-disconnect`.
+func (c *Device) WaitForDisconnect(ctx context.Context) error {
+	return wrapClientError(c.waitFor(ctx, "disconnect"), c, "WaitForDisconnect")
+}
+
+// Reconnect kicks the transport from the host side, the server reconnects it, like `adb reconnect`.
+func (c *Device) Reconnect() error {
+	_, err := c.getAttribute("reconnect")
+	return wrapClientError(err, c, "Reconnect")
+}
+
+// ReconnectDevice asks adbd to kick the transport from the device side, like `adb reconnect device`.
+func (c *Device) ReconnectDevice() error {
+	_, err := c.sendService("reconnect")
+	return wrapClientError(err, c, "ReconnectDevice")
+}
+
+// adbdDisconnectTimeout bounds the wait for adbd going away, which is missed if adbd came
+// back before wait-for-disconnect was issued.
+var adbdDisconnectTimeout = 5 * time.Second
+
+// waitAdbdRestart waits the device go away and come back after adbd restarted itself.
+func (c *Device) waitAdbdRestart(ctx context.Context) error {
+	dctx, cancel := context.WithTimeout(ctx, adbdDisconnectTimeout)
+	defer cancel()
+	err := c.waitFor(dctx, "disconnect")
+	// no disconnect seen, adbd may be back already: wait-for-device tells
+	if err != nil && (ctx.Err() != nil || !errors.Is(err, context.DeadlineExceeded)) {
+		return err
+	}
+	return c.waitFor(ctx, "device")
+}
+
+// Root restarts adbd with root permissions, like `adb root`.
+// It returns after adbd has come back, or immediately if adbd is already running as root.
+//
+// Possible responses of 'root:' service:
+//
+//	adbd is already running as root
+//	restarting adbd as root
+//	adbd cannot run as root in production builds
+//	root access is disabled by system setting - enable in settings -> development options
+func (c *Device) Root(ctx context.Context) error {
+	resp, err := c.runService("root:", c.CmdTimeoutLong)
+	if err != nil {
+		return wrapClientError(err, c, "Root")
+	}
+
+	restart, err := parseRootResponse(resp)
+	if err != nil {
+		return wrapClientError(err, c, "Root")
+	}
+	if restart {
+		return wrapClientError(c.waitAdbdRestart(ctx), c, "Root")
+	}
+	return nil
+}
+
+// Unroot restarts adbd without root permissions, like `adb unroot`.
+//
+// Possible responses of 'unroot:' service:
+//
+//	adbd not running as root
+//	restarting adbd as non root
+func (c *Device) Unroot(ctx context.Context) error {
+	resp, err := c.runService("unroot:", c.CmdTimeoutLong)
+	if err != nil {
+		return wrapClientError(err, c, "Unroot")
+	}
+
+	restart, err := parseRootResponse(resp)
+	if err != nil {
+		return wrapClientError(err, c, "Unroot")
+	}
+	if restart {
+		return wrapClientError(c.waitAdbdRestart(ctx), c, "Unroot")
+	}
+	return nil
+}
+
+// parseRootResponse reports whether adbd is restarting, or an error if the request was refused.
+func parseRootResponse(resp string) (restart bool, err error) {
+	msg := strings.TrimSpace(resp)
+	switch {
+	case strings.HasPrefix(msg, "restarting adbd"):
+		return true, nil
+	case strings.Contains(msg, "already running as root"),
+		strings.Contains(msg, "not running as root"):
+		return false, nil
+	case strings.Contains(msg, "cannot run as root"),
+		strings.Contains(msg, "root access is disabled"):
+		return false, fmt.Errorf("%w: %s", ErrRootNotAllowed, msg)
+	default:
+		return false, fmt.Errorf("unexpected response: %s", msg)
+	}
+}
+
+// DisableVerity disables dm-verity checking on userdebug builds, like `adb disable-verity`.
+// rebootRequired is true when the change only takes effect after a reboot.
+func (c *Device) DisableVerity() (rebootRequired bool, err error) {
+	resp, err := c.runService("disable-verity:", c.CmdTimeoutLong)
+	if err != nil {
+		return false, wrapClientError(err, c, "DisableVerity")
+	}
+	rebootRequired, err = parseVerityResponse(resp)
+	return rebootRequired, wrapClientError(err, c, "DisableVerity")
+}
+
+// EnableVerity re-enables dm-verity checking on userdebug builds, like `adb enable-verity`.
+func (c *Device) EnableVerity() (rebootRequired bool, err error) {
+	resp, err := c.runService("enable-verity:", c.CmdTimeoutLong)
+	if err != nil {
+		return false, wrapClientError(err, c, "EnableVerity")
+	}
+	rebootRequired, err = parseVerityResponse(resp)
+	return rebootRequired, wrapClientError(err, c, "EnableVerity")
+}
+
+// parseVerityResponse
+//
+// Android 9:
+//
+//	Verity disabled on /system
+//	Now reboot your device for settings to take effect
+//
+// Android 10+:
+//
+//	Successfully disabled verification
+//	Reboot the device for new settings to take effect
+//
+// Failures:
+//
+//	verity cannot be disabled/enabled - USER build
+//	disable-verity only works for userdebug builds
+//	Device must be bootloader unlocked
+func parseVerityResponse(resp string) (rebootRequired bool, err error) {
+	msg := strings.TrimSpace(resp)
+	lower := strings.ToLower(msg)
+	switch {
+	case strings.Contains(lower, "user build"),
+		strings.Contains(lower, "only works for userdebug"),
+		strings.Contains(lower, "bootloader unlocked"):
+		return false, fmt.Errorf("%w: %s", ErrVerityNotAllowed, msg)
+	case strings.Contains(lower, "reboot"):
+		return true, nil
+	case strings.Contains(lower, "already"):
+		return false, nil
+	case strings.Contains(lower, "failed"), strings.Contains(lower, "error"):
+		return false, fmt.Errorf("verity failed: %s", msg)
+	default:
+		return false, nil
+	}
+}
+
+// RebootTo reboots the device into target with the 'reboot:<target>' service, like `adb reboot <target>`.
+// It waits until the device shows up again in the matching state (device, recovery or sideload).
+// For bootloader and fastboot, it waits until the device has left adb.
+func (c *Device) RebootTo(ctx context.Context, target RebootTarget) error {
+	if err := c.triggerReboot(target); err != nil {
+		return wrapClientError(err, c, "Reboot(%s)", target)
+	}
+
+	if err := c.waitFor(ctx, "disconnect"); err != nil {
+		return wrapClientError(err, c, "Reboot(%s)", target)
+	}
+	if state := target.waitState(); state != "disconnect" {
+		return wrapClientError(c.waitFor(ctx, state), c, "Reboot(%s)", target)
+	}
+	return nil
+}
+
+// triggerReboot sends 'reboot:<target>'.
+// adbd closes the stream without output when the reboot is accepted,
+// the caller confirms the reboot by waiting the device to disconnect.
+func (c *Device) triggerReboot(target RebootTarget) error {
+	resp, err := c.sendService("reboot:" + string(target))
+	if err != nil {
+		return err
+	}
+	if msg := strings.TrimSpace(resp); msg != "" {
+		return fmt.Errorf("reboot failed: %s", msg)
+	}
+	return nil
+}
+
+// sendService opens a device service which makes adbd drop the transport, eg. 'reboot:', 'reconnect'.
+// The transport may be torn down before the stream is closed, so errors reading the
+// output are ignored once the service is accepted.
+func (c *Device) sendService(service string) (string, error) {
+	conn, err := c.dialDevice(c.CmdTimeoutShort)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	if err = conn.SendMessage([]byte(service)); err != nil {
+		return "", err
+	}
+	if _, err = readStatusWithTimeout(conn, service, c.CmdTimeoutShort); err != nil {
+		return "", err
+	}
+
+	if err = conn.SetReadDeadline(time.Now().Add(c.CmdTimeoutShort)); err != nil {
+		return "", err
+	}
+	resp, _ := conn.ReadUntilEof()
+	return string(resp), nil
+}
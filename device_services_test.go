@@ -0,0 +1,185 @@
+package adb
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prife/goadb/wire"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRootResponse(t *testing.T) {
+	for _, test := range []struct {
+		Resp        string
+		WantRestart bool
+		WantErr     error
+	}{
+		{"restarting adbd as root\n", true, nil},
+		{"restarting adbd as non root\n", true, nil},
+		{"adbd is already running as root\n", false, nil},
+		{"adbd not running as root\n", false, nil},
+		{"adbd cannot run as root in production builds\n", false, ErrRootNotAllowed},
+		{"root access is disabled by system setting - enable in settings -> development options\n", false, ErrRootNotAllowed},
+	} {
+		restart, err := parseRootResponse(test.Resp)
+		assert.Equal(t, test.WantRestart, restart, test.Resp)
+		if test.WantErr == nil {
+			assert.NoError(t, err)
+		} else {
+			assert.True(t, errors.Is(err, test.WantErr), test.Resp)
+		}
+	}
+}
+
+func TestParseVerityResponse(t *testing.T) {
+	reboot, err := parseVerityResponse("Verity disabled on /system\nNow reboot your device for settings to take effect\n")
+	assert.NoError(t, err)
+	assert.True(t, reboot)
+
+	reboot, err = parseVerityResponse("Successfully disabled verification\nReboot the device for new settings to take effect\n")
+	assert.NoError(t, err)
+	assert.True(t, reboot)
+
+	_, err = parseVerityResponse("verity cannot be disabled/enabled - USER build\n")
+	assert.True(t, errors.Is(err, ErrVerityNotAllowed))
+}
+
+func TestDevice_RootAlreadyRoot(t *testing.T) {
+	s := &MockServer{
+		Status:   wire.StatusSuccess,
+		Messages: []string{"adbd is already running as root\n"},
+	}
+	d := (&Adb{server: s}).Device(DeviceWithSerial("serial"))
+
+	err := d.Root(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"host:transport:serial", "root:"}, s.Requests)
+}
+
+func TestDevice_RootRestarting(t *testing.T) {
+	s := &MockServer{
+		Status:   wire.StatusSuccess,
+		Messages: []string{"restarting adbd as root\n"},
+	}
+	d := (&Adb{server: s}).Device(DeviceWithSerial("serial"))
+
+	err := d.Root(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"host:transport:serial",
+		"root:",
+		"host-serial:serial:wait-for-any-disconnect",
+		"host-serial:serial:wait-for-any-device",
+	}, s.Requests)
+}
+
+func TestDevice_RootRestartedEarly(t *testing.T) {
+	defer func(timeout time.Duration) { adbdDisconnectTimeout = timeout }(adbdDisconnectTimeout)
+	adbdDisconnectTimeout = 20 * time.Millisecond
+
+	var requests []string
+	var mu sync.Mutex
+	s := &pipeServer{handler: func(conn *wire.Conn) {
+		for {
+			msg, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			requests = append(requests, string(msg))
+			mu.Unlock()
+			conn.Write([]byte(wire.StatusSuccess))
+			switch {
+			case string(msg) == "root:":
+				conn.Write([]byte("restarting adbd as root\n"))
+				return
+			case strings.HasSuffix(string(msg), "-disconnect"):
+				// adbd is back already, the disconnect is never seen
+				conn.ReadUntilEof()
+				return
+			case strings.HasSuffix(string(msg), "-device"):
+				conn.Write([]byte(wire.StatusSuccess))
+				return
+			}
+		}
+	}}
+	d := (&Adb{server: s}).Device(DeviceWithSerial("serial"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	assert.NoError(t, d.Root(ctx))
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, "host-serial:serial:wait-for-any-device", requests[len(requests)-1])
+}
+
+func TestDevice_RemountNotRoot(t *testing.T) {
+	s := &MockServer{
+		Status:   wire.StatusSuccess,
+		Messages: []string{"Not running as root. Try \"adb root\" first.\n"},
+	}
+	_, err := (&Adb{server: s}).Device(DeviceWithSerial("serial")).Remount()
+	assert.ErrorIs(t, err, ErrNotRoot)
+	assert.NotErrorIs(t, err, ErrRootNotAllowed)
+}
+
+func TestDevice_RebootTo(t *testing.T) {
+	s := &MockServer{
+		Status: wire.StatusSuccess,
+	}
+	d := (&Adb{server: s}).Device(AnyUsbDevice())
+
+	err := d.RebootTo(context.Background(), RebootSideload)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"host:transport-usb",
+		"reboot:sideload",
+		"host-usb:wait-for-usb-disconnect",
+		"host-usb:wait-for-usb-sideload",
+	}, s.Requests)
+}
+
+func TestDevice_RebootToFailed(t *testing.T) {
+	s := &MockServer{
+		Status:   wire.StatusSuccess,
+		Messages: []string{"reboot failed: Operation not permitted\n"},
+	}
+	d := (&Adb{server: s}).Device(AnyDevice())
+
+	err := d.RebootTo(context.Background(), RebootBootloader)
+	assert.ErrorContains(t, err, "Operation not permitted")
+	assert.Equal(t, []string{"host:transport-any", "reboot:bootloader"}, s.Requests)
+}
+
+func TestAdb_ReconnectOffline(t *testing.T) {
+	s := &MockServer{
+		Status:   wire.StatusSuccess,
+		Messages: []string{"reconnecting serial [offline]\n"},
+	}
+	assert.NoError(t, (&Adb{server: s}).ReconnectOffline())
+	assert.Equal(t, []string{"host:reconnect-offline"}, s.Requests)
+}
+
+func TestDevice_Reconnect(t *testing.T) {
+	s := &MockServer{
+		Status:   wire.StatusSuccess,
+		Messages: []string{"done"},
+	}
+	d := (&Adb{server: s}).Device(DeviceWithSerial("serial"))
+	assert.NoError(t, d.Reconnect())
+	assert.Equal(t, []string{"host-serial:serial:reconnect"}, s.Requests)
+}
+
+func TestDevice_ReconnectDevice(t *testing.T) {
+	s := &MockServer{
+		Status:   wire.StatusSuccess,
+		Messages: []string{"done"},
+	}
+	d := (&Adb{server: s}).Device(DeviceWithSerial("serial"))
+	assert.NoError(t, d.ReconnectDevice())
+	assert.Equal(t, []string{"host:transport:serial", "reconnect"}, s.Requests)
+}
@@ -2,15 +2,19 @@ package adb
 
 import (
 	"fmt"
+	"regexp"
+	"strings"
 
 	"github.com/prife/goadb/wire"
 )
 
-// DeviceState represents one of the 3 possible states adb will report devices.
+// DeviceState represents one of the states adb will report devices.
 // A device can be communicated with when it's in StateOnline.
 // A USB device will make the following state transitions:
 //	Plugged in: StateDisconnected->StateOffline->StateOnline
 //	Unplugged:  StateOnline->StateDisconnected
+//
+// The names reported by adb are from connection_state_name() in adb/transport.cpp.
 
 //go:generate stringer -type=DeviceState
 type DeviceState int8
@@ -23,21 +27,90 @@ const (
 	StateOffline
 	StateOnline
 	StateHost
+	StateBootloader
+	StateRecovery
+	StateRescue
+	StateSideload
+	StateNoPermissions
+	StateConnecting
+	StateDetached
 )
 
+// stateNoPermissions is followed by a help text on linux, eg.
+//
+//	no permissions (missing udev rules? user is in the plugdev group); see [http://developer.android.com/tools/device.html]
+//	no permissions (user in plugdev group; are your udev rules wrong?); see [http://developer.android.com/tools/device.html]
+const stateNoPermissions = "no permissions"
+
 var deviceStateStrings = map[string]DeviceState{
-	"":             StateDisconnected,
-	"offline":      StateOffline,
-	"device":       StateOnline,
-	"unauthorized": StateUnauthorized,
-	"authorizing":  StateAuthorizing,
-	"host":         StateHost,
+	"":                 StateDisconnected,
+	"offline":          StateOffline,
+	"device":           StateOnline,
+	"unauthorized":     StateUnauthorized,
+	"authorizing":      StateAuthorizing,
+	"host":             StateHost,
+	"bootloader":       StateBootloader,
+	"recovery":         StateRecovery,
+	"rescue":           StateRescue,
+	"sideload":         StateSideload,
+	stateNoPermissions: StateNoPermissions,
+	"connecting":       StateConnecting,
+	"detached":         StateDetached,
 }
 
 func parseDeviceState(str string) (DeviceState, error) {
+	state, _, err := parseDeviceStateReason(str)
+	return state, err
+}
+
+// parseDeviceStateReason parses the state, and returns the help text adb appends
+// to some states (only 'no permissions' for now) as reason.
+func parseDeviceStateReason(str string) (state DeviceState, reason string, err error) {
+	if strings.HasPrefix(str, stateNoPermissions) {
+		reason = strings.TrimSpace(strings.TrimPrefix(str[len(stateNoPermissions):], ";"))
+		return StateNoPermissions, reason, nil
+	}
+
 	state, ok := deviceStateStrings[str]
 	if !ok {
-		return StateInvalid, fmt.Errorf("%w: invalid device state: '%s'", wire.ErrParse, str)
+		return StateInvalid, "", fmt.Errorf("%w: invalid device state: '%s'", wire.ErrParse, str)
 	}
-	return state, nil
+	return state, "", nil
+}
+
+// deviceAttrRegex matches the first attribute of a `devices -l` line.
+var deviceAttrRegex = regexp.MustCompile(`[ \t](usb|product|model|device|transport_id):`)
+
+// splitDeviceState splits the state from the attributes in the rest of a `devices -l` line.
+// Only 'no permissions' contains spaces, its help text may contain brackets too, so it ends
+// at the last ']' or ')' before the attributes.
+func splitDeviceState(rest string) (state, remain string) {
+	if strings.HasPrefix(rest, stateNoPermissions) {
+		head := rest
+		if loc := deviceAttrRegex.FindStringIndex(rest); loc != nil {
+			head = rest[:loc[0]]
+		}
+		end := len(stateNoPermissions)
+		if i := strings.LastIndexAny(head, "])"); i >= end {
+			end = i + 1
+		}
+		return rest[:end], strings.TrimLeft(rest[end:], " \t")
+	}
+
+	if i := strings.IndexAny(rest, " \t"); i >= 0 {
+		return rest[:i], strings.TrimLeft(rest[i:], " \t")
+	}
+	return rest, ""
+}
+
+// IsUsable returns true if adbd is running and accepts commands, ie. the device is
+// booted (StateOnline) or in recovery (StateRecovery).
+func (s DeviceState) IsUsable() bool {
+	return s == StateOnline || s == StateRecovery
+}
+
+// NeedsUserAction returns true if the device will stay unusable until someone
+// accepts the RSA key prompt on the device, or fixes the usb permissions on the host.
+func (s DeviceState) NeedsUserAction() bool {
+	return s == StateUnauthorized || s == StateNoPermissions
 }
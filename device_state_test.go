@@ -18,6 +18,13 @@ func TestParseDeviceState(t *testing.T) {
 		{"offline", StateOffline, "StateOffline", nil},
 		{"device", StateOnline, "StateOnline", nil},
 		{"unauthorized", StateUnauthorized, "StateUnauthorized", nil},
+		{"recovery", StateRecovery, "StateRecovery", nil},
+		{"sideload", StateSideload, "StateSideload", nil},
+		{"bootloader", StateBootloader, "StateBootloader", nil},
+		{"rescue", StateRescue, "StateRescue", nil},
+		{"host", StateHost, "StateHost", nil},
+		{"no permissions", StateNoPermissions, "StateNoPermissions", nil},
+		{"no permissions (missing udev rules? user is in the plugdev group); see [http://developer.android.com/tools/device.html]", StateNoPermissions, "StateNoPermissions", nil},
 		{"bad", StateInvalid, "StateInvalid", errors.New(`ParseError: invalid device state: 'bad'`)},
 	} {
 		state, err := parseDeviceState(test.String)
@@ -30,3 +37,46 @@ func TestParseDeviceState(t *testing.T) {
 		assert.Equal(t, test.WantName, state.String())
 	}
 }
+
+func TestParseDeviceStateReason(t *testing.T) {
+	state, reason, err := parseDeviceStateReason("no permissions (missing udev rules? user is in the plugdev group); see [http://developer.android.com/tools/device.html]")
+	assert.NoError(t, err)
+	assert.Equal(t, StateNoPermissions, state)
+	assert.Equal(t, "(missing udev rules? user is in the plugdev group); see [http://developer.android.com/tools/device.html]", reason)
+}
+
+func TestSplitDeviceState(t *testing.T) {
+	for _, tt := range []struct {
+		rest, state, reason, remain string
+	}{
+		{
+			"no permissions (missing udev rules? user is in the plugdev group); see [http://developer.android.com/tools/device.html] usb:3-1 transport_id:2",
+			"no permissions", "(missing udev rules? user is in the plugdev group); see [http://developer.android.com/tools/device.html]", "usb:3-1 transport_id:2",
+		},
+		{
+			"no permissions [udev] (user in plugdev group; are your udev rules wrong?); see [http://developer.android.com/tools/device.html] transport_id:7",
+			"no permissions", "[udev] (user in plugdev group; are your udev rules wrong?); see [http://developer.android.com/tools/device.html]", "transport_id:7",
+		},
+		{"no permissions (user in plugdev group)", "no permissions", "(user in plugdev group)", ""},
+		{"no permissions usb:1-1", "no permissions", "", "usb:1-1"},
+		{"device usb:1-2 model:Pixel_(x)", "device", "", "usb:1-2 model:Pixel_(x)"},
+	} {
+		str, remain := splitDeviceState(tt.rest)
+		assert.Equal(t, tt.remain, remain, tt.rest)
+		state, reason, err := parseDeviceStateReason(str)
+		assert.NoError(t, err, tt.rest)
+		assert.Equal(t, deviceStateStrings[tt.state], state, tt.rest)
+		assert.Equal(t, tt.reason, reason, tt.rest)
+	}
+}
+
+func TestDeviceStateHelpers(t *testing.T) {
+	assert.True(t, StateOnline.IsUsable())
+	assert.True(t, StateRecovery.IsUsable())
+	assert.False(t, StateSideload.IsUsable())
+	assert.False(t, StateUnauthorized.IsUsable())
+
+	assert.True(t, StateUnauthorized.NeedsUserAction())
+	assert.True(t, StateNoPermissions.NeedsUserAction())
+	assert.False(t, StateOffline.NeedsUserAction())
+}
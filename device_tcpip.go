@@ -0,0 +1,126 @@
+package adb
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TcpIp restarts adbd listening on TCP port, like `adb tcpip <port>`.
+// The device keeps its usb transport, but it goes offline while adbd restarts.
+//
+//	restarting in TCP mode port: 5555
+func (c *Device) TcpIp(port int) error {
+	resp, err := c.runService(fmt.Sprintf("tcpip:%d", port), c.CmdTimeoutShort)
+	if err != nil {
+		return wrapClientError(err, c, "TcpIp(%d)", port)
+	}
+	if msg := strings.TrimSpace(resp); !strings.HasPrefix(msg, "restarting in TCP mode") {
+		return wrapClientError(fmt.Errorf("tcpip failed: %s", msg), c, "TcpIp(%d)", port)
+	}
+	return nil
+}
+
+// Usb restarts adbd listening on USB, like `adb usb`.
+//
+//	restarting in USB mode
+func (c *Device) Usb() error {
+	resp, err := c.runService("usb:", c.CmdTimeoutShort)
+	if err != nil {
+		return wrapClientError(err, c, "Usb")
+	}
+	msg := strings.TrimSpace(resp)
+	if !strings.HasPrefix(msg, "restarting in USB mode") && !strings.Contains(msg, "already in USB mode") {
+		return wrapClientError(fmt.Errorf("usb failed: %s", msg), c, "Usb")
+	}
+	return nil
+}
+
+// SwitchToWireless moves a usb device to adb over wifi:
+//  1. read the ipv4 address of wlan0
+//  2. restart adbd in tcp mode on port
+//  3. connect to ip:port, and wait the new transport coming online in a DeviceWatcher
+//
+// It returns a Device bound to the serial "ip:port", with the timeouts, rate limits and
+// StoragePreflight of c.
+func (c *Device) SwitchToWireless(ctx context.Context, port int) (*Device, error) {
+	info, err := c.GetWlanInfo()
+	if err != nil {
+		return nil, wrapClientError(err, c, "SwitchToWireless")
+	}
+	ip, _, _ := strings.Cut(string(info.Ipv4), "/")
+	if ip == "" {
+		return nil, wrapClientError(fmt.Errorf("no ipv4 address on %s", info.Name), c, "SwitchToWireless")
+	}
+	addr := net.JoinHostPort(ip, strconv.Itoa(port))
+
+	// watch before connecting, so the online event can't be missed
+	watcher := newDeviceWatcher(c.server, DeviceWatcherOptions{})
+	defer watcher.Shutdown()
+
+	if err = c.TcpIp(port); err != nil {
+		return nil, err
+	}
+
+	// adbd restarts asynchronously, retry until it listens
+	client := &Adb{server: c.server}
+	for {
+		if err = client.Connect(addr); err == nil {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return nil, wrapClientError(fmt.Errorf("connect %s: %w, last error: %w", addr, ctx.Err(), err), c, "SwitchToWireless")
+		case <-time.After(time.Second):
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, wrapClientError(fmt.Errorf("wait %s online: %w", addr, ctx.Err()), c, "SwitchToWireless")
+		case event, ok := <-watcher.C():
+			if !ok {
+				return nil, wrapClientError(fmt.Errorf("wait %s online: %w", addr, watcher.Err()), c, "SwitchToWireless")
+			}
+			if event.Serial == addr && event.NewState == StateOnline {
+				return c.withSerial(addr), nil
+			}
+		}
+	}
+}
+
+// withSerial returns a client of the device serial, with the settings of c.
+func (c *Device) withSerial(serial string) *Device {
+	d := &Device{
+		server:           c.server,
+		descriptor:       DeviceWithSerial(serial),
+		deviceListFunc:   c.deviceListFunc,
+		adbRateLimiter:   c.adbRateLimiter,
+		CmdTimeoutShort:  c.CmdTimeoutShort,
+		CmdTimeoutLong:   c.CmdTimeoutLong,
+		StoragePreflight: c.StoragePreflight,
+	}
+	d.rateLimiter.SetLimit(c.rateLimiter.Limit())
+	return d
+}
+
+// SwitchToUsb restarts adbd in usb mode and waits the current transport to go away.
+// For a device connected by SwitchToWireless, the server would keep reconnecting to "ip:port",
+// so that transport is disconnected instead of waited.
+func (c *Device) SwitchToUsb(ctx context.Context) error {
+	if err := c.Usb(); err != nil {
+		return err
+	}
+
+	if c.descriptor.descriptorType == DeviceSerial {
+		if _, _, err := net.SplitHostPort(c.descriptor.serial); err == nil {
+			err = (&Adb{server: c.server}).Disconnect(c.descriptor.serial)
+			return wrapClientError(err, c, "SwitchToUsb")
+		}
+	}
+	return wrapClientError(c.waitFor(ctx, "disconnect"), c, "SwitchToUsb")
+}
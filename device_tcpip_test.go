@@ -0,0 +1,100 @@
+package adb
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/prife/goadb/wire"
+	"github.com/stretchr/testify/assert"
+)
+
+const wlan0Output = `3: wlan0: <BROADCAST,MULTICAST,UP,LOWER_UP> mtu 1500 qdisc mq state UP group default qlen 3000
+    link/ether 02:00:00:00:00:00 brd ff:ff:ff:ff:ff:ff
+    inet 192.168.1.23/24 brd 192.168.1.255 scope global wlan0
+       valid_lft forever preferred_lft forever
+`
+
+func writeHexMessage(conn *wire.Conn, msg string) error {
+	_, err := conn.Write([]byte(fmt.Sprintf("%04x%s", len(msg), msg)))
+	return err
+}
+
+func TestDevice_TcpIp(t *testing.T) {
+	s := &MockServer{
+		Status:   wire.StatusSuccess,
+		Messages: []string{"restarting in TCP mode port: 5555\n"},
+	}
+	d := (&Adb{server: s}).Device(DeviceWithSerial("serial"))
+	assert.NoError(t, d.TcpIp(5555))
+	assert.Equal(t, []string{"host:transport:serial", "tcpip:5555"}, s.Requests)
+
+	s = &MockServer{
+		Status:   wire.StatusSuccess,
+		Messages: []string{"error: unsupported\n"},
+	}
+	d = (&Adb{server: s}).Device(DeviceWithSerial("serial"))
+	assert.ErrorContains(t, d.TcpIp(5555), "tcpip failed: error: unsupported")
+}
+
+func TestAdb_ConnectFailed(t *testing.T) {
+	s := &MockServer{
+		Status:   wire.StatusSuccess,
+		Messages: []string{"failed to connect to '192.168.1.23:5555': Connection refused"},
+	}
+	err := (&Adb{server: s}).Connect("192.168.1.23:5555")
+	assert.ErrorIs(t, err, wire.ErrAdb)
+}
+
+func TestDevice_SwitchToWireless(t *testing.T) {
+	const addr = "192.168.1.23:5555"
+	online := make(chan struct{})
+	s := &pipeServer{handler: func(conn *wire.Conn) {
+		msg, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		conn.Write([]byte(wire.StatusSuccess))
+
+		switch string(msg) {
+		case "host:track-devices":
+			writeHexMessage(conn, "serial\tdevice\n")
+			<-online
+			writeHexMessage(conn, "serial\tdevice\n"+addr+"\tdevice\n")
+			conn.ReadUntilEof()
+		case "host:connect:" + addr:
+			writeHexMessage(conn, "connected to "+addr)
+			close(online)
+		case "host:transport:serial":
+			req, _ := conn.ReadMessage()
+			conn.Write([]byte(wire.StatusSuccess))
+			switch string(req) {
+			case "shell:ip address show wlan0":
+				conn.Write([]byte(wlan0Output))
+			case "tcpip:5555":
+				conn.Write([]byte("restarting in TCP mode port: 5555\n"))
+			default:
+				t.Errorf("unexpected request: %s", req)
+			}
+		default:
+			t.Errorf("unexpected request: %s", msg)
+		}
+	}}
+	client := &Adb{server: s}
+	d := client.Device(DeviceWithSerial("serial"))
+	d.CmdTimeoutLong = time.Minute
+	d.StoragePreflight = true
+	d.SetRateLimit(1000)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	wd, err := d.SwitchToWireless(ctx, 5555)
+	assert.NoError(t, err)
+	assert.Equal(t, DeviceWithSerial(addr), wd.descriptor)
+	// the settings of d are kept
+	assert.Equal(t, time.Minute, wd.CmdTimeoutLong)
+	assert.True(t, wd.StoragePreflight)
+	assert.Equal(t, int64(1000), wd.RateLimit())
+	assert.Same(t, &client.rateLimiter, wd.adbRateLimiter)
+}
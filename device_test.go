@@ -15,7 +15,7 @@ func TestGetAttribute(t *testing.T) {
 		Status:   wire.StatusSuccess,
 		Messages: []string{"value"},
 	}
-	client := (&Adb{s}).Device(DeviceWithSerial("serial"))
+	client := (&Adb{server: s}).Device(DeviceWithSerial("serial"))
 
 	v, err := client.getAttribute("attr")
 	assert.Equal(t, "host-serial:serial:attr", s.Requests[0])
@@ -56,7 +56,7 @@ func TestGetDeviceInfo(t *testing.T) {
 }
 
 func newDeviceClientWithDeviceLister(serial string, deviceLister func() ([]*DeviceInfo, error)) *Device {
-	client := (&Adb{&MockServer{
+	client := (&Adb{server: &MockServer{
 		Status:   wire.StatusSuccess,
 		Messages: []string{serial},
 	}}).Device(DeviceWithSerial(serial))
@@ -73,7 +73,7 @@ func TestRunCommandNoArgs(t *testing.T) {
 			Buffer: buf,
 		},
 	}
-	client := (&Adb{s}).Device(AnyDevice())
+	client := (&Adb{server: s}).Device(AnyDevice())
 
 	v, err := client.RunCommand("cmd")
 	assert.Equal(t, "host:transport-any", s.Requests[0])
@@ -7,6 +7,7 @@ import (
 	"math/rand"
 	"runtime"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -45,12 +46,30 @@ type deviceWatcherImpl struct {
 	err atomic.Value
 
 	eventChan chan DeviceStateChangedEvent
+
+	// stop is closed by Shutdown, scanner is the current track-devices connection.
+	stop     chan struct{}
+	stopOnce sync.Once
+	mu       sync.Mutex
+	scanner  wire.Scanner
+
+	// auto-heal, see EnableAutoHeal. Guarded by mu.
+	healThreshold time.Duration
+	offlineTimers map[string]*time.Timer
+}
+
+// DeviceWatcherOptions configures a DeviceWatcher from its start.
+type DeviceWatcherOptions struct {
+	// AutoHeal is the threshold of EnableAutoHeal, zero disables it.
+	AutoHeal time.Duration
 }
 
-func newDeviceWatcher(server server) *DeviceWatcher {
+func newDeviceWatcher(server server, opts DeviceWatcherOptions) *DeviceWatcher {
 	watcher := &DeviceWatcher{&deviceWatcherImpl{
-		server:    server,
-		eventChan: make(chan DeviceStateChangedEvent),
+		server:        server,
+		eventChan:     make(chan DeviceStateChangedEvent),
+		stop:          make(chan struct{}),
+		healThreshold: opts.AutoHeal,
 	}}
 
 	runtime.SetFinalizer(watcher, func(watcher *DeviceWatcher) {
@@ -78,27 +97,132 @@ func (w *DeviceWatcher) Err() error {
 }
 
 // Shutdown stops the watcher from listening for events and closes the channel returned
-// from C.
+// from C. Events not received yet are dropped.
 func (w *DeviceWatcher) Shutdown() {
-	// TODO(z): Implement.
+	w.stopOnce.Do(func() {
+		if w.stop != nil {
+			close(w.stop)
+		}
+		w.setScanner(nil)
+		w.stopHealTimers()
+	})
+}
+
+// EnableAutoHeal makes the watcher kick the transport of a device which stays StateOffline
+// for longer than threshold, like `adb reconnect` does. The reconnect is repeated every threshold
+// until the device leaves StateOffline.
+// It only applies to devices going offline after the call, zero disables it. To cover the
+// devices already offline at start, use DeviceWatcherOptions.AutoHeal instead.
+func (w *DeviceWatcher) EnableAutoHeal(threshold time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.healThreshold = threshold
+}
+
+// trackOffline arms an auto-heal timer when a device goes offline, and disarms it on any other state.
+func (w *deviceWatcherImpl) trackOffline(event DeviceStateChangedEvent) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if timer, ok := w.offlineTimers[event.Serial]; ok {
+		timer.Stop()
+		delete(w.offlineTimers, event.Serial)
+	}
+	if w.healThreshold <= 0 || event.NewState != StateOffline || w.stopped() {
+		return
+	}
+	w.armHealLocked(event.Serial, w.healThreshold)
+}
+
+func (w *deviceWatcherImpl) armHealLocked(serial string, threshold time.Duration) {
+	if w.offlineTimers == nil {
+		w.offlineTimers = make(map[string]*time.Timer)
+	}
+	var timer *time.Timer
+	timer = time.AfterFunc(threshold, func() {
+		w.mu.Lock()
+		current := w.offlineTimers[serial] == timer
+		w.mu.Unlock()
+		if !current || w.stopped() {
+			return
+		}
+
+		log.Printf("[DeviceWatcher] %s offline for %s, reconnecting…", serial, threshold)
+		if _, err := roundTripSingleResponse(w.server, fmt.Sprintf("host-serial:%s:reconnect", serial)); err != nil {
+			log.Printf("[DeviceWatcher] reconnect %s failed: %v", serial, err)
+		}
+
+		// re-arm if no state change happened meanwhile
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		if w.offlineTimers[serial] == timer && !w.stopped() {
+			w.armHealLocked(serial, threshold)
+		}
+	})
+	w.offlineTimers[serial] = timer
+}
+
+func (w *deviceWatcherImpl) stopHealTimers() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for serial, timer := range w.offlineTimers {
+		timer.Stop()
+		delete(w.offlineTimers, serial)
+	}
 }
 
 func (w *deviceWatcherImpl) reportErr(err error) {
 	w.err.Store(err)
 }
 
+// setScanner closes the previous scanner and records the new one, so Shutdown can interrupt
+// a blocking read. Returns false if the watcher has been shut down, in which case scanner is closed.
+func (w *deviceWatcherImpl) setScanner(scanner wire.Scanner) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.scanner != nil {
+		w.scanner.Close()
+	}
+	w.scanner = scanner
+	if w.stopped() {
+		if scanner != nil {
+			scanner.Close()
+		}
+		w.scanner = nil
+		return false
+	}
+	return true
+}
+
+func (w *deviceWatcherImpl) stopped() bool {
+	select {
+	case <-w.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// publish sends event to eventChan, returns false if the watcher has been shut down.
+func (w *deviceWatcherImpl) publish(event DeviceStateChangedEvent) bool {
+	w.trackOffline(event)
+	select {
+	case w.eventChan <- event:
+		return true
+	case <-w.stop:
+		return false
+	}
+}
+
 // publishDevices reads device lists from scanner, calculates diffs, and publishes events on
 // eventChan.
 // Returns when scanner returns an error.
 // Doesn't refer directly to a *DeviceWatcher so it can be GCed (which will,
 // in turn, close Scanner and stop this goroutine).
 //
-// TODO: to support shutdown, spawn a new goroutine each time a server connection is established.
-// This goroutine should read messages and send them to a message channel. Can write errors directly
-// to errVal. publishDevicesUntilError should take the msg chan and the scanner and select on the msg chan and stop chan, and if the stop
-// chan sends, close the scanner and return true. If the msg chan closes, just return false.
-// publishDevices can look at ret val: if false and err == EOF, reconnect. If false and other error, report err
-// and abort. If true, report no error and stop.
+// Shutdown closes the stop chan and the current scanner, which unblocks both the read of
+// publishDevicesUntilError and any pending send on eventChan, then this goroutine returns
+// without reporting an error.
 func publishDevices(watcher *deviceWatcherImpl) {
 	defer close(watcher.eventChan)
 
@@ -108,14 +232,19 @@ func publishDevices(watcher *deviceWatcherImpl) {
 	for {
 		scanner, err := connectToTrackDevices(watcher.server)
 		if err != nil {
-			watcher.reportErr(err)
+			if !watcher.stopped() {
+				watcher.reportErr(err)
+			}
+			return
+		}
+		if !watcher.setScanner(scanner) {
 			return
 		}
 
-		finished, err = publishDevicesUntilError(scanner, watcher.eventChan, &lastKnownStates)
+		finished, err = publishDevicesUntilError(scanner, watcher, &lastKnownStates)
 
-		if finished {
-			scanner.Close()
+		if finished || watcher.stopped() {
+			watcher.setScanner(nil)
 			return
 		}
 
@@ -130,7 +259,9 @@ func publishDevices(watcher *deviceWatcherImpl) {
 
 			// report all devices removed
 			for serial, deviceState := range lastKnownStates {
-				watcher.eventChan <- DeviceStateChangedEvent{serial, deviceState, StateDisconnected}
+				if !watcher.publish(DeviceStateChangedEvent{serial, deviceState, StateDisconnected}) {
+					return
+				}
 			}
 			lastKnownStates = nil
 
@@ -172,7 +303,7 @@ func connectToTrackDevices(server server) (wire.Scanner, error) {
 	return conn, nil
 }
 
-func publishDevicesUntilError(scanner wire.Scanner, eventChan chan<- DeviceStateChangedEvent, lastKnownStates *map[string]DeviceState) (finished bool, err error) {
+func publishDevicesUntilError(scanner wire.Scanner, watcher *deviceWatcherImpl, lastKnownStates *map[string]DeviceState) (finished bool, err error) {
 	for {
 		msg, err := scanner.ReadMessage()
 		if err != nil {
@@ -185,7 +316,9 @@ func publishDevicesUntilError(scanner wire.Scanner, eventChan chan<- DeviceState
 		}
 
 		for _, event := range calculateStateDiffs(*lastKnownStates, deviceStates) {
-			eventChan <- event
+			if !watcher.publish(event) {
+				return true, nil
+			}
 		}
 		*lastKnownStates = deviceStates
 	}
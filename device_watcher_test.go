@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/prife/goadb/wire"
 	"github.com/stretchr/testify/assert"
@@ -29,6 +30,17 @@ func TestParseDeviceStatesMultiple(t *testing.T) {
 	assert.Equal(t, StateOnline, states["0x0x0x0x"])
 }
 
+func TestParseDeviceStatesRecoveryAndNoPermissions(t *testing.T) {
+	states, err := parseDeviceStates(`R58M12345	recovery
+0123456789ABCDEF	no permissions (missing udev rules? user is in the plugdev group); see [http://developer.android.com/tools/device.html]
+`)
+
+	assert.NoError(t, err)
+	assert.Len(t, states, 2)
+	assert.Equal(t, StateRecovery, states["R58M12345"])
+	assert.Equal(t, StateNoPermissions, states["0123456789ABCDEF"])
+}
+
 func TestParseDeviceStatesMalformed(t *testing.T) {
 	_, err := parseDeviceStates(`192.168.56.101:5555	offline
 0x0x0x0x
@@ -243,3 +255,57 @@ func assertContains(t *testing.T, expectedEntry DeviceStateChangedEvent, actual
 	}
 	assert.Fail(t, "expected to find %+v in %+v", expectedEntry, actual)
 }
+
+func TestDeviceWatcher_AutoHeal(t *testing.T) {
+	reconnected := make(chan string, 10)
+	s := &pipeServer{handler: func(conn *wire.Conn) {
+		msg, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		conn.Write([]byte(wire.StatusSuccess))
+		switch string(msg) {
+		case "host:track-devices":
+			writeHexMessage(conn, "serial\toffline\n")
+			conn.ReadUntilEof()
+		default:
+			writeHexMessage(conn, "done")
+			reconnected <- string(msg)
+		}
+	}}
+
+	watcher := (&Adb{server: s}).NewDeviceWatcherWithOptions(DeviceWatcherOptions{AutoHeal: time.Millisecond * 20})
+	defer watcher.Shutdown()
+	assert.Equal(t, DeviceStateChangedEvent{"serial", StateDisconnected, StateOffline}, <-watcher.C())
+
+	// still offline after the first reconnect, it's repeated
+	for i := 0; i < 2; i++ {
+		select {
+		case req := <-reconnected:
+			assert.Equal(t, "host-serial:serial:reconnect", req)
+		case <-time.After(time.Second * 2):
+			t.Fatal("no reconnect for offline device")
+		}
+	}
+}
+
+func TestDeviceWatcher_Shutdown(t *testing.T) {
+	s := &pipeServer{handler: func(conn *wire.Conn) {
+		conn.ReadMessage()
+		conn.Write([]byte(wire.StatusSuccess))
+		writeHexMessage(conn, "serial\tdevice\n")
+		conn.ReadUntilEof()
+	}}
+	watcher := newDeviceWatcher(s, DeviceWatcherOptions{})
+	event := <-watcher.C()
+	assert.Equal(t, DeviceStateChangedEvent{"serial", StateDisconnected, StateOnline}, event)
+
+	watcher.Shutdown()
+	select {
+	case _, ok := <-watcher.C():
+		assert.False(t, ok)
+	case <-time.After(time.Second * 2):
+		t.Fatal("watcher not closed after Shutdown")
+	}
+	assert.NoError(t, watcher.Err())
+}
@@ -15,11 +15,18 @@ func _() {
 	_ = x[StateOffline-4]
 	_ = x[StateOnline-5]
 	_ = x[StateHost-6]
+	_ = x[StateBootloader-7]
+	_ = x[StateRecovery-8]
+	_ = x[StateRescue-9]
+	_ = x[StateSideload-10]
+	_ = x[StateNoPermissions-11]
+	_ = x[StateConnecting-12]
+	_ = x[StateDetached-13]
 }
 
-const _DeviceState_name = "StateInvalidStateUnauthorizedStateAuthorizingStateDisconnectedStateOfflineStateOnlineStateHost"
+const _DeviceState_name = "StateInvalidStateUnauthorizedStateAuthorizingStateDisconnectedStateOfflineStateOnlineStateHostStateBootloaderStateRecoveryStateRescueStateSideloadStateNoPermissionsStateConnectingStateDetached"
 
-var _DeviceState_index = [...]uint8{0, 12, 29, 45, 62, 74, 85, 94}
+var _DeviceState_index = [...]uint8{0, 12, 29, 45, 62, 74, 85, 94, 109, 122, 133, 146, 164, 179, 192}
 
 func (i DeviceState) String() string {
 	if i < 0 || i >= DeviceState(len(_DeviceState_index)-1) {
@@ -25,3 +25,16 @@ func (tcpDialer) Dial(address string, timeout time.Duration) (*wire.Conn, error)
 
 	return wire.NewConn(netConn), nil
 }
+
+type unixDialer struct{}
+
+// Dial connects to the adb server listening on the unix socket at address,
+// eg. started with `adb -L localfilesystem:/path start-server`.
+func (unixDialer) Dial(address string, timeout time.Duration) (*wire.Conn, error) {
+	netConn, err := net.DialTimeout("unix", address, timeout)
+	if err != nil {
+		return nil, fmt.Errorf("%w: error dialing %s", wire.ErrServerNotAvailable, address)
+	}
+
+	return wire.NewConn(netConn), nil
+}
@@ -0,0 +1,380 @@
+// Package jdwp implements the few commands of the Java Debug Wire Protocol needed to inspect
+// the threads of an app, see https://docs.oracle.com/javase/8/docs/platform/jpda/jdwp/jdwp-protocol.html.
+// A connection to the VM of a debuggable process is opened by adb.Device.ConnectJdwp.
+package jdwp
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+const (
+	// HandshakeString is sent by the debugger, and echoed by the VM.
+	HandshakeString = "JDWP-Handshake"
+
+	headerLen    = 11
+	flagReply    = 0x80
+	maxPacketLen = 64 * 1024 * 1024
+)
+
+// Command sets and commands, see the JDWP specification.
+const (
+	SetVirtualMachine  = 1
+	SetThreadReference = 11
+
+	// VirtualMachine commands
+	CmdVersion    = 1
+	CmdAllThreads = 4
+	CmdIDSizes    = 7
+	CmdSuspend    = 8
+	CmdResume     = 9
+
+	// ThreadReference commands
+	CmdThreadName   = 1
+	CmdThreadStatus = 4
+)
+
+// ErrHandshake is returned when the VM doesn't echo the handshake, eg. the process is not debuggable,
+// or another debugger is attached.
+var ErrHandshake = errors.New("jdwp handshake failed")
+
+// Error is the error code of a reply, eg. 10 INVALID_THREAD.
+type Error uint16
+
+func (e Error) Error() string {
+	return fmt.Sprintf("jdwp error %d", uint16(e))
+}
+
+// Handshake sends HandshakeString and waits for it to be echoed.
+func Handshake(rw io.ReadWriter) error {
+	if _, err := io.WriteString(rw, HandshakeString); err != nil {
+		return fmt.Errorf("%w: %w", ErrHandshake, err)
+	}
+	buf := make([]byte, len(HandshakeString))
+	if _, err := io.ReadFull(rw, buf); err != nil {
+		return fmt.Errorf("%w: %w", ErrHandshake, err)
+	}
+	if string(buf) != HandshakeString {
+		return fmt.Errorf("%w: unexpected reply %q", ErrHandshake, buf)
+	}
+	return nil
+}
+
+// Packet is a command or reply packet.
+type Packet struct {
+	ID    uint32
+	Flags byte
+	// CommandSet and Command of a command packet.
+	CommandSet byte
+	Command    byte
+	// ErrorCode of a reply packet.
+	ErrorCode uint16
+	Data      []byte
+}
+
+// IsReply returns true if p is a reply packet.
+func (p *Packet) IsReply() bool {
+	return p.Flags&flagReply != 0
+}
+
+// WritePacket encodes p to w.
+func WritePacket(w io.Writer, p *Packet) error {
+	buf := make([]byte, headerLen, headerLen+len(p.Data))
+	binary.BigEndian.PutUint32(buf[0:], uint32(headerLen+len(p.Data)))
+	binary.BigEndian.PutUint32(buf[4:], p.ID)
+	buf[8] = p.Flags
+	if p.IsReply() {
+		binary.BigEndian.PutUint16(buf[9:], p.ErrorCode)
+	} else {
+		buf[9], buf[10] = p.CommandSet, p.Command
+	}
+	_, err := w.Write(append(buf, p.Data...))
+	return err
+}
+
+// ReadPacket decodes a packet from r.
+func ReadPacket(r io.Reader) (*Packet, error) {
+	var header [headerLen]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+	length := binary.BigEndian.Uint32(header[0:])
+	if length < headerLen || length > maxPacketLen {
+		return nil, fmt.Errorf("invalid jdwp packet length %d", length)
+	}
+
+	p := &Packet{
+		ID:    binary.BigEndian.Uint32(header[4:]),
+		Flags: header[8],
+		Data:  make([]byte, length-headerLen),
+	}
+	if p.IsReply() {
+		p.ErrorCode = binary.BigEndian.Uint16(header[9:])
+	} else {
+		p.CommandSet, p.Command = header[9], header[10]
+	}
+	if _, err := io.ReadFull(r, p.Data); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Client sends commands to a VM, one at a time. Commands sent by the VM, like events,
+// are dropped while waiting for a reply.
+type Client struct {
+	conn   io.ReadWriter
+	mu     sync.Mutex
+	nextID uint32
+	// size of objectID (and threadID), queried by IDSizes
+	objectIDSize int
+}
+
+// NewClient returns a Client of conn, which must have done the Handshake.
+func NewClient(conn io.ReadWriter) *Client {
+	return &Client{conn: conn}
+}
+
+// Command sends a command packet, and returns the data of its reply.
+// A reply with an error code is returned as Error.
+func (c *Client) Command(commandSet, command byte, data []byte) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.nextID++
+	id := c.nextID
+	if err := WritePacket(c.conn, &Packet{ID: id, CommandSet: commandSet, Command: command, Data: data}); err != nil {
+		return nil, err
+	}
+	for {
+		p, err := ReadPacket(c.conn)
+		if err != nil {
+			return nil, err
+		}
+		if !p.IsReply() || p.ID != id {
+			continue
+		}
+		if p.ErrorCode != 0 {
+			return nil, Error(p.ErrorCode)
+		}
+		return p.Data, nil
+	}
+}
+
+// Version is the reply of VirtualMachine.Version.
+type Version struct {
+	Description string
+	JdwpMajor   int32
+	JdwpMinor   int32
+	VMVersion   string
+	VMName      string
+}
+
+// Version returns the version of the VM.
+func (c *Client) Version() (*Version, error) {
+	data, err := c.Command(SetVirtualMachine, CmdVersion, nil)
+	if err != nil {
+		return nil, fmt.Errorf("Version: %w", err)
+	}
+	r := &reader{buf: data}
+	v := &Version{
+		Description: r.string(),
+		JdwpMajor:   r.int32(),
+		JdwpMinor:   r.int32(),
+		VMVersion:   r.string(),
+		VMName:      r.string(),
+	}
+	if r.err != nil {
+		return nil, fmt.Errorf("Version: %w", r.err)
+	}
+	return v, nil
+}
+
+// IDSizes returns the sizes of the variably sized ids of the VM.
+// It is called by the commands which need the size of threadID.
+func (c *Client) IDSizes() (fieldID, methodID, objectID, referenceTypeID, frameID int, err error) {
+	data, err := c.Command(SetVirtualMachine, CmdIDSizes, nil)
+	if err != nil {
+		return 0, 0, 0, 0, 0, fmt.Errorf("IDSizes: %w", err)
+	}
+	r := &reader{buf: data}
+	fieldID, methodID, objectID = int(r.int32()), int(r.int32()), int(r.int32())
+	referenceTypeID, frameID = int(r.int32()), int(r.int32())
+	if r.err == nil && (objectID <= 0 || objectID > 8) {
+		r.err = fmt.Errorf("unsupported objectID size %d", objectID)
+	}
+	if r.err != nil {
+		return 0, 0, 0, 0, 0, fmt.Errorf("IDSizes: %w", r.err)
+	}
+	c.mu.Lock()
+	c.objectIDSize = objectID
+	c.mu.Unlock()
+	return
+}
+
+func (c *Client) idSize() (int, error) {
+	c.mu.Lock()
+	size := c.objectIDSize
+	c.mu.Unlock()
+	if size != 0 {
+		return size, nil
+	}
+	_, _, size, _, _, err := c.IDSizes()
+	return size, err
+}
+
+// ThreadID is the objectID of a thread.
+type ThreadID uint64
+
+// AllThreads returns the live threads of the VM.
+func (c *Client) AllThreads() ([]ThreadID, error) {
+	size, err := c.idSize()
+	if err != nil {
+		return nil, fmt.Errorf("AllThreads: %w", err)
+	}
+	data, err := c.Command(SetVirtualMachine, CmdAllThreads, nil)
+	if err != nil {
+		return nil, fmt.Errorf("AllThreads: %w", err)
+	}
+	r := &reader{buf: data}
+	n := int(r.int32())
+	if r.err == nil && (n < 0 || n*size > len(r.buf)) {
+		r.err = fmt.Errorf("invalid thread count %d", n)
+	}
+	if r.err != nil {
+		return nil, fmt.Errorf("AllThreads: %w", r.err)
+	}
+	threads := make([]ThreadID, n)
+	for i := range threads {
+		threads[i] = ThreadID(r.id(size))
+	}
+	if r.err != nil {
+		return nil, fmt.Errorf("AllThreads: %w", r.err)
+	}
+	return threads, nil
+}
+
+// Suspend suspends all threads of the VM.
+func (c *Client) Suspend() error {
+	if _, err := c.Command(SetVirtualMachine, CmdSuspend, nil); err != nil {
+		return fmt.Errorf("Suspend: %w", err)
+	}
+	return nil
+}
+
+// Resume resumes all threads suspended by Suspend.
+func (c *Client) Resume() error {
+	if _, err := c.Command(SetVirtualMachine, CmdResume, nil); err != nil {
+		return fmt.Errorf("Resume: %w", err)
+	}
+	return nil
+}
+
+// ThreadStatus is the status of a thread, see JDWP.ThreadStatus.
+type ThreadStatus int32
+
+const (
+	ThreadZombie ThreadStatus = iota
+	ThreadRunning
+	ThreadSleeping
+	ThreadMonitor
+	ThreadWait
+)
+
+func (s ThreadStatus) String() string {
+	switch s {
+	case ThreadZombie:
+		return "zombie"
+	case ThreadRunning:
+		return "running"
+	case ThreadSleeping:
+		return "sleeping"
+	case ThreadMonitor:
+		return "monitor"
+	case ThreadWait:
+		return "wait"
+	}
+	return fmt.Sprintf("ThreadStatus(%d)", int32(s))
+}
+
+// ThreadName returns the name of thread.
+func (c *Client) ThreadName(thread ThreadID) (string, error) {
+	data, err := c.threadCommand(CmdThreadName, thread)
+	if err != nil {
+		return "", fmt.Errorf("ThreadName: %w", err)
+	}
+	r := &reader{buf: data}
+	name := r.string()
+	if r.err != nil {
+		return "", fmt.Errorf("ThreadName: %w", r.err)
+	}
+	return name, nil
+}
+
+// ThreadStatus returns the status of thread, and whether it is suspended.
+func (c *Client) ThreadStatus(thread ThreadID) (status ThreadStatus, suspended bool, err error) {
+	data, err := c.threadCommand(CmdThreadStatus, thread)
+	if err != nil {
+		return 0, false, fmt.Errorf("ThreadStatus: %w", err)
+	}
+	r := &reader{buf: data}
+	status, suspended = ThreadStatus(r.int32()), r.int32()&1 != 0
+	if r.err != nil {
+		return 0, false, fmt.Errorf("ThreadStatus: %w", r.err)
+	}
+	return
+}
+
+func (c *Client) threadCommand(command byte, thread ThreadID) ([]byte, error) {
+	size, err := c.idSize()
+	if err != nil {
+		return nil, err
+	}
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], uint64(thread))
+	return c.Command(SetThreadReference, command, buf[8-size:])
+}
+
+// reader decodes the data of a reply, the first error sticks.
+type reader struct {
+	buf []byte
+	err error
+}
+
+func (r *reader) next(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || len(r.buf) < n {
+		r.err = io.ErrUnexpectedEOF
+		return nil
+	}
+	b := r.buf[:n]
+	r.buf = r.buf[n:]
+	return b
+}
+
+func (r *reader) int32() int32 {
+	b := r.next(4)
+	if b == nil {
+		return 0
+	}
+	return int32(binary.BigEndian.Uint32(b))
+}
+
+func (r *reader) id(size int) uint64 {
+	b := r.next(size)
+	if b == nil {
+		return 0
+	}
+	var buf [8]byte
+	copy(buf[8-size:], b)
+	return binary.BigEndian.Uint64(buf[:])
+}
+
+func (r *reader) string() string {
+	b := r.next(int(r.int32()))
+	return string(b)
+}
@@ -0,0 +1,114 @@
+package jdwp
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func appendString(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint32(b, uint32(len(s)))
+	return append(b, s...)
+}
+
+// fakeVM does the handshake, then answers commands with replies[commandSet<<8|command].
+// Before each reply it sends an event packet, which the client must skip.
+func fakeVM(t *testing.T, conn net.Conn, replies map[int]*Packet) {
+	defer conn.Close()
+	handshake := make([]byte, len(HandshakeString))
+	if _, err := io.ReadFull(conn, handshake); err != nil {
+		return
+	}
+	conn.Write(handshake)
+	for {
+		p, err := ReadPacket(conn)
+		if err != nil {
+			return
+		}
+		WritePacket(conn, &Packet{ID: 1000, CommandSet: 64, Command: 100})
+		reply, ok := replies[int(p.CommandSet)<<8|int(p.Command)]
+		if !ok {
+			reply = &Packet{ErrorCode: 99}
+		}
+		reply.ID, reply.Flags = p.ID, flagReply
+		assert.NoError(t, WritePacket(conn, reply))
+	}
+}
+
+func TestPacketRoundTrip(t *testing.T) {
+	r, w := io.Pipe()
+	go WritePacket(w, &Packet{ID: 7, CommandSet: SetVirtualMachine, Command: CmdVersion, Data: []byte{1, 2}})
+	p, err := ReadPacket(r)
+	assert.NoError(t, err)
+	assert.Equal(t, &Packet{ID: 7, CommandSet: SetVirtualMachine, Command: CmdVersion, Data: []byte{1, 2}}, p)
+	assert.False(t, p.IsReply())
+}
+
+func TestHandshakeFailed(t *testing.T) {
+	client, vm := net.Pipe()
+	go func() {
+		io.ReadFull(vm, make([]byte, len(HandshakeString)))
+		vm.Write([]byte("not-debuggable"))
+	}()
+	assert.ErrorIs(t, Handshake(client), ErrHandshake)
+}
+
+func TestClient(t *testing.T) {
+	var version []byte
+	version = appendString(version, "Android Runtime 2.1.0")
+	version = binary.BigEndian.AppendUint32(version, 1)
+	version = binary.BigEndian.AppendUint32(version, 6)
+	version = appendString(version, "2.1.0")
+	version = appendString(version, "Dalvik")
+
+	var sizes []byte
+	for _, size := range []uint32{8, 8, 4, 8, 8} {
+		sizes = binary.BigEndian.AppendUint32(sizes, size)
+	}
+	threads := binary.BigEndian.AppendUint32(nil, 2)
+	threads = binary.BigEndian.AppendUint32(threads, 0x10)
+	threads = binary.BigEndian.AppendUint32(threads, 0x20)
+
+	var status []byte
+	status = binary.BigEndian.AppendUint32(status, uint32(ThreadWait))
+	status = binary.BigEndian.AppendUint32(status, 1)
+
+	client, vm := net.Pipe()
+	go fakeVM(t, vm, map[int]*Packet{
+		SetVirtualMachine<<8 | CmdVersion:       {Data: version},
+		SetVirtualMachine<<8 | CmdIDSizes:       {Data: sizes},
+		SetVirtualMachine<<8 | CmdAllThreads:    {Data: threads},
+		SetVirtualMachine<<8 | CmdSuspend:       {},
+		SetVirtualMachine<<8 | CmdResume:        {},
+		SetThreadReference<<8 | CmdThreadName:   {Data: appendString(nil, "main")},
+		SetThreadReference<<8 | CmdThreadStatus: {Data: status},
+	})
+	defer client.Close()
+	assert.NoError(t, Handshake(client))
+	c := NewClient(client)
+
+	v, err := c.Version()
+	assert.NoError(t, err)
+	assert.Equal(t, &Version{"Android Runtime 2.1.0", 1, 6, "2.1.0", "Dalvik"}, v)
+
+	assert.NoError(t, c.Suspend())
+	ids, err := c.AllThreads()
+	assert.NoError(t, err)
+	assert.Equal(t, []ThreadID{0x10, 0x20}, ids)
+
+	name, err := c.ThreadName(ids[0])
+	assert.NoError(t, err)
+	assert.Equal(t, "main", name)
+
+	st, suspended, err := c.ThreadStatus(ids[0])
+	assert.NoError(t, err)
+	assert.Equal(t, ThreadWait, st)
+	assert.True(t, suspended)
+	assert.NoError(t, c.Resume())
+
+	_, err = c.Command(SetVirtualMachine, 99, nil)
+	assert.Equal(t, Error(99), err)
+}
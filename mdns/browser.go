@@ -0,0 +1,213 @@
+package mdns
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Service types advertised by adbd, see adb/adb_mdns.h
+const (
+	ServiceAdb        = "_adb._tcp"
+	ServiceTlsConnect = "_adb-tls-connect._tcp"
+	ServiceTlsPairing = "_adb-tls-pairing._tcp"
+
+	domain = "local."
+)
+
+var (
+	// GroupAddr is the IPv4 mDNS multicast group.
+	GroupAddr = &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: 5353}
+
+	DefaultInterval = time.Second
+)
+
+// Endpoint is a resolved service instance.
+type Endpoint struct {
+	// Instance name, eg. adb-R58M12345-AbCdEf
+	Instance string
+	// Service type, eg. _adb-tls-connect._tcp
+	Service string
+	// Target host of the SRV record, eg. Android.local.
+	Host string
+	IP   net.IP
+	Port int
+	Txt  []string
+}
+
+// Addr returns "ip:port", which can be passed to Adb.Connect.
+func (e Endpoint) Addr() string {
+	return net.JoinHostPort(e.IP.String(), strconv.Itoa(e.Port))
+}
+
+// Browser discovers adb services with mDNS, without relying on the adb server.
+//
+// Queries are sent from an ephemeral port, so responders answer with unicast to that
+// port (legacy unicast, RFC 6762 section 6.7), and no multicast membership is needed.
+type Browser struct {
+	// Addr queries are sent to, defaults to GroupAddr. Tests may point it to a responder on loopback.
+	Addr *net.UDPAddr
+	// Interval between queries, defaults to DefaultInterval.
+	Interval time.Duration
+}
+
+// instance is the state of one service instance, built from PTR, SRV, TXT and A records.
+type instance struct {
+	name    string
+	service string
+	host    string
+	port    int
+	txt     []string
+	emitted bool
+}
+
+type browseState struct {
+	mu        sync.Mutex
+	services  []string
+	instances map[string]*instance // key: full instance name, eg. adb-xx._adb-tls-connect._tcp.local.
+	hosts     map[string]net.IP
+}
+
+// Browse queries services (ServiceTlsConnect by default) until ctx is done, and sends each
+// endpoint on the returned channel once its address is resolved. The channel is closed when ctx is done.
+func (b *Browser) Browse(ctx context.Context, services ...string) (<-chan Endpoint, error) {
+	if len(services) == 0 {
+		services = []string{ServiceTlsConnect}
+	}
+	addr := b.Addr
+	if addr == nil {
+		addr = GroupAddr
+	}
+	interval := b.Interval
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{})
+	if err != nil {
+		return nil, err
+	}
+
+	state := &browseState{
+		services:  services,
+		instances: make(map[string]*instance),
+		hosts:     make(map[string]net.IP),
+	}
+	ch := make(chan Endpoint)
+
+	// the query loop owns conn, and closes it on ctx done, which stops the read loop
+	go func() {
+		defer conn.Close()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			conn.WriteToUDP(buildQuery(state.questions()), addr)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	go func() {
+		defer close(ch)
+		buf := make([]byte, 9000)
+		for {
+			n, _, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			records, err := parseMessage(buf[:n])
+			if err != nil {
+				continue
+			}
+			for _, ep := range state.update(records) {
+				select {
+				case ch <- ep:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return ch, nil
+}
+
+// questions asks PTR for each service, and SRV/TXT or A for instances not resolved yet.
+func (s *browseState) questions() (qs []question) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, service := range s.services {
+		qs = append(qs, question{Name: service + "." + domain, Type: typePTR})
+	}
+	for fullname, inst := range s.instances {
+		if inst.host == "" {
+			qs = append(qs, question{Name: fullname, Type: typeSRV}, question{Name: fullname, Type: typeTXT})
+		} else if _, ok := s.hosts[inst.host]; !ok {
+			qs = append(qs, question{Name: inst.host, Type: typeA})
+		}
+	}
+	return
+}
+
+// update merges records, and returns the endpoints newly resolved.
+func (s *browseState) update(records []record) (resolved []Endpoint) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// PTR first, so SRV and TXT in the same message find their instance
+	for _, r := range records {
+		if r.Type != typePTR {
+			continue
+		}
+		for _, service := range s.services {
+			suffix := "." + service + "." + domain
+			if strings.EqualFold(r.Name, service+"."+domain) && strings.HasSuffix(r.Target, suffix) {
+				if _, ok := s.instances[r.Target]; !ok {
+					s.instances[r.Target] = &instance{
+						name:    strings.TrimSuffix(r.Target, suffix),
+						service: service,
+					}
+				}
+			}
+		}
+	}
+
+	for _, r := range records {
+		switch r.Type {
+		case typeSRV:
+			if inst, ok := s.instances[r.Name]; ok {
+				inst.host, inst.port = r.Target, int(r.Port)
+			}
+		case typeTXT:
+			if inst, ok := s.instances[r.Name]; ok {
+				inst.txt = r.Txt
+			}
+		case typeA:
+			s.hosts[r.Name] = r.IP
+		}
+	}
+
+	for _, inst := range s.instances {
+		ip, ok := s.hosts[inst.host]
+		if inst.emitted || inst.host == "" || !ok {
+			continue
+		}
+		inst.emitted = true
+		resolved = append(resolved, Endpoint{
+			Instance: inst.name,
+			Service:  inst.service,
+			Host:     inst.host,
+			IP:       ip,
+			Port:     inst.port,
+			Txt:      inst.txt,
+		})
+	}
+	return
+}
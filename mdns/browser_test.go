@@ -0,0 +1,80 @@
+package mdns
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeResponder answers queries on loopback like adbd: the PTR answer carries SRV
+// only, so the browser has to ask again for the A record.
+func fakeResponder(t *testing.T) *net.UDPAddr {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	const fullname = "adb-R58M12345-AbCdEf._adb-tls-connect._tcp.local."
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			n, from, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			var answers []record
+			qs := parseQuestions(buf[:n])
+			for _, q := range qs {
+				switch {
+				case q.Type == typePTR && q.Name == ServiceTlsConnect+"."+domain:
+					answers = append(answers,
+						record{Name: q.Name, Type: typePTR, TTL: 10, Target: fullname},
+						record{Name: fullname, Type: typeSRV, TTL: 10, Target: "Android.local.", Port: 37777})
+				case q.Type == typeA && q.Name == "Android.local.":
+					answers = append(answers, record{Name: q.Name, Type: typeA, TTL: 10, IP: net.IPv4(127, 0, 0, 1)})
+				}
+			}
+			if len(answers) > 0 {
+				conn.WriteToUDP(buildResponse(answers), from)
+			}
+		}
+	}()
+	return conn.LocalAddr().(*net.UDPAddr)
+}
+
+func parseQuestions(msg []byte) (qs []question) {
+	off := headerLen
+	for i := 0; i < int(msg[5]); i++ {
+		name, end, err := readName(msg, off)
+		if err != nil {
+			return
+		}
+		qs = append(qs, question{Name: name, Type: uint16(msg[end])<<8 | uint16(msg[end+1])})
+		off = end + 4
+	}
+	return
+}
+
+func TestBrowser_Browse(t *testing.T) {
+	b := &Browser{Addr: fakeResponder(t), Interval: time.Millisecond * 50}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	ch, err := b.Browse(ctx)
+	assert.NoError(t, err)
+
+	ep, ok := <-ch
+	assert.True(t, ok)
+	assert.Equal(t, "adb-R58M12345-AbCdEf", ep.Instance)
+	assert.Equal(t, ServiceTlsConnect, ep.Service)
+	assert.Equal(t, "127.0.0.1:37777", ep.Addr())
+
+	cancel()
+	for range ch {
+		t.Fatal("endpoint must be sent only once")
+	}
+}
@@ -0,0 +1,222 @@
+package mdns
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// DNS record types used by DNS-SD, see RFC 1035 and RFC 6763.
+const (
+	typeA    uint16 = 1
+	typePTR  uint16 = 12
+	typeTXT  uint16 = 16
+	typeAAAA uint16 = 28
+	typeSRV  uint16 = 33
+
+	classIN uint16 = 1
+	// classUnicastResponse is the top bit of qclass, the 'QU' bit of RFC 6762 section 5.4.
+	classUnicastResponse uint16 = 0x8000
+	// classCacheFlush is the top bit of rrclass in responses, RFC 6762 section 10.2.
+	classCacheFlush uint16 = 0x8000
+
+	flagResponse uint16 = 0x8400 // QR and AA
+
+	headerLen = 12
+)
+
+var errShortMessage = errors.New("short dns message")
+
+type question struct {
+	Name string
+	Type uint16
+}
+
+// record is a resource record, rdata is decoded for the types we care about.
+type record struct {
+	Name string
+	Type uint16
+	TTL  uint32
+
+	// PTR target, or SRV target host.
+	Target string
+	Port   uint16
+	IP     net.IP
+	Txt    []string
+}
+
+// appendName encodes name as a sequence of labels, without compression.
+func appendName(b []byte, name string) []byte {
+	name = strings.TrimSuffix(name, ".")
+	if name != "" {
+		for _, label := range strings.Split(name, ".") {
+			b = append(b, byte(len(label)))
+			b = append(b, label...)
+		}
+	}
+	return append(b, 0)
+}
+
+func appendHeader(b []byte, flags uint16, qdcount, ancount int) []byte {
+	var h [headerLen]byte
+	binary.BigEndian.PutUint16(h[2:], flags)
+	binary.BigEndian.PutUint16(h[4:], uint16(qdcount))
+	binary.BigEndian.PutUint16(h[6:], uint16(ancount))
+	return append(b, h[:]...)
+}
+
+// buildQuery builds a query message, asking for unicast responses.
+func buildQuery(questions []question) []byte {
+	b := appendHeader(nil, 0, len(questions), 0)
+	for _, q := range questions {
+		b = appendName(b, q.Name)
+		b = binary.BigEndian.AppendUint16(b, q.Type)
+		b = binary.BigEndian.AppendUint16(b, classIN|classUnicastResponse)
+	}
+	return b
+}
+
+// buildResponse builds a response message with records in the answer section.
+func buildResponse(records []record) []byte {
+	b := appendHeader(nil, flagResponse, 0, len(records))
+	for _, r := range records {
+		b = appendRecord(b, r)
+	}
+	return b
+}
+
+func appendRecord(b []byte, r record) []byte {
+	b = appendName(b, r.Name)
+	b = binary.BigEndian.AppendUint16(b, r.Type)
+	b = binary.BigEndian.AppendUint16(b, classIN|classCacheFlush)
+	b = binary.BigEndian.AppendUint32(b, r.TTL)
+
+	var rdata []byte
+	switch r.Type {
+	case typeA:
+		rdata = r.IP.To4()
+	case typeAAAA:
+		rdata = r.IP.To16()
+	case typePTR:
+		rdata = appendName(nil, r.Target)
+	case typeSRV:
+		rdata = make([]byte, 6) // priority, weight, port
+		binary.BigEndian.PutUint16(rdata[4:], r.Port)
+		rdata = appendName(rdata, r.Target)
+	case typeTXT:
+		for _, txt := range r.Txt {
+			rdata = append(rdata, byte(len(txt)))
+			rdata = append(rdata, txt...)
+		}
+	}
+	b = binary.BigEndian.AppendUint16(b, uint16(len(rdata)))
+	return append(b, rdata...)
+}
+
+// readName decodes a possibly compressed name at off, and returns it with a trailing dot,
+// and the offset right after the name.
+func readName(msg []byte, off int) (string, int, error) {
+	var labels []string
+	end := -1
+	// each pointer must go backward, so the number of jumps is bounded by len(msg)
+	for jumps := 0; jumps < len(msg); jumps++ {
+		if off >= len(msg) {
+			return "", 0, errShortMessage
+		}
+		length := int(msg[off])
+		switch {
+		case length == 0:
+			if end < 0 {
+				end = off + 1
+			}
+			return strings.Join(labels, ".") + ".", end, nil
+		case length&0xC0 == 0xC0:
+			if off+1 >= len(msg) {
+				return "", 0, errShortMessage
+			}
+			ptr := int(binary.BigEndian.Uint16(msg[off:]) & 0x3FFF)
+			if ptr >= off {
+				return "", 0, fmt.Errorf("invalid name pointer %d at %d", ptr, off)
+			}
+			if end < 0 {
+				end = off + 2
+			}
+			off = ptr
+		default:
+			if off+1+length > len(msg) {
+				return "", 0, errShortMessage
+			}
+			labels = append(labels, string(msg[off+1:off+1+length]))
+			off += 1 + length
+		}
+	}
+	return "", 0, errors.New("too many name pointers")
+}
+
+// parseMessage returns the records of the answer, authority and additional sections.
+func parseMessage(msg []byte) (records []record, err error) {
+	if len(msg) < headerLen {
+		return nil, errShortMessage
+	}
+	qdcount := int(binary.BigEndian.Uint16(msg[4:]))
+	rrcount := int(binary.BigEndian.Uint16(msg[6:])) +
+		int(binary.BigEndian.Uint16(msg[8:])) +
+		int(binary.BigEndian.Uint16(msg[10:]))
+
+	off := headerLen
+	for i := 0; i < qdcount; i++ {
+		if _, off, err = readName(msg, off); err != nil {
+			return nil, err
+		}
+		off += 4 // qtype, qclass
+	}
+
+	for i := 0; i < rrcount; i++ {
+		var r record
+		if r.Name, off, err = readName(msg, off); err != nil {
+			return nil, err
+		}
+		if off+10 > len(msg) {
+			return nil, errShortMessage
+		}
+		r.Type = binary.BigEndian.Uint16(msg[off:])
+		r.TTL = binary.BigEndian.Uint32(msg[off+4:])
+		rdlen := int(binary.BigEndian.Uint16(msg[off+8:]))
+		off += 10
+		if off+rdlen > len(msg) {
+			return nil, errShortMessage
+		}
+		rdata := msg[off : off+rdlen]
+
+		switch r.Type {
+		case typeA, typeAAAA:
+			r.IP = net.IP(append([]byte(nil), rdata...))
+		case typePTR:
+			if r.Target, _, err = readName(msg, off); err != nil {
+				return nil, err
+			}
+		case typeSRV:
+			if rdlen < 7 {
+				return nil, errShortMessage
+			}
+			r.Port = binary.BigEndian.Uint16(rdata[4:])
+			if r.Target, _, err = readName(msg, off+6); err != nil {
+				return nil, err
+			}
+		case typeTXT:
+			for j := 0; j < len(rdata); {
+				n := int(rdata[j])
+				if j+1+n > len(rdata) {
+					break
+				}
+				r.Txt = append(r.Txt, string(rdata[j+1:j+1+n]))
+				j += 1 + n
+			}
+		}
+		off += rdlen
+		records = append(records, r)
+	}
+	return records, nil
+}
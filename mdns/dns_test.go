@@ -0,0 +1,47 @@
+package mdns
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildQuery(t *testing.T) {
+	msg := buildQuery([]question{{Name: "_adb-tls-connect._tcp.local.", Type: typePTR}})
+	assert.Equal(t, []byte{
+		0, 0, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0,
+		16, '_', 'a', 'd', 'b', '-', 't', 'l', 's', '-', 'c', 'o', 'n', 'n', 'e', 'c', 't',
+		4, '_', 't', 'c', 'p',
+		5, 'l', 'o', 'c', 'a', 'l',
+		0,
+		0, 12, 0x80, 1,
+	}, msg)
+}
+
+func TestParseMessageRoundTrip(t *testing.T) {
+	records := []record{
+		{Name: "_adb-tls-connect._tcp.local.", Type: typePTR, TTL: 120, Target: "adb-R58M-x._adb-tls-connect._tcp.local."},
+		{Name: "adb-R58M-x._adb-tls-connect._tcp.local.", Type: typeSRV, TTL: 120, Target: "Android.local.", Port: 37777},
+		{Name: "adb-R58M-x._adb-tls-connect._tcp.local.", Type: typeTXT, TTL: 120, Txt: []string{"v=ADB_SECURE_SERVICE_VERSION"}},
+		{Name: "Android.local.", Type: typeA, TTL: 120, IP: net.IPv4(192, 168, 1, 23).To4()},
+	}
+	got, err := parseMessage(buildResponse(records))
+	assert.NoError(t, err)
+	assert.Equal(t, records, got)
+}
+
+func TestReadNameCompressed(t *testing.T) {
+	// "local." at 12, then "_tcp" + pointer to 12
+	msg := make([]byte, 12)
+	msg = append(msg, 5, 'l', 'o', 'c', 'a', 'l', 0)
+	msg = append(msg, 4, '_', 't', 'c', 'p', 0xC0, 12)
+	name, end, err := readName(msg, 19)
+	assert.NoError(t, err)
+	assert.Equal(t, "_tcp.local.", name)
+	assert.Equal(t, len(msg), end)
+
+	// pointer loop
+	_, _, err = readName([]byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0xC0, 12}, 12)
+	assert.Error(t, err)
+}
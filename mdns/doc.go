@@ -0,0 +1,6 @@
+// Package mdns discovers wireless adb devices on the local network, without relying on the adb server.
+// Android 11+ devices advertise _adb-tls-connect._tcp and _adb-tls-pairing._tcp with DNS-SD over mDNS,
+// see https://android.googlesource.com/platform/packages/modules/adb/+/refs/heads/main/adb_mdns.h.
+// Only the few records needed to resolve an instance to ip:port are implemented (PTR, SRV, TXT, A).
+// The resolved Endpoint.Addr can be passed to adb.Adb.Connect.
+package mdns
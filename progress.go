@@ -0,0 +1,283 @@
+package adb
+
+import (
+	"encoding/json"
+	"io"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/cheggaaa/pb"
+	"github.com/prife/goadb/wire"
+)
+
+// ProgressInterval is the minimum interval between two progress events of a transfer,
+// except for the events which change the count of files, end a file or report an error.
+const ProgressInterval = 100 * time.Millisecond
+
+// Progress is an event of a transfer, the same for pushes and pulls of files and directories.
+// A total is 0 when unknown, eg. the bytes of a directory or the files of PullDirTar.
+type Progress struct {
+	Op   string // "push" or "pull"
+	File string // the remote path of the current file
+
+	BytesDone  int64
+	BytesTotal int64
+	FilesDone  int64
+	FilesTotal int64
+
+	Rate float64       // bytes per second
+	ETA  time.Duration // 0 when unknown
+	// Err is the error of File, the transfer may go on with the next files.
+	Err error
+}
+
+// ProgressReporter receives the progress events of a transfer, one at a time.
+type ProgressReporter interface {
+	Report(p Progress)
+}
+
+// ProgressFunc is a ProgressReporter calling itself.
+type ProgressFunc func(p Progress)
+
+func (f ProgressFunc) Report(p Progress) {
+	f(p)
+}
+
+// ProgressChan returns a ProgressReporter sending the events to ch, without ever blocking the
+// transfer: while ch is full, the events are queued and sent by a goroutine, each one without
+// an error replacing the previous one in the queue. So the errors and the last event, which
+// counts all the files and bytes, are always delivered, the others may be dropped.
+// ch should be read until the last event, else the goroutine is leaked, and must not be
+// closed before: events may still be queued when the transfer returns.
+func ProgressChan(ch chan<- Progress) ProgressReporter {
+	return &progressChan{ch: ch}
+}
+
+type progressChan struct {
+	ch chan<- Progress
+
+	mu      sync.Mutex
+	pending []Progress
+	sending bool // by flush
+}
+
+func (r *progressChan) Report(p Progress) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.sending {
+		select {
+		case r.ch <- p:
+			return
+		default:
+		}
+	}
+	if n := len(r.pending); n > 0 && r.pending[n-1].Err == nil {
+		r.pending[n-1] = p
+	} else {
+		r.pending = append(r.pending, p)
+	}
+	if !r.sending {
+		r.sending = true
+		go r.flush()
+	}
+}
+
+// flush sends the pending events in order, until there are none left.
+func (r *progressChan) flush() {
+	for {
+		r.mu.Lock()
+		if len(r.pending) == 0 {
+			r.sending = false
+			r.mu.Unlock()
+			return
+		}
+		p := r.pending[0]
+		r.pending = r.pending[1:]
+		r.mu.Unlock()
+		r.ch <- p
+	}
+}
+
+// progressJSON is a line of JSONLinesProgress.
+type progressJSON struct {
+	Op         string  `json:"op"`
+	File       string  `json:"file,omitempty"`
+	BytesDone  int64   `json:"bytes_done"`
+	BytesTotal int64   `json:"bytes_total"`
+	FilesDone  int64   `json:"files_done"`
+	FilesTotal int64   `json:"files_total"`
+	Rate       float64 `json:"rate"`
+	ETA        float64 `json:"eta_seconds"`
+	Err        string  `json:"error,omitempty"`
+}
+
+// JSONLinesProgress returns a ProgressReporter writing each event to w as a line of JSON, eg.
+//
+//	{"op":"push","file":"/sdcard/a.apk","bytes_done":65536,"bytes_total":131072,...,"eta_seconds":0.5}
+func JSONLinesProgress(w io.Writer) ProgressReporter {
+	var mu sync.Mutex
+	enc := json.NewEncoder(w)
+	return ProgressFunc(func(p Progress) {
+		line := progressJSON{
+			Op:         p.Op,
+			File:       p.File,
+			BytesDone:  p.BytesDone,
+			BytesTotal: p.BytesTotal,
+			FilesDone:  p.FilesDone,
+			FilesTotal: p.FilesTotal,
+			Rate:       p.Rate,
+			ETA:        p.ETA.Seconds(),
+		}
+		if p.Err != nil {
+			line.Err = p.Err.Error()
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		enc.Encode(line)
+	})
+}
+
+// PBProgress returns a ProgressReporter updating bar, which is started and finished by the
+// caller. The bar counts the bytes if their total is known, the files otherwise, and shows
+// the name of the current file after it.
+func PBProgress(bar *pb.ProgressBar) ProgressReporter {
+	return ProgressFunc(func(p Progress) {
+		switch {
+		case p.BytesTotal > 0:
+			bar.SetTotal64(p.BytesTotal)
+			bar.Set64(p.BytesDone)
+		case p.FilesTotal > 0:
+			bar.SetTotal64(p.FilesTotal)
+			bar.Set64(p.FilesDone)
+		}
+		if p.File != "" {
+			bar.Postfix(" " + path.Base(p.File))
+		}
+	})
+}
+
+// progressTracker completes the events with the rate and ETA, and throttles them.
+type progressTracker struct {
+	r          ProgressReporter
+	startTime  time.Time
+	lastReport time.Time
+}
+
+// report reports p, unless the last event was less than ProgressInterval ago and p does
+// not end a file, which is told by final.
+func (t *progressTracker) report(p Progress, final bool) {
+	now := time.Now()
+	if t.startTime.IsZero() {
+		t.startTime = now
+	}
+	if !final && p.Err == nil && now.Sub(t.lastReport) < ProgressInterval {
+		return
+	}
+	t.lastReport = now
+
+	elapsed := now.Sub(t.startTime)
+	if p.Rate == 0 && p.BytesDone > 0 && elapsed > 0 {
+		p.Rate = float64(p.BytesDone) / elapsed.Seconds()
+	}
+	switch {
+	case p.BytesTotal > 0 && p.Rate > 0:
+		p.ETA = time.Duration(float64(p.BytesTotal-p.BytesDone) / p.Rate * float64(time.Second))
+	case p.FilesTotal > 0 && p.FilesDone > 0:
+		p.ETA = elapsed * time.Duration(p.FilesTotal-p.FilesDone) / time.Duration(p.FilesDone)
+	}
+	t.r.Report(p)
+}
+
+// FileProgressHandler adapts r to the handler of a single file transfer, like PushFileCtx,
+// PushReader, PullWriter or PushFileResumable. op is "push" or "pull".
+func FileProgressHandler(r ProgressReporter, op, remote string) wire.SyncFileHandler {
+	t := &progressTracker{r: r}
+	return func(totalSize, sentSize uint64, percent, speedMBPerSecond float64) {
+		p := Progress{Op: op, File: remote, BytesDone: int64(sentSize), BytesTotal: int64(totalSize), FilesTotal: 1}
+		final := totalSize > 0 && sentSize >= totalSize
+		if final {
+			p.FilesDone = 1
+		}
+		t.report(p, final)
+	}
+}
+
+// PullProgressHandler adapts r to the handler of PullFileCtx.
+func PullProgressHandler(r ProgressReporter, remote string) func(total, sent int64, duration time.Duration) {
+	h := FileProgressHandler(r, "pull", remote)
+	return func(total, sent int64, duration time.Duration) {
+		h(uint64(total), uint64(sent), 0, 0)
+	}
+}
+
+// DirProgressHandler adapts r to the handler of a directory or multi-file transfer, like
+// PushDirCtx or PushDirTar. The bytes are not known, the rate is the one reported by the
+// transfer. FilesDone is sentFiles of the handler, which counts the current file from its
+// start for PushDirCtx. The Progress options of PushDirCtx, PullDirCtx, SyncDirCtx and
+// PushFiles report the bytes too.
+func DirProgressHandler(r ProgressReporter, op string) wire.SyncHandler {
+	t := &progressTracker{r: r}
+	var lastFiles uint64
+	return func(totalFiles, sentFiles uint64, current string, percent, speed float64, err error) {
+		p := Progress{Op: op, File: current, FilesDone: int64(sentFiles), FilesTotal: int64(totalFiles),
+			Rate: speed * 1024 * 1024, Err: err}
+		// a change of the count is never throttled
+		t.report(p, percent >= 100 || sentFiles != lastFiles)
+		lastFiles = sentFiles
+	}
+}
+
+// dirProgress reports to r the progress of a transfer whose files and bytes are known before
+// it starts. A nil *dirProgress reports nothing, its calls are serialized by the transfer.
+type dirProgress struct {
+	t  progressTracker
+	op string
+	p  Progress
+}
+
+// newDirProgress returns nil if r is nil, the totals may be set later by setTotal.
+func newDirProgress(r ProgressReporter, op string, files, bytes int64) *dirProgress {
+	if r == nil {
+		return nil
+	}
+	return &dirProgress{t: progressTracker{r: r}, op: op, p: Progress{Op: op, FilesTotal: files, BytesTotal: bytes}}
+}
+
+// setTotal sets the totals once known, eg. after the scan of a tree.
+func (d *dirProgress) setTotal(files, bytes int64) {
+	if d == nil {
+		return
+	}
+	d.p.FilesTotal, d.p.BytesTotal = files, bytes
+}
+
+// sent counts n bytes of file.
+func (d *dirProgress) sent(file string, n int64) {
+	if d == nil {
+		return
+	}
+	d.p.File = file
+	d.p.BytesDone += n
+	d.t.report(d.p, false)
+}
+
+// done counts file, whose bytes were sent.
+func (d *dirProgress) done(file string) {
+	if d == nil {
+		return
+	}
+	d.p.File = file
+	d.p.FilesDone++
+	d.t.report(d.p, true)
+}
+
+// fail reports the error of file, which is not counted.
+func (d *dirProgress) fail(file string, err error) {
+	if d == nil {
+		return
+	}
+	p := d.p
+	p.File, p.Err = file, err
+	d.t.report(p, true)
+}
@@ -0,0 +1,157 @@
+package adb
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cheggaaa/pb"
+	"github.com/prife/goadb/wire"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJSONLinesProgress(t *testing.T) {
+	f := newFakeDevice(t)
+	var out bytes.Buffer
+	content := strings.Repeat("x", wire.SyncMaxChunkSize*2)
+	h := FileProgressHandler(JSONLinesProgress(&out), "push", "/data/a.bin")
+	err := f.Device().PushReader(context.Background(), strings.NewReader(content), int64(len(content)), "/data/a.bin", 0644, someMtime, h)
+	assert.NoError(t, err)
+
+	// the first chunk, the second one is throttled but ends the file
+	var lines []map[string]any
+	scanner := bufio.NewScanner(&out)
+	for scanner.Scan() {
+		var line map[string]any
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &line))
+		lines = append(lines, line)
+	}
+	assert.Len(t, lines, 2)
+	last := lines[len(lines)-1]
+	assert.Equal(t, "push", last["op"])
+	assert.Equal(t, "/data/a.bin", last["file"])
+	assert.Equal(t, float64(len(content)), last["bytes_done"])
+	assert.Equal(t, float64(len(content)), last["bytes_total"])
+	assert.Equal(t, float64(1), last["files_done"])
+	assert.Equal(t, float64(0), last["eta_seconds"])
+	assert.NotContains(t, last, "error")
+}
+
+func TestDirProgressHandler(t *testing.T) {
+	f := newFakeDevice(t)
+	local := t.TempDir()
+	writeLocalFile(t, filepath.Join(local, "a.txt"), "hello", someMtime)
+	writeLocalFile(t, filepath.Join(local, "b.txt"), "world", someMtime)
+	files := []PushItem{
+		{Local: filepath.Join(local, "a.txt"), Remote: "/data/a.txt"},
+		{Local: filepath.Join(local, "none"), Remote: "/data/none"},
+		{Local: filepath.Join(local, "b.txt"), Remote: "/data/b.txt"},
+	}
+
+	ch := make(chan Progress, 10)
+	err := f.Device().PushFiles(context.Background(), files, ParallelPushOptions{
+		Conns:   1,
+		Handler: DirProgressHandler(ProgressChan(ch), "push"),
+	})
+	assert.Error(t, err)
+	close(ch)
+
+	var errs int
+	var last Progress
+	for p := range ch {
+		assert.Equal(t, "push", p.Op)
+		assert.Equal(t, int64(3), p.FilesTotal)
+		if p.Err != nil {
+			errs++
+			assert.Equal(t, "/data/none", p.File)
+		}
+		last = p
+	}
+	assert.Equal(t, 1, errs)
+	assert.Equal(t, int64(2), last.FilesDone)
+}
+
+func TestDevice_DirProgress(t *testing.T) {
+	f := newFakeDevice(t)
+	d := f.Device()
+	local := t.TempDir()
+	writeLocalFile(t, filepath.Join(local, "res", "a.txt"), "hello", someMtime)
+	writeLocalFile(t, filepath.Join(local, "res", "dir", "b.txt"), "world!", someMtime)
+
+	// the last event counts all the bytes and files
+	var events []Progress
+	r := ProgressFunc(func(p Progress) { events = append(events, p) })
+	assertDone := func(op string) {
+		t.Helper()
+		assert.NotEmpty(t, events)
+		last := events[len(events)-1]
+		assert.Equal(t, op, last.Op)
+		assert.NoError(t, last.Err)
+		assert.Equal(t, int64(11), last.BytesDone)
+		assert.Equal(t, int64(11), last.BytesTotal)
+		assert.Equal(t, int64(2), last.FilesDone)
+		assert.Equal(t, int64(2), last.FilesTotal)
+		events = nil
+	}
+
+	assert.NoError(t, d.PushDirCtx(context.Background(), filepath.Join(local, "res"), "/data/res", PushDirOptions{Progress: r}))
+	assertDone("push")
+
+	assert.NoError(t, d.PullDirCtx(context.Background(), "/data/res", filepath.Join(local, "pulled"), PullDirOptions{Progress: r}))
+	assertDone("pull")
+
+	f.WriteFile(t, "data/sync/old.txt", "old", someMtime)
+	_, err := d.SyncDir(filepath.Join(local, "res"), "/data/sync", SyncDirOptions{Progress: r})
+	assert.NoError(t, err)
+	assertDone("push")
+}
+
+func TestProgressChan(t *testing.T) {
+	ch := make(chan Progress, 1)
+	r := ProgressChan(ch)
+	// nothing reads ch, the transfer isn't blocked
+	for i := 1; i <= 100; i++ {
+		var err error
+		if i%10 == 0 {
+			err = fmt.Errorf("failed %d", i)
+		}
+		r.Report(Progress{BytesDone: int64(i), Err: err})
+	}
+	r.Report(Progress{BytesDone: 101})
+
+	// the errors and the last event are delivered in order, the others may be dropped
+	var errs []string
+	var last int64
+	for last != 101 {
+		select {
+		case p := <-ch:
+			assert.Greater(t, p.BytesDone, last)
+			last = p.BytesDone
+			if p.Err != nil {
+				errs = append(errs, p.Err.Error())
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("last event not delivered")
+		}
+	}
+	assert.Len(t, errs, 10)
+	assert.Equal(t, "failed 100", errs[9])
+}
+
+func TestPBProgress(t *testing.T) {
+	bar := pb.New(0)
+	r := PBProgress(bar)
+	r.Report(Progress{File: "/data/dir/a.txt", FilesDone: 1, FilesTotal: 4})
+	assert.Equal(t, int64(4), bar.Total)
+	assert.Equal(t, int64(1), bar.Get())
+
+	r.Report(Progress{File: "/data/a.bin", BytesDone: 100, BytesTotal: 1000})
+	assert.Equal(t, int64(1000), bar.Total)
+	assert.Equal(t, int64(100), bar.Get())
+}
@@ -0,0 +1,69 @@
+package adb
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/prife/goadb/wire"
+)
+
+// Wire types of the protobuf encoding, see https://protobuf.dev/programming-guides/encoding/
+const (
+	protoVarint = 0
+	protoI64    = 1
+	protoLen    = 2
+	protoI32    = 5
+)
+
+// protoField is one field of a protobuf message, Varint is set for varint fields and
+// Bytes for length-delimited fields (strings, bytes and embedded messages).
+type protoField struct {
+	Num    int
+	Type   int
+	Varint uint64
+	Bytes  []byte
+}
+
+// parseProto walks the fields of a protobuf message. It is just enough to decode the few
+// messages of the adb server, without depending on a protobuf runtime: unknown fields are
+// passed to fn like the others, which ignores them.
+func parseProto(b []byte, fn func(f protoField) error) error {
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 {
+			return fmt.Errorf("%w: invalid protobuf field key", wire.ErrParse)
+		}
+		b = b[n:]
+
+		f := protoField{Num: int(key >> 3), Type: int(key & 7)}
+		switch f.Type {
+		case protoVarint:
+			if f.Varint, n = binary.Uvarint(b); n <= 0 {
+				return fmt.Errorf("%w: invalid protobuf varint of field %d", wire.ErrParse, f.Num)
+			}
+			b = b[n:]
+		case protoI64, protoI32:
+			size := 8
+			if f.Type == protoI32 {
+				size = 4
+			}
+			if len(b) < size {
+				return fmt.Errorf("%w: short protobuf field %d", wire.ErrParse, f.Num)
+			}
+			f.Bytes, b = b[:size], b[size:]
+		case protoLen:
+			length, n := binary.Uvarint(b)
+			if n <= 0 || uint64(len(b)-n) < length {
+				return fmt.Errorf("%w: short protobuf field %d", wire.ErrParse, f.Num)
+			}
+			f.Bytes, b = b[n:n+int(length)], b[n+int(length):]
+		default:
+			return fmt.Errorf("%w: unsupported protobuf wire type %d of field %d", wire.ErrParse, f.Type, f.Num)
+		}
+
+		if err := fn(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package adb
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/prife/goadb/wire"
+	"github.com/stretchr/testify/assert"
+)
+
+// appendProtoVarint and appendProtoBytes encode a field, to build messages of the server.
+func appendProtoVarint(b []byte, num int, v uint64) []byte {
+	b = binary.AppendUvarint(b, uint64(num)<<3|protoVarint)
+	return binary.AppendUvarint(b, v)
+}
+
+func appendProtoBytes(b []byte, num int, v []byte) []byte {
+	b = binary.AppendUvarint(b, uint64(num)<<3|protoLen)
+	b = binary.AppendUvarint(b, uint64(len(v)))
+	return append(b, v...)
+}
+
+func TestParseProto(t *testing.T) {
+	msg := appendProtoVarint(nil, 1, 300)
+	msg = appendProtoBytes(msg, 4, []byte("arm64"))
+	msg = append(msg, 0x2d, 1, 2, 3, 4) // field 5, fixed32
+
+	var fields []protoField
+	err := parseProto(msg, func(f protoField) error {
+		fields = append(fields, f)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []protoField{
+		{Num: 1, Type: protoVarint, Varint: 300},
+		{Num: 4, Type: protoLen, Bytes: []byte("arm64")},
+		{Num: 5, Type: protoI32, Bytes: []byte{1, 2, 3, 4}},
+	}, fields)
+
+	err = parseProto(appendProtoBytes(nil, 1, []byte("abc"))[:3], func(protoField) error { return nil })
+	assert.ErrorIs(t, err, wire.ErrParse)
+}
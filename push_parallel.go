@@ -0,0 +1,302 @@
+package adb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prife/goadb/wire"
+)
+
+// DefaultPushConns is the number of sync connections of PushFiles, when not set.
+const DefaultPushConns = 4
+
+// PushItem is a local file pushed to Remote by PushFiles.
+type PushItem struct {
+	Local  string
+	Remote string
+}
+
+// ParallelPushOptions are the options of PushFiles and PushDirParallel.
+type ParallelPushOptions struct {
+	// Conns is the number of sync connections, DefaultPushConns if 0.
+	Conns int
+	// Handler reports the aggregate progress: percent is the percent of all bytes, speed the
+	// overall speed in MB/s, and current the last file sent. It is also called for each failed file.
+	// Calls are serialized.
+	Handler wire.SyncHandler
+	// Progress receives the bytes and files pushed, of the sizes of the files at the start.
+	Progress ProgressReporter
+}
+
+// PushFiles pushes files concurrently over opts.Conns sync connections, which mostly helps
+// with many small files, where the round trips of each file dominate.
+// Each connection holds one chunk of data, whatever the number and size of files.
+// Files which fail are reported to the handler, and their errors are returned joined.
+// When ctx is done, the connections are closed, so the transfers in progress stop too.
+func (c *Device) PushFiles(ctx context.Context, files []PushItem, opts ParallelPushOptions) error {
+	conns := opts.Conns
+	if conns <= 0 {
+		conns = DefaultPushConns
+	}
+	if conns > len(files) {
+		conns = len(files)
+	}
+
+	e := &pushEngine{
+		device:    c,
+		files:     files,
+		handler:   opts.Handler,
+		conns:     make(map[*wire.SyncConn]struct{}),
+		startTime: time.Now(),
+	}
+	for _, f := range files {
+		if info, err := os.Stat(f.Local); err == nil {
+			e.totalSize += uint64(info.Size())
+		}
+	}
+	e.prog = newDirProgress(opts.Progress, "push", int64(len(files)), int64(e.totalSize))
+	remotes := make([]string, len(files))
+	for i, f := range files {
+		remotes[i] = f.Remote
+	}
+	if err := c.filesPreflight(remotes, int64(e.totalSize)); err != nil {
+		return fmt.Errorf("push failed: %w", err)
+	}
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			e.closeConns()
+		case <-stop:
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < conns; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			e.work(ctx)
+		}()
+	}
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("push failed by ctx done: %w", err)
+	}
+	// all workers failed to connect
+	if left := len(files) - int(atomic.LoadInt64(&e.next)); left > 0 {
+		e.errs = append(e.errs, fmt.Errorf("push: %d files not pushed", left))
+	}
+	return errors.Join(e.errs...)
+}
+
+// PushDirParallel is PushDir over several connections, see PushFiles.
+func (c *Device) PushDirParallel(ctx context.Context, local, remote string, withSrcDir bool, opts ParallelPushOptions) error {
+	if err := MakeDirs(c, local, remote, withSrcDir); err != nil {
+		return err
+	}
+	local, err := filepath.Abs(local)
+	if err != nil {
+		return err
+	}
+	if withSrcDir {
+		remote = remote + "/" + filepath.Base(local)
+	}
+
+	var files []PushItem
+	err = filepath.WalkDir(local, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		// ignore special files, like PushDir
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, _ := filepath.Rel(local, path)
+		files = append(files, PushItem{Local: path, Remote: remote + "/" + filepath.ToSlash(rel)})
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("walk dir %s failed: %w", local, err)
+	}
+	return c.PushFiles(ctx, files, opts)
+}
+
+type pushEngine struct {
+	device    *Device
+	files     []PushItem
+	handler   wire.SyncHandler
+	prog      *dirProgress
+	startTime time.Time
+	totalSize uint64
+	next      int64 // index of the next file to push
+
+	mu        sync.Mutex
+	conns     map[*wire.SyncConn]struct{}
+	closed    bool
+	errs      []error
+	sentFiles uint64
+	sentSize  uint64
+	percent   int
+}
+
+// work pushes files until there are none left, ctx is done, or it can't connect.
+func (e *pushEngine) work(ctx context.Context) {
+	var conn *wire.SyncConn
+	defer func() {
+		if conn != nil {
+			e.release(conn)
+		}
+	}()
+	buf := make([]byte, wire.SyncMaxChunkSize)
+
+	for ctx.Err() == nil {
+		i := int(atomic.AddInt64(&e.next, 1)) - 1
+		if i >= len(e.files) {
+			return
+		}
+		f := e.files[i]
+
+		if conn == nil {
+			var err error
+			if conn, err = e.device.NewSyncConn(); err != nil {
+				e.fail(f, err)
+				return
+			}
+			if !e.acquire(conn) {
+				return
+			}
+		}
+		if broken, err := e.push(conn, f, buf); err != nil {
+			// adbd ends the sync session after a failure
+			if broken {
+				e.release(conn)
+				conn = nil
+			}
+			if ctx.Err() == nil {
+				e.fail(f, err)
+			}
+			continue
+		}
+		e.done(f)
+	}
+}
+
+// push sends f, broken is true if conn can't be used anymore.
+func (e *pushEngine) push(conn *wire.SyncConn, f PushItem, buf []byte) (broken bool, err error) {
+	file, err := os.Open(f.Local)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return false, err
+	}
+	if !info.Mode().IsRegular() {
+		return false, fmt.Errorf("not regular file: %s", f.Local)
+	}
+
+	writer, err := conn.Send(f.Remote, info.Mode().Perm(), info.ModTime())
+	if err != nil {
+		return true, err
+	}
+	for {
+		n, err := file.Read(buf)
+		if n > 0 {
+			if _, err := writer.Write(buf[:n]); err != nil {
+				return true, err
+			}
+			e.sent(f, uint64(n))
+		}
+		if err == io.EOF {
+			err = writer.CopyDone()
+			return err != nil, err
+		} else if err != nil {
+			// the remote file is left partial, DONE can't be sent
+			return true, err
+		}
+	}
+}
+
+// acquire registers conn to be closed when ctx is done, it returns false if it already is.
+func (e *pushEngine) acquire(conn *wire.SyncConn) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.closed {
+		conn.Close()
+		return false
+	}
+	e.conns[conn] = struct{}{}
+	return true
+}
+
+func (e *pushEngine) release(conn *wire.SyncConn) {
+	e.mu.Lock()
+	delete(e.conns, conn)
+	e.mu.Unlock()
+	conn.Close()
+}
+
+func (e *pushEngine) closeConns() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.closed = true
+	for conn := range e.conns {
+		conn.Close()
+	}
+}
+
+func (e *pushEngine) fail(f PushItem, err error) {
+	err = fmt.Errorf("push %s: %w", f.Remote, err)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.errs = append(e.errs, err)
+	if e.handler != nil {
+		e.handler(uint64(len(e.files)), e.sentFiles, f.Remote, float64(e.percent), 0, err)
+	}
+	e.prog.fail(f.Remote, err)
+}
+
+// sent reports the progress when the percent of all bytes changes.
+func (e *pushEngine) sent(f PushItem, n uint64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.sentSize += n
+	e.prog.sent(f.Remote, int64(n))
+	if e.totalSize == 0 {
+		return
+	}
+	percent := int(e.sentSize * 100 / e.totalSize)
+	if percent == e.percent || percent >= 100 {
+		return
+	}
+	e.percent = percent
+	if e.handler != nil {
+		e.handler(uint64(len(e.files)), e.sentFiles, f.Remote, float64(percent), speedMBPerSecond(e.sentSize, e.startTime), nil)
+	}
+}
+
+func (e *pushEngine) done(f PushItem) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.sentFiles++
+	if e.sentFiles == uint64(len(e.files)) {
+		e.percent = 100
+	}
+	if e.handler != nil {
+		e.handler(uint64(len(e.files)), e.sentFiles, f.Remote, float64(e.percent), speedMBPerSecond(e.sentSize, e.startTime), nil)
+	}
+	e.prog.done(f.Remote)
+}
@@ -0,0 +1,113 @@
+package adb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDevice_PushFiles(t *testing.T) {
+	f := newFakeDevice(t)
+	local := t.TempDir()
+	var files []PushItem
+	for i := 0; i < 20; i++ {
+		name := fmt.Sprintf("f%02d.txt", i)
+		writeLocalFile(t, filepath.Join(local, name), strings.Repeat("x", i*1000), someMtime)
+		files = append(files, PushItem{Local: filepath.Join(local, name), Remote: "/data/" + name})
+	}
+	files = append(files, PushItem{Local: filepath.Join(local, "missing"), Remote: "/data/missing"})
+
+	var lastSent uint64
+	var lastPercent float64
+	var failed []string
+	err := f.Device().PushFiles(context.Background(), files, ParallelPushOptions{
+		Conns: 3,
+		Handler: func(totalFiles, sentFiles uint64, current string, percent, speed float64, err error) {
+			assert.Equal(t, uint64(21), totalFiles)
+			assert.GreaterOrEqual(t, percent, lastPercent)
+			lastSent, lastPercent = sentFiles, percent
+			if err != nil {
+				failed = append(failed, current)
+			}
+		},
+	})
+	assert.Error(t, err)
+	assert.True(t, errors.Is(err, os.ErrNotExist))
+	assert.Equal(t, []string{"/data/missing"}, failed)
+	assert.Equal(t, uint64(20), lastSent)
+
+	for i := 0; i < 20; i++ {
+		data, err := os.ReadFile(f.local(fmt.Sprintf("data/f%02d.txt", i)))
+		assert.NoError(t, err)
+		assert.Len(t, data, i*1000)
+	}
+	var dials int
+	for _, s := range f.Services() {
+		if s == "sync:" {
+			dials++
+		}
+	}
+	assert.LessOrEqual(t, dials, 3)
+}
+
+func TestDevice_PushFilesReuseConn(t *testing.T) {
+	f := newFakeDevice(t)
+	local := t.TempDir()
+	var files []PushItem
+	for i := 0; i < 5; i++ {
+		name := fmt.Sprintf("f%d.txt", i)
+		writeLocalFile(t, filepath.Join(local, name), "hello", someMtime)
+		files = append(files, PushItem{Local: filepath.Join(local, name), Remote: "/data/" + name})
+	}
+	err := f.Device().PushFiles(context.Background(), files, ParallelPushOptions{Conns: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, strings.Count(strings.Join(f.Services(), "\n"), "sync:\n"))
+}
+
+func TestDevice_PushDirParallel(t *testing.T) {
+	f := newFakeDevice(t)
+	local := t.TempDir()
+	writeLocalFile(t, filepath.Join(local, "res", "a.txt"), "hello", someMtime)
+	writeLocalFile(t, filepath.Join(local, "res", "dir", "b.txt"), "world", someMtime)
+
+	err := f.Device().PushDirParallel(context.Background(), filepath.Join(local, "res"), "/data", true, ParallelPushOptions{})
+	assert.NoError(t, err)
+	data, err := os.ReadFile(f.local("data/res/dir/b.txt"))
+	assert.NoError(t, err)
+	assert.Equal(t, "world", string(data))
+	info, err := os.Stat(f.local("data/res/a.txt"))
+	assert.NoError(t, err)
+	assert.Equal(t, someMtime, info.ModTime().UTC())
+}
+
+func TestDevice_PushFilesCancel(t *testing.T) {
+	f := newFakeDevice(t)
+	local := t.TempDir()
+	var files []PushItem
+	for i := 0; i < 50; i++ {
+		name := fmt.Sprintf("f%02d.txt", i)
+		writeLocalFile(t, filepath.Join(local, name), "hello", someMtime)
+		files = append(files, PushItem{Local: filepath.Join(local, name), Remote: "/data/" + name})
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var sent uint64
+	err := f.Device().PushFiles(ctx, files, ParallelPushOptions{
+		Conns: 2,
+		Handler: func(totalFiles, sentFiles uint64, current string, percent, speed float64, err error) {
+			sent = sentFiles
+			if sentFiles == 5 {
+				cancel()
+			}
+		},
+	})
+	assert.True(t, errors.Is(err, context.Canceled))
+	assert.Less(t, sent, uint64(50))
+}
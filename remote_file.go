@@ -0,0 +1,189 @@
+package adb
+
+import (
+	"container/list"
+	"fmt"
+	"io"
+	"io/fs"
+	"sync"
+)
+
+const (
+	// RemoteFileBlockSize is the block size of the ranged reads of RemoteFile.
+	RemoteFileBlockSize = 64 * 1024
+	// RemoteFileCacheBlocks is the number of blocks cached by a RemoteFile.
+	RemoteFileCacheBlocks = 64
+)
+
+// RemoteFile reads a remote file at any offset, without pulling it whole: the blocks are read
+// by dd over exec-out, and the last ones are cached. It implements io.ReaderAt, io.ReadSeeker
+// and io.Closer, eg. for archive/zip.NewReader on an APK. ReadAt is safe for concurrent use.
+type RemoteFile struct {
+	device *Device
+	path   string
+	size   int64
+
+	mu     sync.Mutex
+	blocks map[int64]*list.Element // of *remoteBlock, by index
+	lru    *list.List
+	closed bool
+
+	// of Read and Seek
+	offset int64
+}
+
+type remoteBlock struct {
+	index int64
+	data  []byte
+}
+
+// OpenReaderAt opens the remote file path for random access, its size is the one at open.
+func (c *Device) OpenReaderAt(path string) (*RemoteFile, error) {
+	size, _, _, err := c.remoteFileStat(path)
+	if err != nil {
+		return nil, err
+	}
+	return &RemoteFile{
+		device: c,
+		path:   path,
+		size:   size,
+		blocks: make(map[int64]*list.Element),
+		lru:    list.New(),
+	}, nil
+}
+
+// Size returns the size of the file.
+func (f *RemoteFile) Size() int64 {
+	return f.size
+}
+
+// ReadAt reads len(p) bytes at off, like io.ReaderAt.
+func (f *RemoteFile) ReadAt(p []byte, off int64) (n int, err error) {
+	if off < 0 {
+		return 0, fmt.Errorf("read %s: negative offset", f.path)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return 0, fmt.Errorf("read %s: %w", f.path, fs.ErrClosed)
+	}
+
+	for n < len(p) && off < f.size {
+		index := off / RemoteFileBlockSize
+		block, err := f.block(index, (off+int64(len(p)-n)-1)/RemoteFileBlockSize)
+		if err != nil {
+			return n, fmt.Errorf("read %s: %w", f.path, err)
+		}
+		copied := copy(p[n:], block[off-index*RemoteFileBlockSize:])
+		n += copied
+		off += int64(copied)
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// block returns the block index from the cache, or reads it with the next missing blocks
+// up to last, in a single dd.
+func (f *RemoteFile) block(index, last int64) ([]byte, error) {
+	if e, ok := f.blocks[index]; ok {
+		f.lru.MoveToFront(e)
+		return e.Value.(*remoteBlock).data, nil
+	}
+
+	// no block past the end of the file
+	if end := (f.size - 1) / RemoteFileBlockSize; last > end {
+		last = end
+	}
+	count := int64(1)
+	for index+count <= last && count < RemoteFileCacheBlocks {
+		if _, ok := f.blocks[index+count]; ok {
+			break
+		}
+		count++
+	}
+	cmd := fmt.Sprintf("dd if=%s bs=%d skip=%d count=%d 2>/dev/null", shellQuote(f.path), RemoteFileBlockSize, index, count)
+	conn, err := f.device.openExec(cmd)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	// the last block of the file is short
+	want := count * RemoteFileBlockSize
+	if end := (index + count) * RemoteFileBlockSize; end > f.size {
+		want -= end - f.size
+	}
+	data := make([]byte, want)
+	if _, err = io.ReadFull(conn, data); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			// dd stopped early, tell why
+			if rerr := f.device.checkReadable("read", f.path); rerr != nil {
+				return nil, rerr
+			}
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+
+	for i := int64(0); i < count; i++ {
+		end := (i + 1) * RemoteFileBlockSize
+		if end > want {
+			end = want
+		}
+		f.add(&remoteBlock{index: index + i, data: data[i*RemoteFileBlockSize : end]})
+	}
+	return f.blocks[index].Value.(*remoteBlock).data, nil
+}
+
+// add caches b, evicting the least recently used block.
+func (f *RemoteFile) add(b *remoteBlock) {
+	f.blocks[b.index] = f.lru.PushFront(b)
+	if f.lru.Len() > RemoteFileCacheBlocks {
+		e := f.lru.Back()
+		f.lru.Remove(e)
+		delete(f.blocks, e.Value.(*remoteBlock).index)
+	}
+}
+
+// Read reads at the offset of Read and Seek, like io.Reader.
+func (f *RemoteFile) Read(p []byte) (int, error) {
+	if f.offset >= f.size {
+		return 0, io.EOF
+	}
+	n, err := f.ReadAt(p, f.offset)
+	f.offset += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+// Seek sets the offset of Read, like io.Seeker.
+func (f *RemoteFile) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += f.size
+	default:
+		return 0, fmt.Errorf("seek %s: invalid whence %d", f.path, whence)
+	}
+	if offset < 0 {
+		return 0, fmt.Errorf("seek %s: negative position", f.path)
+	}
+	f.offset = offset
+	return offset, nil
+}
+
+// Close releases the cache.
+func (f *RemoteFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.closed = true
+	f.blocks = nil
+	f.lru.Init()
+	return nil
+}
@@ -0,0 +1,166 @@
+package adb
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"io/fs"
+	"math/rand"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/prife/goadb/wire"
+	"github.com/stretchr/testify/assert"
+)
+
+var ddRegex = regexp.MustCompile(`^exec:dd if='([^']*)' bs=(\d+) skip=(\d+)(?: count=(\d+))?`)
+
+// serveDD plays `stat -c` and dd on f, and counts the dd.
+func serveDD(f *fakeDevice, dds *int) func(service string, conn *wire.Conn) {
+	stat := serveResumable(f, new(bool))
+	return func(service string, conn *wire.Conn) {
+		m := ddRegex.FindStringSubmatch(service)
+		if m == nil {
+			stat(service, conn)
+			return
+		}
+		*dds++
+		data, err := os.ReadFile(f.local(m[1]))
+		if info, serr := os.Stat(f.local(m[1])); err != nil || serr != nil || info.Mode().Perm()&0400 == 0 {
+			return
+		}
+		bs, _ := strconv.Atoi(m[2])
+		skip, _ := strconv.Atoi(m[3])
+		start, end := skip*bs, len(data)
+		if m[4] != "" {
+			count, _ := strconv.Atoi(m[4])
+			end = (skip + count) * bs
+		}
+		if start > len(data) {
+			start = len(data)
+		}
+		if end > len(data) {
+			end = len(data)
+		}
+		conn.Write(data[start:end])
+	}
+}
+
+func TestRemoteFile_ReadAt(t *testing.T) {
+	f := newFakeDevice(t)
+	var dds int
+	f.Service = serveDD(f, &dds)
+	content := make([]byte, RemoteFileBlockSize*3+100)
+	rand.New(rand.NewSource(1)).Read(content)
+	f.WriteFile(t, "data/a.bin", string(content), someMtime)
+
+	rf, err := f.Device().OpenReaderAt("/data/a.bin")
+	assert.NoError(t, err)
+	defer rf.Close()
+	assert.Equal(t, int64(len(content)), rf.Size())
+
+	// across blocks, in a single dd
+	p := make([]byte, RemoteFileBlockSize+10)
+	n, err := rf.ReadAt(p, RemoteFileBlockSize-5)
+	assert.NoError(t, err)
+	assert.Equal(t, len(p), n)
+	assert.True(t, bytes.Equal(content[RemoteFileBlockSize-5:RemoteFileBlockSize*2+5], p))
+	assert.Equal(t, 1, dds)
+
+	// cached
+	n, err = rf.ReadAt(p[:10], RemoteFileBlockSize)
+	assert.NoError(t, err)
+	assert.Equal(t, 10, n)
+	assert.Equal(t, 1, dds)
+
+	// the end of the file
+	n, err = rf.ReadAt(p[:200], int64(len(content))-100)
+	assert.Equal(t, io.EOF, err)
+	assert.Equal(t, 100, n)
+	assert.True(t, bytes.Equal(content[len(content)-100:], p[:100]))
+	n, err = rf.ReadAt(p, int64(len(content)))
+	assert.Equal(t, io.EOF, err)
+	assert.Equal(t, 0, n)
+
+	// Seek and Read
+	pos, err := rf.Seek(-50, io.SeekEnd)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len(content))-50, pos)
+	rest, err := io.ReadAll(rf)
+	assert.NoError(t, err)
+	assert.True(t, bytes.Equal(content[len(content)-50:], rest))
+	_, err = rf.Seek(-1, io.SeekStart)
+	assert.Error(t, err)
+
+	// the error of dd, not a short read
+	assert.NoError(t, os.Chmod(f.local("data/a.bin"), 0200))
+	rf2, err := f.Device().OpenReaderAt("/data/a.bin")
+	assert.NoError(t, err)
+	defer rf2.Close()
+	_, err = rf2.ReadAt(p[:10], 0)
+	assert.ErrorIs(t, err, fs.ErrPermission)
+	assert.NoError(t, os.Remove(f.local("data/a.bin")))
+	_, err = rf2.ReadAt(p[:10], 0)
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+}
+
+func TestRemoteFile_ReadPastEOF(t *testing.T) {
+	f := newFakeDevice(t)
+	var dds int
+	f.Service = serveDD(f, &dds)
+	f.WriteFile(t, "data/small", "0123456789", someMtime)
+
+	rf, err := f.Device().OpenReaderAt("/data/small")
+	assert.NoError(t, err)
+	defer rf.Close()
+
+	// a buffer of several blocks, on a file of less than one
+	p := make([]byte, 2*RemoteFileBlockSize)
+	n, err := rf.ReadAt(p, 0)
+	assert.Equal(t, io.EOF, err)
+	assert.Equal(t, 10, n)
+	assert.Equal(t, "0123456789", string(p[:n]))
+	n, err = rf.ReadAt(p, 5)
+	assert.Equal(t, io.EOF, err)
+	assert.Equal(t, "56789", string(p[:n]))
+	assert.Equal(t, 1, dds)
+}
+
+func TestRemoteFile_Zip(t *testing.T) {
+	f := newFakeDevice(t)
+	var dds int
+	f.Service = serveDD(f, &dds)
+
+	// a big stored entry which is not read
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, _ := zw.CreateHeader(&zip.FileHeader{Name: "assets/big.bin", Method: zip.Store})
+	w.Write(make([]byte, RemoteFileBlockSize*RemoteFileCacheBlocks*2))
+	w, _ = zw.Create("AndroidManifest.xml")
+	io.WriteString(w, "<manifest/>")
+	assert.NoError(t, zw.Close())
+	f.WriteFile(t, "data/app.apk", buf.String(), someMtime)
+
+	rf, err := f.Device().OpenReaderAt("/data/app.apk")
+	assert.NoError(t, err)
+	defer rf.Close()
+	zr, err := zip.NewReader(rf, rf.Size())
+	assert.NoError(t, err)
+	var names []string
+	for _, file := range zr.File {
+		names = append(names, file.Name)
+	}
+	assert.Equal(t, []string{"assets/big.bin", "AndroidManifest.xml"}, names)
+
+	r, err := zr.Open("AndroidManifest.xml")
+	assert.NoError(t, err)
+	data, err := io.ReadAll(r)
+	assert.NoError(t, err)
+	assert.Equal(t, "<manifest/>", string(data))
+	// only the blocks at the end were read
+	assert.LessOrEqual(t, dds, 3)
+	assert.False(t, strings.Contains(strings.Join(f.Services(), "\n"), "skip=0 "))
+}
@@ -0,0 +1,339 @@
+package adb
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prife/goadb/wire"
+)
+
+const (
+	// ResumeStateSuffix is appended to the local path for the sidecar state of a resumable transfer.
+	ResumeStateSuffix = ".adbresume"
+	// ResumeTempSuffix is appended to the destination path of an unfinished transfer, the
+	// remote path for pushes and the local path for pulls.
+	ResumeTempSuffix = ".adbtmp"
+	// ResumeSegmentSize is the size of the segments of a resumable push: an interrupted push
+	// resumes at the last complete segment. It is also the interval of the state updates.
+	ResumeSegmentSize = 64 * 1024 * 1024
+
+	// block size of dd for resumed pulls, a resumed pull restarts at a block boundary
+	resumeBlockSize = 1024 * 1024
+)
+
+// resumeSegmentSize is ResumeSegmentSize, lowered by tests.
+var resumeSegmentSize int64 = ResumeSegmentSize
+
+// ResumeState is the sidecar state of a resumable transfer, saved as JSON next to the local file.
+// A transfer resumes only if the source still has the same size and mtime.
+type ResumeState struct {
+	Push    bool      `json:"push"`
+	Remote  string    `json:"remote"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mtime"`
+	// Offset is the number of bytes transferred, when the state was saved.
+	Offset int64 `json:"offset"`
+}
+
+func loadResumeState(name string) (*ResumeState, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	var state ResumeState
+	if err = json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("%w: %s: %w", wire.ErrParse, name, err)
+	}
+	return &state, nil
+}
+
+func (s *ResumeState) save(name string) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(name, data, 0644)
+}
+
+// matches returns true if s is the state of the same transfer.
+func (s *ResumeState) matches(o *ResumeState) bool {
+	return s.Push == o.Push && s.Remote == o.Remote && s.Size == o.Size && s.ModTime.Equal(o.ModTime)
+}
+
+// remoteFileStat returns the size, mtime and permissions of a remote file with stat(1),
+// since the sync protocol truncates sizes to 32 bits.
+func (c *Device) remoteFileStat(remote string) (size int64, mtime time.Time, perm fs.FileMode, err error) {
+	return c.runStat("stat -c", remote)
+}
+
+// remoteTargetStat is remoteFileStat of the target of the symlink remote.
+func (c *Device) remoteTargetStat(remote string) (size int64, mtime time.Time, perm fs.FileMode, err error) {
+	return c.runStat("stat -L -c", remote)
+}
+
+func (c *Device) runStat(cmd, remote string) (size int64, mtime time.Time, perm fs.FileMode, err error) {
+	resp, err := c.runShellChecked(c.CmdTimeoutShort, cmd+" '%s %Y %a' "+shellQuote(remote))
+	if err != nil {
+		if strings.Contains(err.Error(), "No such file") {
+			err = fmt.Errorf("%w: %w", wire.ErrFileNoExist, err)
+		}
+		return 0, time.Time{}, 0, fmt.Errorf("stat %s: %w", remote, err)
+	}
+	size, mtime, perm, err = parseRemoteFileStat(resp)
+	if err != nil {
+		return 0, time.Time{}, 0, fmt.Errorf("stat %s: %w", remote, err)
+	}
+	return
+}
+
+func parseRemoteFileStat(resp []byte) (size int64, mtime time.Time, perm fs.FileMode, err error) {
+	fields := strings.Fields(string(resp))
+	if len(fields) != 3 {
+		return 0, time.Time{}, 0, fmt.Errorf("%w: invalid stat output %q", wire.ErrParse, resp)
+	}
+	size, err1 := strconv.ParseInt(fields[0], 10, 64)
+	sec, err2 := strconv.ParseInt(fields[1], 10, 64)
+	mode, err3 := strconv.ParseUint(fields[2], 8, 32)
+	if err := errors.Join(err1, err2, err3); err != nil {
+		return 0, time.Time{}, 0, fmt.Errorf("%w: invalid stat output %q: %w", wire.ErrParse, resp, err)
+	}
+	return size, time.Unix(sec, 0).UTC(), fs.FileMode(mode).Perm(), nil
+}
+
+// PushFileResumable pushes a large file so that a retried call continues where an interrupted
+// one stopped. The file is pushed by segments of ResumeSegmentSize into remote+ResumeTempSuffix:
+// the first one by sync, the next ones are sent aside and appended with cat.
+// The temp file is renamed to remote once complete, restoring the mtime is best-effort: if it
+// fails, the error is returned although the file was pushed. The progress of the sidecar state,
+// localPath+ResumeStateSuffix, is checked against the size of the temp file on the device.
+func (c *Device) PushFileResumable(ctx context.Context, localPath, remotePath string, handler wire.SyncFileHandler) error {
+	info, err := os.Stat(localPath)
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("not regular file: %s", localPath)
+	}
+	statePath := localPath + ResumeStateSuffix
+	tmp := remotePath + ResumeTempSuffix
+	part := tmp + ".part"
+	state := &ResumeState{Push: true, Remote: remotePath, Size: info.Size(), ModTime: info.ModTime().Truncate(time.Second)}
+
+	// resume from the size of the temp file, which only grows by appended segments
+	var offset int64
+	if saved, err := loadResumeState(statePath); err == nil && saved.matches(state) {
+		if size, _, _, err := c.remoteFileStat(tmp); err == nil && size <= state.Size {
+			offset = size
+		}
+	}
+	if c.StoragePreflight {
+		if err = c.storagePreflight(tmp, state.Size-offset); err != nil {
+			return fmt.Errorf("push failed: %w", err)
+		}
+	}
+	if offset == 0 {
+		if _, err = c.runShellChecked(c.CmdTimeoutShort, "rm -f "+shellQuote(tmp)+" "+shellQuote(part)); err != nil {
+			return fmt.Errorf("push: %w", err)
+		}
+	}
+	state.Offset = offset
+	if err = state.save(statePath); err != nil {
+		return err
+	}
+
+	file, err := os.Open(localPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	startTime := time.Now()
+	sent := uint64(offset)
+	// a resumed temp file may have been appended by the interrupted call
+	appended := offset > 0
+	// an empty file is pushed once, a complete temp file is just renamed
+	done := offset > 0 && offset == state.Size
+	for !done {
+		if err = ctx.Err(); err != nil {
+			return fmt.Errorf("push failed by ctx done: %w", err)
+		}
+		n := state.Size - offset
+		if n > resumeSegmentSize {
+			n = resumeSegmentSize
+		}
+		target := tmp
+		if offset > 0 {
+			target = part
+		}
+		if _, err = file.Seek(offset, io.SeekStart); err != nil {
+			return err
+		}
+		err = c.pushStream(ctx, &exactReader{r: file, n: n}, target, info.Mode().Perm(), info.ModTime(), func(written uint64) {
+			sent += written
+			if handler != nil {
+				percent := float64(100)
+				if state.Size > 0 {
+					percent = float64(sent) * 100 / float64(state.Size)
+				}
+				handler(uint64(state.Size), sent, percent, speedMBPerSecond(sent-uint64(state.Offset), startTime))
+			}
+		})
+		if err != nil {
+			return fmt.Errorf("push failed: %w", err)
+		}
+		if target == part {
+			cmd := fmt.Sprintf("cat %s >> %s && rm %s", shellQuote(part), shellQuote(tmp), shellQuote(part))
+			if _, err = c.runShellChecked(time.Minute, cmd); err != nil {
+				return fmt.Errorf("push failed: %w", err)
+			}
+			appended = true
+		}
+		offset += n
+		saved := *state
+		saved.Offset = offset
+		if err = saved.save(statePath); err != nil {
+			return err
+		}
+		done = offset >= state.Size
+	}
+
+	// appending changed the mtime set by sync, toolbox's touch has no -d but a -t of seconds
+	var touchErr error
+	if appended {
+		_, touchErr = c.runShellChecked(c.CmdTimeoutShort, fmt.Sprintf("touch -m -d @%d %s 2>/dev/null || touch -m -t %d %s",
+			state.ModTime.Unix(), shellQuote(tmp), state.ModTime.Unix(), shellQuote(tmp)))
+	}
+	if _, err = c.runShellChecked(c.CmdTimeoutShort, fmt.Sprintf("mv %s %s", shellQuote(tmp), shellQuote(remotePath))); err != nil {
+		return fmt.Errorf("push failed: %w", err)
+	}
+	if err = os.Remove(statePath); err != nil {
+		return err
+	}
+	if touchErr != nil {
+		return fmt.Errorf("restore mtime of %s: %w", remotePath, touchErr)
+	}
+	return nil
+}
+
+// checkReadable opens name for reading with dd, like the reads which stream its data with the
+// errors of dd discarded. It returns a *fs.PathError of op matched by fs.ErrNotExist or
+// fs.ErrPermission when it can't be read.
+func (c *Device) checkReadable(op, name string) error {
+	_, err := c.runFileOp(op, "dd if="+shellQuote(name)+" bs=1 count=0")
+	return err
+}
+
+// PullFileResumable pulls a large file so that a retried call continues where an interrupted
+// one stopped. The file is read by dd over exec-out into localPath+ResumeTempSuffix, which
+// is renamed to localPath once complete. A retried call reads the remaining range, from the
+// size of the temp file, if the sidecar state localPath+ResumeStateSuffix matches the remote file.
+func (c *Device) PullFileResumable(ctx context.Context, remotePath, localPath string, handler wire.SyncFileHandler) error {
+	size, mtime, perm, err := c.remoteFileStat(remotePath)
+	if err != nil {
+		return err
+	}
+	statePath := localPath + ResumeStateSuffix
+	tmp := localPath + ResumeTempSuffix
+	state := &ResumeState{Remote: remotePath, Size: size, ModTime: mtime}
+
+	var offset int64
+	if saved, err := loadResumeState(statePath); err == nil && saved.matches(state) {
+		if info, err := os.Stat(tmp); err == nil && info.Size() <= size {
+			// dd skips whole blocks
+			offset = info.Size() - info.Size()%resumeBlockSize
+		}
+	}
+	if c.StoragePreflight {
+		if err = c.storagePreflight(tmp, state.Size-offset); err != nil {
+			return fmt.Errorf("push failed: %w", err)
+		}
+	}
+	state.Offset = offset
+	if err = state.save(statePath); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if err = file.Truncate(offset); err != nil {
+		return err
+	}
+	if _, err = file.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+
+	// the output of dd would be mixed with the data
+	cmd := fmt.Sprintf("dd if=%s bs=%d skip=%d 2>/dev/null", shellQuote(remotePath), resumeBlockSize, offset/resumeBlockSize)
+	conn, err := c.openExec(cmd)
+	if err != nil {
+		return fmt.Errorf("pull: %w", err)
+	}
+	defer conn.Close()
+	defer closeOnDone(ctx, conn)()
+
+	startTime := time.Now()
+	received := offset
+	lastSaved := offset
+	buf := make([]byte, wire.SyncMaxChunkSize)
+	for received < size {
+		n, rerr := conn.Read(buf)
+		if n > 0 {
+			if int64(n) > size-received {
+				n = int(size - received)
+			}
+			if _, err = file.Write(buf[:n]); err != nil {
+				return err
+			}
+			received += int64(n)
+			if handler != nil {
+				handler(uint64(size), uint64(received), float64(received)*100/float64(size), speedMBPerSecond(uint64(received-offset), startTime))
+			}
+			if received-lastSaved >= resumeSegmentSize {
+				lastSaved = received
+				saved := *state
+				saved.Offset = received
+				if err = saved.save(statePath); err != nil {
+					return err
+				}
+			}
+		}
+		if rerr != nil {
+			if ctx.Err() != nil {
+				return fmt.Errorf("pull failed by ctx done: %w", ctx.Err())
+			}
+			if rerr == io.EOF {
+				// dd stopped early, tell why
+				if err = c.checkReadable("pull", remotePath); err != nil {
+					return err
+				}
+				rerr = io.ErrUnexpectedEOF
+			}
+			return fmt.Errorf("pull failed at %d/%d: %w", received, size, rerr)
+		}
+	}
+
+	if err = file.Close(); err != nil {
+		return err
+	}
+	if err = os.Chmod(tmp, perm); err != nil {
+		return err
+	}
+	if err = os.Chtimes(tmp, mtime, mtime); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp, localPath); err != nil {
+		return err
+	}
+	return os.Remove(statePath)
+}
@@ -0,0 +1,226 @@
+package adb
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prife/goadb/wire"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	quotedArgRegex = regexp.MustCompile(`'([^']*)'`)
+	ddSkipRegex    = regexp.MustCompile(`skip=(\d+)`)
+	touchTimeRegex = regexp.MustCompile(`@(\d+)`)
+)
+
+// serveResumable plays the commands of the resumable transfers on f: stat, rm, cat,
+// touch, mv and dd, unreadable files have no owner read bit. failCat makes the next append fail.
+func serveResumable(f *fakeDevice, failCat *bool) func(service string, conn *wire.Conn) {
+	return func(service string, conn *wire.Conn) {
+		var args []string
+		for _, m := range quotedArgRegex.FindAllStringSubmatch(service, -1) {
+			args = append(args, f.local(m[1]))
+		}
+		status := func(err error) {
+			if err != nil {
+				fmt.Fprintf(conn, "%s\n%s1\n", err, exitStatusMarker)
+				return
+			}
+			fmt.Fprintf(conn, "%s0\n", exitStatusMarker)
+		}
+
+		switch {
+		case strings.HasPrefix(service, "shell:stat -c "), strings.HasPrefix(service, "shell:stat -L -c "):
+			info, err := os.Stat(args[1])
+			if err != nil {
+				status(fmt.Errorf("stat: No such file or directory"))
+				return
+			}
+			fmt.Fprintf(conn, "%d %d %o\n", info.Size(), info.ModTime().Unix(), info.Mode().Perm())
+			status(nil)
+		case strings.HasPrefix(service, "shell:rm -f "):
+			for _, name := range args {
+				os.Remove(name)
+			}
+			status(nil)
+		case strings.HasPrefix(service, "shell:cat "):
+			if *failCat {
+				*failCat = false
+				status(fmt.Errorf("cat: write error: No space left on device"))
+				return
+			}
+			data, err := os.ReadFile(args[0])
+			if err == nil {
+				var file *os.File
+				if file, err = os.OpenFile(args[1], os.O_APPEND|os.O_WRONLY, 0); err == nil {
+					_, err = file.Write(data)
+					file.Close()
+				}
+			}
+			if err == nil {
+				err = os.Remove(args[0])
+			}
+			status(err)
+		case strings.HasPrefix(service, "shell:touch "):
+			sec, _ := strconv.ParseInt(touchTimeRegex.FindStringSubmatch(service)[1], 10, 64)
+			status(os.Chtimes(args[0], time.Unix(sec, 0), time.Unix(sec, 0)))
+		case strings.HasPrefix(service, "shell:mv "):
+			status(os.Rename(args[0], args[1]))
+		case strings.HasPrefix(service, "shell:dd if="):
+			// adbd runs as shell, the tests may run as root
+			name := quotedArgRegex.FindStringSubmatch(service)[1]
+			if info, err := os.Stat(args[0]); err != nil {
+				status(fmt.Errorf("dd: %s: No such file or directory", name))
+			} else if info.Mode().Perm()&0400 == 0 {
+				status(fmt.Errorf("dd: %s: Permission denied", name))
+			} else {
+				status(nil)
+			}
+		case strings.HasPrefix(service, "exec:dd if="):
+			data, err := os.ReadFile(args[0])
+			if info, serr := os.Stat(args[0]); err != nil || serr != nil || info.Mode().Perm()&0400 == 0 {
+				return
+			}
+			skip, _ := strconv.Atoi(ddSkipRegex.FindStringSubmatch(service)[1])
+			if skip*resumeBlockSize < len(data) {
+				conn.Write(data[skip*resumeBlockSize:])
+			}
+		}
+	}
+}
+
+func TestDevice_PushFileResumable(t *testing.T) {
+	resumeSegmentSize = 4
+	defer func() { resumeSegmentSize = ResumeSegmentSize }()
+
+	f := newFakeDevice(t)
+	failCat := true
+	f.Service = serveResumable(f, &failCat)
+	assert.NoError(t, os.MkdirAll(f.local("data"), 0755))
+	local := filepath.Join(t.TempDir(), "big.bin")
+	writeLocalFile(t, local, "0123456789", someMtime)
+
+	// the append of the second segment fails, the first one stays in the temp file
+	err := f.Device().PushFileResumable(context.Background(), local, "/data/big.bin", nil)
+	assert.Error(t, err)
+	data, err := os.ReadFile(f.local("data/big.bin" + ResumeTempSuffix))
+	assert.NoError(t, err)
+	assert.Equal(t, "0123", string(data))
+	state, err := loadResumeState(local + ResumeStateSuffix)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(4), state.Offset)
+
+	var sent []uint64
+	err = f.Device().PushFileResumable(context.Background(), local, "/data/big.bin",
+		func(totalSize, sentSize uint64, percent, speedMBPerSecond float64) {
+			assert.Equal(t, uint64(10), totalSize)
+			sent = append(sent, sentSize)
+		})
+	assert.NoError(t, err)
+	// resumed after the first segment
+	assert.Equal(t, []uint64{8, 10}, sent)
+	data, err = os.ReadFile(f.local("data/big.bin"))
+	assert.NoError(t, err)
+	assert.Equal(t, "0123456789", string(data))
+	info, err := os.Stat(f.local("data/big.bin"))
+	assert.NoError(t, err)
+	assert.Equal(t, someMtime, info.ModTime().UTC())
+	_, err = os.Stat(local + ResumeStateSuffix)
+	assert.True(t, os.IsNotExist(err))
+
+	// the temp file was completed by appends before the interrupted call stopped, only renamed
+	f.WriteFile(t, "data/big.bin"+ResumeTempSuffix, "0123456789", time.Now())
+	state.Offset = 10
+	assert.NoError(t, state.save(local+ResumeStateSuffix))
+	err = f.Device().PushFileResumable(context.Background(), local, "/data/big.bin", nil)
+	assert.NoError(t, err)
+	info, err = os.Stat(f.local("data/big.bin"))
+	assert.NoError(t, err)
+	assert.Equal(t, someMtime, info.ModTime().UTC())
+
+	// a touch which can't set the mtime doesn't fail the rename, nor the next call
+	serve := f.Service
+	f.Service = func(service string, conn *wire.Conn) {
+		if strings.HasPrefix(service, "shell:touch ") {
+			fmt.Fprintf(conn, "touch: Unknown option t\n%s1\n", exitStatusMarker)
+			return
+		}
+		serve(service, conn)
+	}
+	assert.NoError(t, os.Remove(f.local("data/big.bin")))
+	f.WriteFile(t, "data/big.bin"+ResumeTempSuffix, "0123456789", time.Now())
+	assert.NoError(t, state.save(local+ResumeStateSuffix))
+	err = f.Device().PushFileResumable(context.Background(), local, "/data/big.bin", nil)
+	assert.ErrorContains(t, err, "restore mtime of /data/big.bin: exited with status 1: touch: Unknown option t")
+	data, err = os.ReadFile(f.local("data/big.bin"))
+	assert.NoError(t, err)
+	assert.Equal(t, "0123456789", string(data))
+	_, err = os.Stat(local + ResumeStateSuffix)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestDevice_PullFileResumable(t *testing.T) {
+	f := newFakeDevice(t)
+	f.Service = serveResumable(f, new(bool))
+	content := bytes.Repeat([]byte("0123456789abcdef"), resumeBlockSize/8) // 2 blocks
+	f.WriteFile(t, "data/big.bin", string(content), someMtime)
+	assert.NoError(t, os.Chmod(f.local("data/big.bin"), 0600))
+
+	// an interrupted pull, a block and a half was received
+	local := filepath.Join(t.TempDir(), "big.bin")
+	tmp := local + ResumeTempSuffix
+	assert.NoError(t, os.WriteFile(tmp, content[:resumeBlockSize*3/2], 0644))
+	state := &ResumeState{Remote: "/data/big.bin", Size: int64(len(content)), ModTime: someMtime}
+	assert.NoError(t, state.save(local+ResumeStateSuffix))
+
+	err := f.Device().PullFileResumable(context.Background(), "/data/big.bin", local, nil)
+	assert.NoError(t, err)
+	assert.Contains(t, f.Services(), fmt.Sprintf("exec:dd if='/data/big.bin' bs=%d skip=1 2>/dev/null", resumeBlockSize))
+	data, err := os.ReadFile(local)
+	assert.NoError(t, err)
+	assert.True(t, bytes.Equal(content, data))
+	info, err := os.Stat(local)
+	assert.NoError(t, err)
+	assert.Equal(t, fs.FileMode(0600), info.Mode().Perm())
+	assert.Equal(t, someMtime, info.ModTime().UTC())
+	_, err = os.Stat(local + ResumeStateSuffix)
+	assert.True(t, os.IsNotExist(err))
+
+	// the remote file changed: the pull restarts
+	assert.NoError(t, os.WriteFile(tmp, []byte("stale"), 0644))
+	state.ModTime = someMtime.Add(-time.Hour)
+	assert.NoError(t, state.save(local+ResumeStateSuffix))
+	err = f.Device().PullFileResumable(context.Background(), "/data/big.bin", local, nil)
+	assert.NoError(t, err)
+	assert.Contains(t, f.Services(), fmt.Sprintf("exec:dd if='/data/big.bin' bs=%d skip=0 2>/dev/null", resumeBlockSize))
+	data, err = os.ReadFile(local)
+	assert.NoError(t, err)
+	assert.True(t, bytes.Equal(content, data))
+
+	// stat(1) doesn't need the read permission, dd does
+	assert.NoError(t, os.Chmod(f.local("data/big.bin"), 0200))
+	err = f.Device().PullFileResumable(context.Background(), "/data/big.bin", local, nil)
+	assert.ErrorIs(t, err, fs.ErrPermission)
+	assert.EqualError(t, err, "pull /data/big.bin: permission denied")
+}
+
+func TestParseRemoteFileStat(t *testing.T) {
+	size, mtime, perm, err := parseRemoteFileStat([]byte("5368709120 1700000000 644\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5368709120), size)
+	assert.Equal(t, time.Unix(1700000000, 0).UTC(), mtime)
+	assert.Equal(t, fs.FileMode(0644), perm)
+
+	_, _, _, err = parseRemoteFileStat([]byte("stat: '/a': No such file or directory"))
+	assert.ErrorIs(t, err, wire.ErrParse)
+}
@@ -3,8 +3,10 @@ package adb
 import (
 	"errors"
 	"fmt"
+	"net"
 	"os"
 	"os/exec"
+	"strconv"
 	"strings"
 	"time"
 
@@ -29,7 +31,12 @@ type ServerConfig struct {
 	// Host and port the adb server is listening on. If not specified, will use the default port on localhost.
 	Host string
 	Port int
-	fs   *filesystem
+	// Path of the unix socket the adb server is listening on, eg. from ADB_SERVER_SOCKET=localfilesystem:/path.
+	// If set, Host and Port are ignored. On linux, a leading '@' means an abstract socket.
+	UnixSocket string
+	// DefaultSerial is used instead of AnyDevice, like ANDROID_SERIAL for adb.
+	DefaultSerial string
+	fs            *filesystem
 }
 
 // Server knows how to start the adb server and connect to it.
@@ -70,7 +77,11 @@ type realServer struct {
 
 func newServer(config ServerConfig) (server, error) {
 	if config.Dialer == nil {
-		config.Dialer = tcpDialer{}
+		if config.UnixSocket != "" {
+			config.Dialer = unixDialer{}
+		} else {
+			config.Dialer = tcpDialer{}
+		}
 	}
 
 	if config.Host == "" {
@@ -99,9 +110,13 @@ func newServer(config ServerConfig) (server, error) {
 		return nil, fmt.Errorf("%w: invalid adb executable: %s, err: %w", wire.ErrServerNotAvailable, config.PathToAdb, err)
 	}
 
+	address := net.JoinHostPort(config.Host, strconv.Itoa(config.Port))
+	if config.UnixSocket != "" {
+		address = config.UnixSocket
+	}
 	return &realServer{
 		config:  config,
-		address: fmt.Sprintf("%s:%d", config.Host, config.Port),
+		address: address,
 	}, nil
 }
 
@@ -126,9 +141,13 @@ func (s *realServer) Dial() (wire.IConn, error) {
 	return conn, nil
 }
 
-// StartServer ensures there is a server running.
+// StartServer ensures there is a server running on the configured address.
 func (s *realServer) Start() error {
-	output, err := s.config.fs.CmdCombinedOutput(s.config.PathToAdb /*"-L", fmt.Sprintf("tcp:%s", s.address),*/, "start-server")
+	spec, err := s.socketSpec()
+	if err != nil {
+		return err
+	}
+	output, err := s.config.fs.CmdCombinedOutput(s.config.PathToAdb, "-L", spec, "start-server")
 	outputStr := strings.TrimSpace(string(output))
 	if err != nil {
 		return fmt.Errorf("%w: error starting server: %w\noutput:\n%s", wire.ErrServerNotAvailable, err, outputStr)
@@ -136,6 +155,87 @@ func (s *realServer) Start() error {
 	return nil
 }
 
+// socketSpec returns the address the server listens on, in the format of `adb -L`.
+// adb can only listen on localhost, so a server on another host can't be started.
+func (s *realServer) socketSpec() (string, error) {
+	if socket := s.config.UnixSocket; socket != "" {
+		if name, ok := strings.CutPrefix(socket, "@"); ok {
+			return "localabstract:" + name, nil
+		}
+		return "localfilesystem:" + socket, nil
+	}
+
+	host := s.config.Host
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return "", fmt.Errorf("%w: can't start server on remote host %s", wire.ErrServerNotAvailable, host)
+	}
+	return fmt.Sprintf("tcp:%d", s.config.Port), nil
+}
+
+// waitReleased waits until nothing accepts connections on the server address anymore.
+func (s *realServer) waitReleased(timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		conn, err := s.config.Dial(s.address, s.config.DialTimeout)
+		if err != nil {
+			return nil
+		}
+		conn.Close()
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%w: %s still in use after %v", wire.ErrAssertion, s.address, timeout)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// AdbVersion is the version of the adb executable.
+//
+//	Android Debug Bridge version 1.0.41
+//	Version 34.0.4-10411341
+//	Installed as /usr/bin/adb
+type AdbVersion struct {
+	// Version of the adb protocol, eg. "1.0.41"
+	Version string
+	// ServerVersion is the last number of Version, reported by "host:version" of a server of the same version.
+	ServerVersion int
+	// Revision of platform-tools, eg. "34.0.4-10411341", empty for old versions.
+	Revision string
+	// Path to the executable.
+	Path string
+}
+
+// binaryVersion runs `adb --version`.
+func (s *realServer) binaryVersion() (v AdbVersion, err error) {
+	output, err := s.config.fs.CmdCombinedOutput(s.config.PathToAdb, "--version")
+	if err != nil {
+		return v, fmt.Errorf("%w: %s --version: %w", wire.ErrServerNotAvailable, s.config.PathToAdb, err)
+	}
+	v, err = parseAdbVersion(string(output))
+	if v.Path == "" {
+		v.Path = s.config.PathToAdb
+	}
+	return
+}
+
+func parseAdbVersion(output string) (v AdbVersion, err error) {
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if str, ok := strings.CutPrefix(line, "Android Debug Bridge version "); ok {
+			v.Version = str
+		} else if str, ok := strings.CutPrefix(line, "Version "); ok {
+			v.Revision = str
+		} else if str, ok := strings.CutPrefix(line, "Installed as "); ok {
+			v.Path = str
+		}
+	}
+
+	i := strings.LastIndexByte(v.Version, '.')
+	if v.ServerVersion, err = strconv.Atoi(v.Version[i+1:]); err != nil || v.Version == "" {
+		return v, fmt.Errorf("%w: invalid adb version output: %s", wire.ErrParse, strings.TrimSpace(output))
+	}
+	return v, nil
+}
+
 // filesystem abstracts interactions with the local filesystem for testability.
 type filesystem struct {
 	// Wraps exec.LookPath.
@@ -0,0 +1,90 @@
+package adb
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/prife/goadb/wire"
+)
+
+// Environment variables honoured by adb, see `adb help`.
+const (
+	EnvServerPort    = "ANDROID_ADB_SERVER_PORT"
+	EnvServerAddress = "ANDROID_ADB_SERVER_ADDRESS"
+	EnvServerSocket  = "ADB_SERVER_SOCKET"
+	EnvSerial        = "ANDROID_SERIAL"
+)
+
+// ServerConfigFromEnv returns a ServerConfig from the environment variables used by adb:
+//
+//	ADB_SERVER_SOCKET           tcp:<port>, tcp:<host>:<port>, localfilesystem:<path> or localabstract:<name>
+//	ANDROID_ADB_SERVER_ADDRESS  host of the server, if ADB_SERVER_SOCKET is not set
+//	ANDROID_ADB_SERVER_PORT     port of the server, if ADB_SERVER_SOCKET is not set
+//	ANDROID_SERIAL              serial used instead of AnyDevice
+//
+// Unset variables are left to the defaults of NewWithConfig.
+func ServerConfigFromEnv() (config ServerConfig, err error) {
+	return serverConfigFromEnv(os.Getenv)
+}
+
+func serverConfigFromEnv(getenv func(string) string) (config ServerConfig, err error) {
+	config.DefaultSerial = getenv(EnvSerial)
+
+	socket := getenv(EnvServerSocket)
+	port := getenv(EnvServerPort)
+	if socket != "" && port != "" {
+		return config, fmt.Errorf("%w: %s and %s are both set", wire.ErrAssertion, EnvServerSocket, EnvServerPort)
+	}
+
+	if socket != "" {
+		err = parseServerSocket(socket, &config)
+		return
+	}
+
+	config.Host = getenv(EnvServerAddress)
+	if port != "" {
+		if config.Port, err = parseServerPort(port); err != nil {
+			return config, fmt.Errorf("%s: %w", EnvServerPort, err)
+		}
+	}
+	return
+}
+
+// parseServerSocket parses a socket spec as accepted by `adb -L`.
+func parseServerSocket(socket string, config *ServerConfig) (err error) {
+	kind, addr, _ := strings.Cut(socket, ":")
+	if addr == "" {
+		return fmt.Errorf("%w: %s=%s: empty address", wire.ErrParse, EnvServerSocket, socket)
+	}
+
+	switch kind {
+	case "tcp":
+		// tcp:<port> or tcp:<host>:<port>
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			host, port = "", addr
+		}
+		config.Host = host
+		if config.Port, err = parseServerPort(port); err != nil {
+			return fmt.Errorf("%s=%s: %w", EnvServerSocket, socket, err)
+		}
+	case "localfilesystem":
+		config.UnixSocket = addr
+	case "localabstract":
+		config.UnixSocket = "@" + addr
+	default:
+		return fmt.Errorf("%w: %s=%s: unsupported socket spec", wire.ErrParse, EnvServerSocket, socket)
+	}
+	return nil
+}
+
+func parseServerPort(str string) (int, error) {
+	port, err := strconv.Atoi(str)
+	if err != nil || port <= 0 || port > 65535 {
+		return 0, fmt.Errorf("%w: invalid port '%s'", wire.ErrParse, str)
+	}
+	return port, nil
+}
@@ -168,3 +168,43 @@ func (b *mockConn) SetReadDeadline(t time.Time) error {
 func (b *mockConn) SetWriteDeadline(t time.Time) error {
 	return nil
 }
+
+// pipeServer implements server over net.Pipe, so tests can play the adb server
+// (and device) side of a connection interactively.
+// Each Dial runs handler in a new goroutine with the server end of the pipe.
+type pipeServer struct {
+	handler func(conn *wire.Conn)
+}
+
+var _ server = &pipeServer{}
+
+func (s *pipeServer) Dial() (wire.IConn, error) {
+	client, srv := net.Pipe()
+	go func() {
+		defer srv.Close()
+		s.handler(wire.NewConn(srv))
+	}()
+	return wire.NewConn(client), nil
+}
+
+func (s *pipeServer) Start() error {
+	return nil
+}
+
+// acceptTransport reads the host:transport request and the following service request,
+// answering both with OKAY, and returns the service request.
+func acceptTransport(conn *wire.Conn) (string, error) {
+	for i := 0; i < 2; i++ {
+		msg, err := conn.ReadMessage()
+		if err != nil {
+			return "", err
+		}
+		if _, err = conn.Write([]byte(wire.StatusSuccess)); err != nil {
+			return "", err
+		}
+		if i == 1 {
+			return string(msg), nil
+		}
+	}
+	return "", nil
+}
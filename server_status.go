@@ -0,0 +1,103 @@
+package adb
+
+import (
+	"fmt"
+)
+
+// UsbBackend is the usb implementation of the adb server.
+type UsbBackend int32
+
+const (
+	UsbBackendUnknown UsbBackend = iota
+	UsbBackendNative
+	UsbBackendLibusb
+)
+
+func (b UsbBackend) String() string {
+	switch b {
+	case UsbBackendNative:
+		return "native"
+	case UsbBackendLibusb:
+		return "libusb"
+	}
+	return "unknown"
+}
+
+// MdnsBackend is the mdns implementation of the adb server.
+type MdnsBackend int32
+
+const (
+	MdnsBackendUnknown MdnsBackend = iota
+	MdnsBackendBonjour
+	MdnsBackendOpenscreen
+)
+
+func (b MdnsBackend) String() string {
+	switch b {
+	case MdnsBackendBonjour:
+		return "bonjour"
+	case MdnsBackendOpenscreen:
+		return "openscreen"
+	}
+	return "unknown"
+}
+
+// ServerStatus is the AdbServerStatus message of adb/proto/adb_host.proto.
+type ServerStatus struct {
+	UsbBackend        UsbBackend
+	UsbBackendForced  bool
+	MdnsBackend       MdnsBackend
+	MdnsBackendForced bool
+	// Version of the server, eg. "1.0.41"
+	Version string
+	// Build of platform-tools, eg. "34.0.4-10411341"
+	Build          string
+	ExecutablePath string
+	LogPath        string
+	Os             string
+}
+
+// ServerStatus returns the diagnostics of the server, like `adb server-status`.
+// It needs platform-tools 33 or newer.
+func (c *Adb) ServerStatus() (*ServerStatus, error) {
+	resp, err := roundTripSingleResponse(c.server, "host:server-status")
+	if err != nil {
+		return nil, fmt.Errorf("ServerStatus: %w", err)
+	}
+	status, err := parseServerStatus(resp)
+	if err != nil {
+		return nil, fmt.Errorf("ServerStatus: %w", err)
+	}
+	return status, nil
+}
+
+func parseServerStatus(b []byte) (*ServerStatus, error) {
+	s := &ServerStatus{}
+	err := parseProto(b, func(f protoField) error {
+		switch f.Num {
+		case 1:
+			s.UsbBackend = UsbBackend(f.Varint)
+		case 2:
+			s.UsbBackendForced = f.Varint != 0
+		case 3:
+			s.MdnsBackend = MdnsBackend(f.Varint)
+		case 4:
+			s.MdnsBackendForced = f.Varint != 0
+		case 5:
+			s.Version = string(f.Bytes)
+		case 6:
+			s.Build = string(f.Bytes)
+		case 7:
+			s.ExecutablePath = string(f.Bytes)
+		case 8:
+			s.LogPath = string(f.Bytes)
+		case 9:
+			s.Os = string(f.Bytes)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
@@ -0,0 +1,37 @@
+package adb
+
+import (
+	"testing"
+
+	"github.com/prife/goadb/wire"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdb_ServerStatus(t *testing.T) {
+	msg := appendProtoVarint(nil, 1, 2)
+	msg = appendProtoVarint(msg, 3, 2)
+	msg = appendProtoBytes(msg, 5, []byte("1.0.41"))
+	msg = appendProtoBytes(msg, 6, []byte("34.0.4-10411341"))
+	msg = appendProtoBytes(msg, 7, []byte("/usr/bin/adb"))
+	msg = appendProtoBytes(msg, 8, []byte("/tmp/adb.1000.log"))
+	msg = appendProtoBytes(msg, 9, []byte("Linux 6.1.0 (x86_64)"))
+	msg = appendProtoVarint(msg, 15, 1) // unknown field
+	s := &MockServer{
+		Status:   wire.StatusSuccess,
+		Messages: []string{string(msg)},
+	}
+
+	status, err := (&Adb{server: s}).ServerStatus()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"host:server-status"}, s.Requests)
+	assert.Equal(t, &ServerStatus{
+		UsbBackend:     UsbBackendLibusb,
+		MdnsBackend:    MdnsBackendOpenscreen,
+		Version:        "1.0.41",
+		Build:          "34.0.4-10411341",
+		ExecutablePath: "/usr/bin/adb",
+		LogPath:        "/tmp/adb.1000.log",
+		Os:             "Linux 6.1.0 (x86_64)",
+	}, status)
+	assert.Equal(t, "libusb", status.UsbBackend.String())
+}
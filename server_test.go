@@ -2,6 +2,8 @@ package adb
 
 import (
 	"fmt"
+	"net"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -77,3 +79,208 @@ func TestNewServer_AdbNotFound(t *testing.T) {
 	_, err := newServer(config)
 	assert.EqualError(t, err, "ServerNotAvailable: could not find adb in PATH")
 }
+
+func TestNewServer_UnixSocket(t *testing.T) {
+	config := ServerConfig{
+		UnixSocket: "/tmp/adb.sock",
+		PathToAdb:  "/bin/adb",
+		fs: &filesystem{
+			IsExecutableFile: func(path string) error { return nil },
+		},
+	}
+
+	serverIf, err := newServer(config)
+	server := serverIf.(*realServer)
+	assert.NoError(t, err)
+	assert.IsType(t, unixDialer{}, server.config.Dialer)
+	assert.Equal(t, "/tmp/adb.sock", server.address)
+}
+
+func TestUnixDialer(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "adb.sock")
+	l, err := net.Listen("unix", path)
+	assert.NoError(t, err)
+	defer l.Close()
+	go func() {
+		conn, err := l.Accept()
+		if err == nil {
+			conn.Write([]byte("OKAY"))
+			conn.Close()
+		}
+	}()
+
+	conn, err := unixDialer{}.Dial(path, time.Second)
+	assert.NoError(t, err)
+	defer conn.Close()
+	status, err := conn.ReadStatus("")
+	assert.NoError(t, err)
+	assert.Equal(t, wire.StatusSuccess, status)
+
+	_, err = unixDialer{}.Dial(path+".missing", time.Second)
+	assert.ErrorIs(t, err, wire.ErrServerNotAvailable)
+}
+
+func TestServerConfigFromEnv(t *testing.T) {
+	for _, test := range []struct {
+		Env     map[string]string
+		Want    ServerConfig
+		WantErr bool
+	}{
+		{Env: nil, Want: ServerConfig{}},
+		{Env: map[string]string{EnvServerPort: "5038", EnvServerAddress: "10.0.0.2"}, Want: ServerConfig{Host: "10.0.0.2", Port: 5038}},
+		{Env: map[string]string{EnvServerPort: "nope"}, WantErr: true},
+		{Env: map[string]string{EnvServerSocket: "tcp:5039"}, Want: ServerConfig{Port: 5039}},
+		{Env: map[string]string{EnvServerSocket: "tcp:host:5039"}, Want: ServerConfig{Host: "host", Port: 5039}},
+		{Env: map[string]string{EnvServerSocket: "tcp:[::1]:5039"}, Want: ServerConfig{Host: "::1", Port: 5039}},
+		{Env: map[string]string{EnvServerSocket: "localfilesystem:/tmp/adb.sock"}, Want: ServerConfig{UnixSocket: "/tmp/adb.sock"}},
+		{Env: map[string]string{EnvServerSocket: "localabstract:adb"}, Want: ServerConfig{UnixSocket: "@adb"}},
+		{Env: map[string]string{EnvServerSocket: "vsock:1:5037"}, WantErr: true},
+		{Env: map[string]string{EnvServerSocket: "localfilesystem:"}, WantErr: true},
+		{Env: map[string]string{EnvServerSocket: "tcp:5039", EnvServerPort: "5039"}, WantErr: true},
+		{Env: map[string]string{EnvSerial: "emulator-5554"}, Want: ServerConfig{DefaultSerial: "emulator-5554"}},
+	} {
+		config, err := serverConfigFromEnv(func(key string) string { return test.Env[key] })
+		if test.WantErr {
+			assert.Error(t, err, test.Env)
+			continue
+		}
+		assert.NoError(t, err, test.Env)
+		assert.Equal(t, test.Want, config, test.Env)
+	}
+}
+
+func TestParseAdbVersion(t *testing.T) {
+	v, err := parseAdbVersion("Android Debug Bridge version 1.0.41\nVersion 34.0.4-10411341\nInstalled as /usr/bin/adb\nRunning on Linux 6.1.0 (x86_64)\n")
+	assert.NoError(t, err)
+	assert.Equal(t, AdbVersion{Version: "1.0.41", ServerVersion: 41, Revision: "34.0.4-10411341", Path: "/usr/bin/adb"}, v)
+
+	v, err = parseAdbVersion("Android Debug Bridge version 1.0.32\n")
+	assert.NoError(t, err)
+	assert.Equal(t, 32, v.ServerVersion)
+
+	_, err = parseAdbVersion("adb: command not found")
+	assert.ErrorIs(t, err, wire.ErrParse)
+}
+
+func TestRealServer_StartSocketSpec(t *testing.T) {
+	for _, test := range []struct {
+		Config   ServerConfig
+		WantSpec string
+	}{
+		{ServerConfig{}, "tcp:5037"},
+		{ServerConfig{Host: "localhost", Port: 5038}, "tcp:5038"},
+		{ServerConfig{UnixSocket: "/tmp/adb.sock"}, "localfilesystem:/tmp/adb.sock"},
+		{ServerConfig{UnixSocket: "@adb"}, "localabstract:adb"},
+		{ServerConfig{Host: "192.168.1.2"}, ""},
+	} {
+		var args []string
+		test.Config.PathToAdb = "/bin/adb"
+		test.Config.fs = &filesystem{
+			IsExecutableFile: func(string) error { return nil },
+			CmdCombinedOutput: func(name string, arg ...string) ([]byte, error) {
+				args = arg
+				return nil, nil
+			},
+		}
+		s, err := newServer(test.Config)
+		assert.NoError(t, err)
+
+		err = s.Start()
+		if test.WantSpec == "" {
+			assert.ErrorIs(t, err, wire.ErrServerNotAvailable)
+			continue
+		}
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"-L", test.WantSpec, "start-server"}, args)
+	}
+}
+
+// fakeAdbServer answers host:version with version, and quits on host:kill.
+type fakeAdbServer struct {
+	l        net.Listener
+	version  int
+	requests chan string
+}
+
+func newFakeAdbServer(t *testing.T, version int) *fakeAdbServer {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	s := &fakeAdbServer{l: l, version: version, requests: make(chan string, 10)}
+	go s.serve()
+	t.Cleanup(func() { l.Close() })
+	return s
+}
+
+func (s *fakeAdbServer) Port() int {
+	return s.l.Addr().(*net.TCPAddr).Port
+}
+
+func (s *fakeAdbServer) serve() {
+	for {
+		netConn, err := s.l.Accept()
+		if err != nil {
+			return
+		}
+		conn := wire.NewConn(netConn)
+		req, err := conn.ReadMessage()
+		if err != nil {
+			conn.Close()
+			continue
+		}
+		s.requests <- string(req)
+		conn.Write([]byte(wire.StatusSuccess))
+		switch string(req) {
+		case "host:version":
+			conn.SendMessage([]byte(fmt.Sprintf("%04x", s.version)))
+		case "host:kill":
+			conn.Close()
+			s.l.Close()
+			return
+		}
+		conn.Close()
+	}
+}
+
+func newFakeAdbClient(t *testing.T, port int, start func()) *Adb {
+	s, err := newServer(ServerConfig{
+		Port:      port,
+		PathToAdb: "/bin/adb",
+		fs: &filesystem{
+			IsExecutableFile: func(string) error { return nil },
+			CmdCombinedOutput: func(name string, arg ...string) ([]byte, error) {
+				if arg[0] == "--version" {
+					return []byte("Android Debug Bridge version 1.0.41\nVersion 34.0.4-10411341\n"), nil
+				}
+				start()
+				return nil, nil
+			},
+		},
+	})
+	assert.NoError(t, err)
+	return &Adb{server: s}
+}
+
+func TestAdb_KillServer(t *testing.T) {
+	fake := newFakeAdbServer(t, 41)
+	client := newFakeAdbClient(t, fake.Port(), func() {})
+
+	assert.NoError(t, client.KillServer())
+	assert.Equal(t, "host:kill", <-fake.requests)
+	_, err := net.Dial("tcp", fake.l.Addr().String())
+	assert.Error(t, err)
+}
+
+func TestAdb_StartServerVersionMismatch(t *testing.T) {
+	fake := newFakeAdbServer(t, 40)
+	starts := 0
+	client := newFakeAdbClient(t, fake.Port(), func() { starts++ })
+
+	err := client.CheckServerVersion()
+	assert.ErrorIs(t, err, ErrServerVersionMismatch)
+	assert.Equal(t, "host:version", <-fake.requests)
+
+	assert.NoError(t, client.StartServer())
+	assert.Equal(t, []string{"host:version", "host:kill"}, []string{<-fake.requests, <-fake.requests})
+	// once by StartServer, once more after killing the old server
+	assert.Equal(t, 2, starts)
+}
@@ -52,7 +52,14 @@ func Monitor(ctx context.Context, r *gomlib.Registry) (err error) {
 			adb.StateAuthorizing,
 			adb.StateDisconnected,
 			adb.StateOffline,
-			adb.StateHost:
+			adb.StateHost,
+			adb.StateBootloader,
+			adb.StateRecovery,
+			adb.StateRescue,
+			adb.StateSideload,
+			adb.StateNoPermissions,
+			adb.StateConnecting,
+			adb.StateDetached:
 		default:
 			log.Fatalf("adb-monitor: unknown listen message type: %#v", event)
 		}
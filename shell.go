@@ -158,3 +158,16 @@ func (c *Device) RunCommandOutputCtx(ctx context.Context, cmd string, args ...st
 	err := c.RunCommandCtx(ctx, buf, cmd, args...)
 	return buf.Bytes(), err
 }
+
+// runShellChecked runs cmdline with sh, it returns the output, or an error if the
+// command exits with a non-zero status. Arguments must be quoted by shellQuote.
+func (c *Device) runShellChecked(timeout time.Duration, cmdline string) ([]byte, error) {
+	resp, err := c.RunCommandTimeout(timeout, fmt.Sprintf("%s; echo %s$?", cmdline, exitStatusMarker))
+	if err != nil {
+		return nil, err
+	}
+	if err = parseExitStatus(resp); err != nil {
+		return nil, err
+	}
+	return resp[:bytes.LastIndex(resp, []byte(exitStatusMarker))], nil
+}
@@ -0,0 +1,153 @@
+package adb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/prife/goadb/wire"
+)
+
+const (
+	// SideloadBlockSize is the block size requested by `adb sideload`, recovery asks for blocks of this size.
+	SideloadBlockSize = 64 * 1024
+
+	sideloadExitSuccess = "DONEDONE"
+	sideloadExitFailure = "FAILFAIL"
+)
+
+// Sideload serves the OTA package at localPath to a device in sideload mode, like `adb sideload <file>`.
+// See SideloadReader for the protocol.
+func (c *Device) Sideload(ctx context.Context, localPath string, handler wire.SyncFileHandler) error {
+	f, err := os.Open(localPath)
+	if err != nil {
+		return fmt.Errorf("open %s: %w", localPath, err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("stat %s: %w", localPath, err)
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("not regular file: %s", localPath)
+	}
+	return c.SideloadReader(ctx, f, info.Size(), handler)
+}
+
+// SideloadReader serves size bytes of r with the 'sideload-host:<size>:<blocksize>' service.
+//
+// Recovery reads the package on demand: it sends the block number it needs as 8 ascii
+// decimal digits, and we answer with the raw content of that block (the last one may be short).
+// Blocks are requested in any order and most of them twice, once for verifying the signature
+// and once for installing. When recovery is done, it sends "DONEDONE", or "FAILFAIL" if
+// the install failed.
+//
+// The percent passed to handler is the same estimate as adb: it reaches 100% after ~2.13
+// times the package size is transferred, and is capped at 99% until recovery reports success.
+func (c *Device) SideloadReader(ctx context.Context, r io.ReaderAt, size int64, handler wire.SyncFileHandler) error {
+	if size <= 0 {
+		return fmt.Errorf("%w: invalid sideload size %d", wire.ErrAssertion, size)
+	}
+
+	conn, err := c.dialDevice(c.CmdTimeoutShort)
+	if err != nil {
+		return wrapClientError(err, c, "Sideload")
+	}
+	defer conn.Close()
+
+	req := fmt.Sprintf("sideload-host:%d:%d", size, SideloadBlockSize)
+	if err = conn.SendMessage([]byte(req)); err != nil {
+		return wrapClientError(err, c, "Sideload")
+	}
+	if _, err = readStatusWithTimeout(conn, req, c.CmdTimeoutShort); err != nil {
+		return wrapClientError(err, c, "Sideload")
+	}
+
+	// recovery may stay silent for minutes while installing, so no read deadline here,
+	// close conn to abort on ctx done
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	err = serveSideload(conn, r, size, handler)
+	if err != nil && ctx.Err() != nil {
+		err = fmt.Errorf("sideload failed by ctx done: %w", ctx.Err())
+	}
+	return wrapClientError(err, c, "Sideload")
+}
+
+func serveSideload(conn io.ReadWriter, r io.ReaderAt, size int64, handler wire.SyncFileHandler) error {
+	var id [8]byte
+	buf := make([]byte, SideloadBlockSize)
+	total := uint64(size)
+	var sent uint64
+	startTime := time.Now()
+	lastPercent := -1
+
+	for {
+		if _, err := io.ReadFull(conn, id[:]); err != nil {
+			return fmt.Errorf("read block request: %w", err)
+		}
+
+		switch string(id[:]) {
+		case sideloadExitSuccess:
+			if handler != nil {
+				handler(total, sent, 100, speedMBPerSecond(sent, startTime))
+			}
+			return nil
+		case sideloadExitFailure:
+			return errors.New("sideload failed: recovery reported install failure")
+		}
+
+		block, err := strconv.ParseInt(string(id[:]), 10, 64)
+		if err != nil {
+			return fmt.Errorf("%w: invalid block request '%s'", wire.ErrParse, id[:])
+		}
+		offset := block * SideloadBlockSize
+		if block < 0 || offset >= size {
+			return fmt.Errorf("%w: block %d past end of %d bytes", wire.ErrAssertion, block, size)
+		}
+
+		n := int64(SideloadBlockSize)
+		if size-offset < n {
+			n = size - offset
+		}
+		if _, err = r.ReadAt(buf[:n], offset); err != nil && err != io.EOF {
+			return fmt.Errorf("read block %d: %w", block, err)
+		}
+		if _, err = conn.Write(buf[:n]); err != nil {
+			return fmt.Errorf("write block %d: %w", block, err)
+		}
+
+		sent += uint64(n)
+		if handler != nil {
+			percent := int(sent * 47 / total)
+			if percent > 99 {
+				percent = 99
+			}
+			if percent != lastPercent {
+				lastPercent = percent
+				handler(total, sent, float64(percent), speedMBPerSecond(sent, startTime))
+			}
+		}
+	}
+}
+
+func speedMBPerSecond(sent uint64, startTime time.Time) float64 {
+	elapsed := time.Since(startTime)
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(sent) * float64(time.Second) / 1024.0 / 1024.0 / float64(elapsed)
+}
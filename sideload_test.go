@@ -0,0 +1,93 @@
+package adb
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"testing"
+
+	"github.com/prife/goadb/wire"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeRecovery plays recovery in sideload mode: it requests every block twice,
+// in random order for the first pass, and checks the content.
+func fakeRecovery(t *testing.T, pkg []byte, finish string) func(conn *wire.Conn) {
+	return func(conn *wire.Conn) {
+		req, err := acceptTransport(conn)
+		assert.NoError(t, err)
+		assert.Equal(t, fmt.Sprintf("sideload-host:%d:%d", len(pkg), SideloadBlockSize), req)
+
+		blocks := (len(pkg) + SideloadBlockSize - 1) / SideloadBlockSize
+		order := append(rand.Perm(blocks), rand.Perm(blocks)...)
+		received := make([]byte, len(pkg))
+		for _, block := range order {
+			_, err := conn.Write([]byte(fmt.Sprintf("%08d", block)))
+			assert.NoError(t, err)
+
+			offset := block * SideloadBlockSize
+			end := offset + SideloadBlockSize
+			if end > len(pkg) {
+				end = len(pkg)
+			}
+			_, err = io.ReadFull(conn, received[offset:end])
+			assert.NoError(t, err)
+		}
+		assert.Equal(t, pkg, received)
+		conn.Write([]byte(finish))
+	}
+}
+
+func newSideloadPackage(size int) []byte {
+	pkg := make([]byte, size)
+	rand.Read(pkg)
+	return pkg
+}
+
+func TestDevice_SideloadReader(t *testing.T) {
+	pkg := newSideloadPackage(SideloadBlockSize*3 + 100)
+	s := &pipeServer{handler: fakeRecovery(t, pkg, sideloadExitSuccess)}
+	d := (&Adb{server: s}).Device(AnyDevice())
+
+	var lastSent uint64
+	var lastPercent float64
+	err := d.SideloadReader(context.Background(), bytes.NewReader(pkg), int64(len(pkg)), func(total, sent uint64, percent, speed float64) {
+		assert.Equal(t, uint64(len(pkg)), total)
+		lastSent, lastPercent = sent, percent
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(len(pkg)*2), lastSent)
+	assert.Equal(t, float64(100), lastPercent)
+}
+
+func TestDevice_SideloadReaderFailed(t *testing.T) {
+	pkg := newSideloadPackage(SideloadBlockSize)
+	s := &pipeServer{handler: fakeRecovery(t, pkg, sideloadExitFailure)}
+	d := (&Adb{server: s}).Device(AnyDevice())
+
+	err := d.SideloadReader(context.Background(), bytes.NewReader(pkg), int64(len(pkg)), nil)
+	assert.ErrorContains(t, err, "recovery reported install failure")
+}
+
+func TestDevice_SideloadReaderCanceled(t *testing.T) {
+	pkg := newSideloadPackage(SideloadBlockSize)
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &pipeServer{handler: func(conn *wire.Conn) {
+		acceptTransport(conn)
+		// installing, never answer
+		cancel()
+		io.Copy(io.Discard, conn)
+	}}
+	d := (&Adb{server: s}).Device(AnyDevice())
+
+	err := d.SideloadReader(ctx, bytes.NewReader(pkg), int64(len(pkg)), nil)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestServeSideloadBlockPastEnd(t *testing.T) {
+	conn := &mockConn{Buffer: bytes.NewBuffer(nil), rbuf: bytes.NewBufferString("00000002")}
+	err := serveSideload(conn, bytes.NewReader(make([]byte, 10)), 10, nil)
+	assert.ErrorIs(t, err, wire.ErrAssertion)
+}
@@ -0,0 +1,118 @@
+package adb
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ErrInsufficientStorage is the error of a transfer larger than the free space of the device,
+// see CheckStorage.
+var ErrInsufficientStorage = errors.New("InsufficientStorage")
+
+// StorageMargin is the free space kept by CheckStorage on top of the payload, for the
+// metadata of the files and the apps running meanwhile.
+const StorageMargin = 16 * 1024 * 1024
+
+// StorageError reports the space of a failed CheckStorage, it matches ErrInsufficientStorage
+// with errors.Is.
+type StorageError struct {
+	Path      string // the remote path
+	MountedOn string // the mount of Path, or Path for the toolbox of Android 5 and 6
+	Needed    int64  // the payload and StorageMargin
+	Available int64
+}
+
+func (e *StorageError) Error() string {
+	return fmt.Sprintf("%s: %s on %s: %d bytes needed, %d available",
+		ErrInsufficientStorage, e.Path, e.MountedOn, e.Needed, e.Available)
+}
+
+func (e *StorageError) Unwrap() error {
+	return ErrInsufficientStorage
+}
+
+// CheckStorage returns a *StorageError if the file system of the remote path has less than
+// payload bytes and StorageMargin available. remote may not exist yet, the file system is the
+// one of its nearest existing parent.
+func (c *Device) CheckStorage(remote string, payload int64) error {
+	name := remote
+	for {
+		exists, err := c.Exists(name)
+		if err != nil {
+			return fmt.Errorf("check storage: %w", err)
+		}
+		if exists || path.Dir(name) == name {
+			break
+		}
+		name = path.Dir(name)
+	}
+
+	entry, err := c.DFPath(name)
+	if err != nil {
+		return fmt.Errorf("check storage: %w", err)
+	}
+	needed, available := payload+StorageMargin, int64(entry.Avail)
+	if available < needed {
+		return &StorageError{Path: remote, MountedOn: entry.MountedOn, Needed: needed, Available: available}
+	}
+	return nil
+}
+
+// storagePreflight is CheckStorage before a transfer, the callers check StoragePreflight first.
+// It only fails for ErrInsufficientStorage: when the space is unknown, eg. df is missing or
+// denied, the transfer goes on.
+func (c *Device) storagePreflight(remote string, payload int64) error {
+	if err := c.CheckStorage(remote, payload); errors.Is(err, ErrInsufficientStorage) {
+		return err
+	}
+	return nil
+}
+
+// dirPreflight is storagePreflight for the push of the local directory, if StoragePreflight
+// is set. A walk error is left to the push itself.
+func (c *Device) dirPreflight(local, remote string) error {
+	if !c.StoragePreflight {
+		return nil
+	}
+	if payload, err := localPayload(local); err == nil {
+		return c.storagePreflight(remote, payload)
+	}
+	return nil
+}
+
+// filesPreflight is storagePreflight for the push of payload bytes to the remote files, if
+// StoragePreflight is set: the space is checked in their deepest common directory.
+func (c *Device) filesPreflight(remotes []string, payload int64) error {
+	if !c.StoragePreflight || len(remotes) == 0 {
+		return nil
+	}
+	dir := path.Dir(remotes[0])
+	for _, remote := range remotes[1:] {
+		for dir != "/" && !strings.HasPrefix(remote, dir+"/") && path.Dir(dir) != dir {
+			dir = path.Dir(dir)
+		}
+	}
+	return c.storagePreflight(dir, payload)
+}
+
+// localPayload returns the size of the regular files under local.
+func localPayload(local string) (size int64, err error) {
+	err = filepath.WalkDir(local, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			size += info.Size()
+		}
+		return nil
+	})
+	return
+}
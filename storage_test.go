@@ -0,0 +1,168 @@
+package adb
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prife/goadb/wire"
+	"github.com/stretchr/testify/assert"
+)
+
+// serveDF answers df -k with resp, and records the paths of df.
+func serveDF(resp string, paths *[]string) func(service string, conn *wire.Conn) {
+	return func(service string, conn *wire.Conn) {
+		if name, ok := strings.CutPrefix(service, "shell:df -k "); ok {
+			*paths = append(*paths, name)
+			io.WriteString(conn, resp)
+		}
+	}
+}
+
+func TestDevice_DFPath(t *testing.T) {
+	f := newFakeDevice(t)
+	var paths []string
+	f.Service = serveDF(`Filesystem     1K-blocks     Used Available Use% Mounted on
+/dev/block/dm-5 115609024 35907960  79553608  32% /data
+`, &paths)
+	entry, err := f.Device().DFPath("/data/local/tmp")
+	assert.NoError(t, err)
+	assert.Equal(t, DfEntry{
+		FileSystem: "/dev/block/dm-5",
+		Size:       115609024 * 1024,
+		Used:       35907960 * 1024,
+		Avail:      79553608 * 1024,
+		MountedOn:  "/data",
+	}, entry)
+	assert.Equal(t, []string{"'/data/local/tmp'"}, paths)
+
+	// Android 6, toolbox
+	f.Service = serveDF(`-k: No such file or directory
+/data/local/tmp         10.9G     6.3G     4.6G   4096
+`, &paths)
+	entry, err = f.Device().DFPath("/data/local/tmp")
+	assert.NoError(t, err)
+	assert.Equal(t, "/data/local/tmp", entry.MountedOn)
+	assert.Equal(t, 4.6*1024*1024*1024, entry.Avail)
+
+	f.Service = serveDF("df: /data/local/tmp: Permission denied\n", &paths)
+	_, err = f.Device().DFPath("/data/local/tmp")
+	assert.ErrorIs(t, err, wire.ErrParse)
+}
+
+func TestDevice_StoragePreflight(t *testing.T) {
+	f := newFakeDevice(t)
+	var paths []string
+	f.Service = serveDF(`Filesystem     1K-blocks     Used Available Use% Mounted on
+/dev/block/dm-5 115609024 35907960      1024 100% /data
+`, &paths)
+	f.WriteFile(t, "data/local/tmp/old.txt", "old", someMtime)
+	local := t.TempDir()
+	writeLocalFile(t, filepath.Join(local, "res", "a.txt"), "hello", someMtime)
+	writeLocalFile(t, filepath.Join(local, "res", "dir", "b.txt"), "world", someMtime)
+	d := f.Device()
+	d.StoragePreflight = true
+
+	err := d.PushFile(filepath.Join(local, "res", "a.txt"), "/data/local/tmp/new/a.txt", nil)
+	assert.ErrorIs(t, err, ErrInsufficientStorage)
+	var storageErr *StorageError
+	assert.True(t, errors.As(err, &storageErr))
+	assert.Equal(t, StorageError{
+		Path:      "/data/local/tmp/new/a.txt",
+		MountedOn: "/data",
+		Needed:    5 + StorageMargin,
+		Available: 1024 * 1024,
+	}, *storageErr)
+	// df on the nearest existing parent
+	assert.Equal(t, []string{"'/data/local/tmp'"}, paths)
+
+	err = d.PushDir(filepath.Join(local, "res"), "/data/local/tmp/res", false, nil)
+	assert.ErrorIs(t, err, ErrInsufficientStorage)
+	assert.True(t, errors.As(err, &storageErr))
+	assert.Equal(t, int64(10+StorageMargin), storageErr.Needed)
+
+	// nothing was sent
+	for _, service := range f.Services() {
+		assert.False(t, strings.HasPrefix(service, "sync:"+wire.ID_SEND), service)
+	}
+	_, err = os.Stat(f.local("data/local/tmp/res"))
+	assert.True(t, os.IsNotExist(err))
+
+	// an apk above 4 GiB
+	df, stat := f.Service, serveResumable(f, new(bool))
+	f.Service = func(service string, conn *wire.Conn) {
+		if strings.HasPrefix(service, "shell:df ") {
+			df(service, conn)
+		} else {
+			stat(service, conn)
+		}
+	}
+	f.WriteFile(t, "data/local/tmp/big.apk", "", someMtime)
+	assert.NoError(t, os.Truncate(f.local("data/local/tmp/big.apk"), 1<<32+1))
+	err = d.PmInstall(context.Background(), "/data/local/tmp/big.apk", false, false, false)
+	assert.ErrorIs(t, err, ErrInsufficientStorage)
+	assert.True(t, errors.As(err, &storageErr))
+	assert.Equal(t, int64(1<<32+1+StorageMargin), storageErr.Needed)
+	assert.Len(t, paths, 3)
+
+	// disabled by default
+	d.StoragePreflight = false
+	assert.NoError(t, d.PushFileCtx(context.Background(), filepath.Join(local, "res", "a.txt"), "/data/local/tmp/a.txt", nil))
+	assert.Len(t, paths, 3)
+
+	// the space is unknown, the push goes on
+	d.StoragePreflight = true
+	f.Service = nil
+	assert.NoError(t, d.PushFile(filepath.Join(local, "res", "a.txt"), "/data/local/tmp/b.txt", nil))
+}
+
+func TestDevice_StoragePreflightPushes(t *testing.T) {
+	f := newFakeDevice(t)
+	var paths []string
+	f.Service = serveDF(`Filesystem     1K-blocks     Used Available Use% Mounted on
+/dev/block/dm-5 115609024 35907960      1024 100% /data
+`, &paths)
+	assert.NoError(t, os.MkdirAll(f.local("data/local/tmp"), 0755))
+	local := t.TempDir()
+	writeLocalFile(t, filepath.Join(local, "res", "a.txt"), "hello", someMtime)
+	writeLocalFile(t, filepath.Join(local, "res", "dir", "b.txt"), "world", someMtime)
+	d := f.Device()
+	d.StoragePreflight = true
+	ctx := context.Background()
+
+	files := []PushItem{
+		{Local: filepath.Join(local, "res", "a.txt"), Remote: "/data/local/tmp/res/a.txt"},
+		{Local: filepath.Join(local, "res", "dir", "b.txt"), Remote: "/data/local/tmp/res/dir/b.txt"},
+	}
+	pushes := map[string]func() error{
+		"PushFiles": func() error { return d.PushFiles(ctx, files, ParallelPushOptions{}) },
+		"PushDirParallel": func() error {
+			return d.PushDirParallel(ctx, filepath.Join(local, "res"), "/data/local/tmp/res", false, ParallelPushOptions{})
+		},
+		"PushDirTar": func() error {
+			return d.PushDirTar(ctx, filepath.Join(local, "res"), "/data/local/tmp", true, nil)
+		},
+		"SyncDir": func() error {
+			_, err := d.SyncDir(filepath.Join(local, "res"), "/data/local/tmp/res", SyncDirOptions{})
+			return err
+		},
+		"PushReader": func() error {
+			return d.PushReader(ctx, strings.NewReader("hello"), 5, "/data/local/tmp/a.txt", 0644, someMtime, nil)
+		},
+		"PushFileResumable": func() error {
+			return d.PushFileResumable(ctx, filepath.Join(local, "res", "a.txt"), "/data/local/tmp/a.txt", nil)
+		},
+	}
+	for name, push := range pushes {
+		err := push()
+		assert.ErrorIs(t, err, ErrInsufficientStorage, name)
+	}
+	// nothing was sent
+	for _, service := range f.Services() {
+		assert.False(t, strings.HasPrefix(service, "sync:"+wire.ID_SEND), service)
+	}
+}
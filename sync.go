@@ -194,6 +194,11 @@ func (c *Device) PushFileCtx(ctx context.Context, localPath, remotePath string,
 	if !linfo.Mode().IsRegular() {
 		return fmt.Errorf("not regular file: %s", localPath)
 	}
+	if c.StoragePreflight {
+		if err := c.storagePreflight(remotePath, linfo.Size()); err != nil {
+			return fmt.Errorf("push failed: %w", err)
+		}
+	}
 
 	// features, err := c.DeviceFeatures()
 	// if err != nil {
@@ -246,6 +251,34 @@ func (c *Device) PushFileCtx(ctx context.Context, localPath, remotePath string,
 	}
 }
 
+// PullFile pulls the remote file to localPath.
+func (c *Device) PullFile(remotePath, localPath string, handler func(total, sent int64, duration time.Duration)) error {
+	return c.PullFileCtx(context.Background(), remotePath, localPath, handler)
+}
+
+func (c *Device) PullFileCtx(ctx context.Context, remotePath, localPath string, handler func(total, sent int64, duration time.Duration)) error {
+	fconn, err := c.NewSyncConn()
+	if err != nil {
+		return err
+	}
+	defer fconn.Close()
+
+	ch := make(chan error, 2)
+	go func() {
+		ch <- fconn.PullFile(remotePath, localPath, handler)
+	}()
+
+	select {
+	case <-ctx.Done():
+		return fmt.Errorf("pull failed by ctx done: %w", ctx.Err())
+	case err := <-ch:
+		if err != nil {
+			return fmt.Errorf("pull failed: %w", err)
+		}
+		return nil
+	}
+}
+
 // PushDir support push dir
 // push 文件夹:
 // adb push src-dir dest-dir具有两种行为，与cp命令效果一致
@@ -256,14 +289,33 @@ func (c *Device) PushFileCtx(ctx context.Context, localPath, remotePath string,
 // 当 withSrcDir 为 true，永远会在手机上创建src-dir
 // 当 withSrcDir 为 false，则仅会 src-dir 的子文件/目录推送到目标文件夹下
 func (c *Device) PushDir(local, remote string, withSrcDir bool, handler wire.SyncHandler) (err error) {
-	return c.PushDirCtx(context.Background(), local, remote, withSrcDir, handler)
+	return c.PushDirCtx(context.Background(), local, remote, PushDirOptions{WithSrcDir: withSrcDir, Handler: handler})
+}
+
+// PushDirOptions are the options of PushDirCtx.
+type PushDirOptions struct {
+	// WithSrcDir creates remote/<base of local>, instead of pushing the content of local into remote.
+	WithSrcDir bool
+	// Handler is called after the chunks of each file, and once for each file which failed.
+	Handler wire.SyncHandler
+	// Progress receives the bytes and files pushed, of the sizes of the files at the start.
+	// The files are then pushed by PushDirParallel over a single connection, and Handler
+	// reports the aggregate progress, see ParallelPushOptions.
+	Progress ProgressReporter
 }
 
-func (c *Device) PushDirCtx(ctx context.Context, local, remote string, withSrcDir bool, handler wire.SyncHandler) (err error) {
+func (c *Device) PushDirCtx(ctx context.Context, local, remote string, opts PushDirOptions) (err error) {
+	if opts.Progress != nil {
+		return c.PushDirParallel(ctx, local, remote, opts.WithSrcDir, ParallelPushOptions{Conns: 1, Handler: opts.Handler, Progress: opts.Progress})
+	}
+	if err := c.dirPreflight(local, remote); err != nil {
+		return fmt.Errorf("push failed: %w", err)
+	}
+
 	// Android 12 之后，push 可能遇到文件夹权限问题，解决办法
 	// 1. 先在手机上创建所有文件夹，如果失败则直接返回错误
 	// 2. 再推送文件
-	if err := MakeDirs(c, local, remote, withSrcDir); err != nil {
+	if err := MakeDirs(c, local, remote, opts.WithSrcDir); err != nil {
 		return err
 	}
 
@@ -276,7 +328,7 @@ func (c *Device) PushDirCtx(ctx context.Context, local, remote string, withSrcDi
 
 	ch := make(chan error, 2)
 	go func() {
-		err := fconn.PushDir(withSrcDir, local, remote, handler)
+		err := fconn.PushDir(opts.WithSrcDir, local, remote, opts.Handler)
 		ch <- err
 	}()
 
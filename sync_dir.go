@@ -0,0 +1,353 @@
+package adb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/prife/goadb/wire"
+)
+
+// SyncAction is an action of a SyncPlan.
+type SyncAction int
+
+const (
+	// SyncMkdir creates a remote directory.
+	SyncMkdir SyncAction = iota
+	// SyncPush pushes a local file which is missing or changed on the device.
+	SyncPush
+	// SyncDelete removes a remote file or directory which is missing locally.
+	SyncDelete
+)
+
+func (a SyncAction) String() string {
+	switch a {
+	case SyncMkdir:
+		return "mkdir"
+	case SyncPush:
+		return "push"
+	case SyncDelete:
+		return "delete"
+	}
+	return fmt.Sprintf("SyncAction(%d)", int(a))
+}
+
+// SyncOp is one action of a SyncPlan, Local is empty for SyncDelete.
+type SyncOp struct {
+	Action SyncAction
+	Local  string
+	Remote string
+	Size   int64
+	// Reason tells why a file is pushed: "missing", "size", "mtime" or "checksum".
+	Reason string
+}
+
+// SyncPlan is the list of actions of SyncDir: directories are created first, then files
+// are pushed, then extra remote entries are deleted.
+type SyncPlan []SyncOp
+
+// SyncDirOptions are the options of SyncDir.
+type SyncDirOptions struct {
+	// Delete removes the remote files and directories which are missing locally.
+	Delete bool
+	// Checksum compares the md5 of files of the same size, instead of their mtime.
+	Checksum bool
+	// DryRun only returns the plan.
+	DryRun bool
+	// Handler reports the progress of pushed files, and the errors of failed actions.
+	Handler wire.SyncHandler
+	// Progress receives the bytes and files of the pushes of the plan.
+	Progress ProgressReporter
+}
+
+// SyncDir makes the remote directory a copy of the local one, like `adb sync`: only the
+// files which are missing on the device, or whose size or mtime differ, are pushed.
+// Pushed files keep their local mtime, so they are skipped by the next SyncDir.
+// It returns the plan, which is executed unless opts.DryRun is set.
+func (c *Device) SyncDir(local, remote string, opts SyncDirOptions) (SyncPlan, error) {
+	return c.SyncDirCtx(context.Background(), local, remote, opts)
+}
+
+func (c *Device) SyncDirCtx(ctx context.Context, local, remote string, opts SyncDirOptions) (SyncPlan, error) {
+	if remote != "/" {
+		remote = strings.TrimSuffix(remote, "/")
+	}
+	plan, err := c.planSyncDir(ctx, local, remote, opts)
+	if err != nil {
+		return nil, err
+	}
+	if opts.DryRun {
+		return plan, nil
+	}
+	return plan, c.runSyncPlan(ctx, plan, opts.Handler, opts.Progress)
+}
+
+// planSyncDir compares the local tree with the remote one, listed by LIST.
+func (c *Device) planSyncDir(ctx context.Context, local, remote string, opts SyncDirOptions) (SyncPlan, error) {
+	linfo, err := os.Stat(local)
+	if err != nil {
+		return nil, err
+	}
+	if !linfo.IsDir() {
+		return nil, fmt.Errorf("not dir: %s", local)
+	}
+
+	// remote entries by relative path, remote may not exist yet
+	fsys := c.FS(remote)
+	defer fsys.Close()
+	remotes := make(map[string]fs.DirEntry)
+	err = fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if name != "." {
+			remotes[name] = d
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("list %s: %w", remote, err)
+	}
+	remoteExists := err == nil
+
+	var mkdirs, pushes, deletes SyncPlan
+	var same []SyncOp // same size, compared by checksum
+	if !remoteExists {
+		mkdirs = append(mkdirs, SyncOp{Action: SyncMkdir, Local: local, Remote: remote})
+	}
+	err = filepath.WalkDir(local, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(local, p)
+		if rel == "." {
+			return nil
+		}
+		rel = filepath.ToSlash(rel)
+		target := path.Join(remote, rel)
+		r, found := remotes[rel]
+		delete(remotes, rel)
+		if found && r.Type()&fs.ModeSymlink != 0 {
+			if r, err = resolveSyncLink(fsys, rel, r, d.IsDir(), remotes); err != nil {
+				return err
+			}
+		}
+
+		// type changed: the remote entry must be removed first
+		if found && r.IsDir() != d.IsDir() {
+			if !opts.Delete {
+				return fmt.Errorf("%s: remote type differs, use Delete to replace it", target)
+			}
+			deletes = append(deletes, SyncOp{Action: SyncDelete, Remote: target})
+			found = false
+		}
+
+		if d.IsDir() {
+			if !found {
+				mkdirs = append(mkdirs, SyncOp{Action: SyncMkdir, Local: p, Remote: target})
+			}
+			return nil
+		}
+		// ignore special files, like PushDir
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		op := SyncOp{Action: SyncPush, Local: p, Remote: target, Size: info.Size()}
+		switch {
+		case !found:
+			op.Reason = "missing"
+		default:
+			rinfo, _ := r.Info()
+			switch {
+			case uint32(syncSize(rinfo)) != uint32(info.Size()):
+				op.Reason = "size"
+			case opts.Checksum:
+				same = append(same, op)
+				return nil
+			case !rinfo.ModTime().Equal(info.ModTime().Truncate(time.Second)):
+				op.Reason = "mtime"
+			default:
+				return nil
+			}
+		}
+		pushes = append(pushes, op)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("walk dir %s: %w", local, err)
+	}
+
+	if len(same) > 0 {
+		changed, err := c.checksumChanged(ctx, same)
+		if err != nil {
+			return nil, err
+		}
+		pushes = append(pushes, changed...)
+	}
+
+	if opts.Delete {
+		for rel := range remotes {
+			// deleting a directory removes its content
+			if parent, found := remotes[path.Dir(rel)]; found && parent.IsDir() {
+				continue
+			}
+			deletes = append(deletes, SyncOp{Action: SyncDelete, Remote: path.Join(remote, rel)})
+		}
+		sort.Slice(deletes, func(i, j int) bool { return deletes[i].Remote < deletes[j].Remote })
+	}
+	return append(append(mkdirs, pushes...), deletes...), nil
+}
+
+// resolveSyncLink resolves the remote symlink rel for the comparison with a local entry.
+// A link to a directory is compared like a directory, its entries are added to remotes if
+// the local entry is a directory too. A link to a file is compared like a file, with the stat
+// of its target, or an unknown size if the target can't be read: the push replaces the link.
+func resolveSyncLink(fsys *DeviceFS, rel string, link fs.DirEntry, localDir bool, remotes map[string]fs.DirEntry) (fs.DirEntry, error) {
+	linfo, err := link.Info()
+	if err != nil {
+		return nil, err
+	}
+	// Stat follows symlinks to directories
+	if info, err := fsys.Stat(rel); err == nil && info.IsDir() {
+		if localDir {
+			err = fs.WalkDir(fsys, rel, func(name string, d fs.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+				if name != rel {
+					remotes[name] = d
+				}
+				return nil
+			})
+			if err != nil {
+				return nil, fmt.Errorf("list %s: %w", fsys.remotePath(rel), err)
+			}
+		}
+		return fs.FileInfoToDirEntry(info), nil
+	}
+
+	size, mtime, perm, err := fsys.device.remoteTargetStat(fsys.remotePath(rel))
+	if err != nil {
+		size, mtime, perm = -1, linfo.ModTime(), 0644
+	}
+	return fs.FileInfoToDirEntry(&symlinkTarget{FileInfo: linfo, size: size, perm: perm, mtime: mtime}), nil
+}
+
+// checksumChanged returns the ops of files whose remote md5 differs from the local one, the
+// hashing of large files is bounded by ctx.
+func (c *Device) checksumChanged(ctx context.Context, ops []SyncOp) (changed []SyncOp, err error) {
+	remotes := make([]string, len(ops))
+	for i, op := range ops {
+		remotes[i] = op.Remote
+	}
+	sums, err := c.remoteHashes(ctx, 0, HashMD5, remotes)
+	if err != nil {
+		return nil, err
+	}
+	for _, op := range ops {
+		sum, err := localHash(HashMD5, op.Local)
+		if err != nil {
+			return nil, err
+		}
+		if sums[op.Remote] != sum {
+			op.Reason = "checksum"
+			changed = append(changed, op)
+		}
+	}
+	return changed, nil
+}
+
+// runSyncPlan executes plan, the failed pushes are reported to handler and r, and returned joined.
+func (c *Device) runSyncPlan(ctx context.Context, plan SyncPlan, handler wire.SyncHandler, r ProgressReporter) error {
+	var mkdirs, deletes []string
+	var pushes []SyncOp
+	var bytes int64
+	for _, op := range plan {
+		switch op.Action {
+		case SyncMkdir:
+			mkdirs = append(mkdirs, op.Remote)
+		case SyncPush:
+			pushes = append(pushes, op)
+			bytes += op.Size
+		case SyncDelete:
+			deletes = append(deletes, op.Remote)
+		}
+	}
+
+	// entries whose type changed are deleted before being replaced
+	var errs []error
+	if len(deletes) > 0 {
+		if err := c.Rm(deletes); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(mkdirs) > 0 {
+		if err := c.MkdirsWithParent(mkdirs, true); err != nil {
+			return errors.Join(append(errs, err)...)
+		}
+	}
+
+	// after the deletes, the replaced files are counted whole
+	remotes := make([]string, len(pushes))
+	for i, op := range pushes {
+		remotes[i] = op.Remote
+	}
+	if err := c.filesPreflight(remotes, bytes); err != nil {
+		return errors.Join(append(errs, err)...)
+	}
+
+	var fconn *wire.SyncConn
+	defer func() {
+		if fconn != nil {
+			fconn.Close()
+		}
+	}()
+	total := uint64(len(pushes))
+	prog := newDirProgress(r, "push", int64(total), bytes)
+	for i, op := range pushes {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("sync failed by ctx done: %w", err)
+		}
+		if fconn == nil {
+			var err error
+			if fconn, err = c.NewSyncConn(); err != nil {
+				return errors.Join(append(errs, err)...)
+			}
+		}
+
+		sent := uint64(i + 1)
+		startTime := time.Now()
+		err := fconn.PushFile(op.Local, op.Remote, func(n uint64) {
+			prog.sent(op.Remote, int64(n))
+		})
+		if err == nil {
+			if handler != nil {
+				handler(total, sent, op.Remote, 100, speedMBPerSecond(uint64(op.Size), startTime), nil)
+			}
+			prog.done(op.Remote)
+		}
+		if err != nil {
+			// adbd ends the sync session after a failure
+			fconn.Close()
+			fconn = nil
+			err = fmt.Errorf("push %s: %w", op.Remote, err)
+			errs = append(errs, err)
+			if handler != nil {
+				handler(total, sent, op.Remote, 0, 0, err)
+			}
+			prog.fail(op.Remote, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,156 @@
+package adb
+
+import (
+	"crypto/md5"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prife/goadb/wire"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeLocalFile(t *testing.T, name, content string, mtime time.Time) {
+	assert.NoError(t, os.MkdirAll(filepath.Dir(name), 0755))
+	assert.NoError(t, os.WriteFile(name, []byte(content), 0644))
+	assert.NoError(t, os.Chtimes(name, mtime, mtime))
+}
+
+func syncOpsString(plan SyncPlan) (ops []string) {
+	for _, op := range plan {
+		ops = append(ops, op.Action.String()+" "+op.Remote+" "+op.Reason)
+	}
+	return
+}
+
+func TestDevice_SyncDir(t *testing.T) {
+	f := newFakeDevice(t)
+	f.Service = func(service string, conn *wire.Conn) {
+		// mkdir and rm are run by the fake shell
+		if args, ok := strings.CutPrefix(service, "shell:mkdir -p "); ok {
+			for _, name := range strings.Fields(args) {
+				os.MkdirAll(f.local(name), 0755)
+			}
+		} else if args, ok := strings.CutPrefix(service, "shell:rm -rf "); ok {
+			for _, name := range strings.Fields(args) {
+				os.RemoveAll(f.local(name))
+			}
+		}
+	}
+	d := f.Device()
+
+	local := t.TempDir()
+	writeLocalFile(t, filepath.Join(local, "a.txt"), "hello", someMtime)
+	writeLocalFile(t, filepath.Join(local, "dir", "b.txt"), "world", someMtime)
+
+	plan, err := d.SyncDir(local, "/data/res", SyncDirOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"mkdir /data/res ",
+		"mkdir /data/res/dir ",
+		"push /data/res/a.txt missing",
+		"push /data/res/dir/b.txt missing",
+	}, syncOpsString(plan))
+	data, err := os.ReadFile(f.local("data/res/dir/b.txt"))
+	assert.NoError(t, err)
+	assert.Equal(t, "world", string(data))
+
+	// nothing changed
+	plan, err = d.SyncDir(local, "/data/res", SyncDirOptions{})
+	assert.NoError(t, err)
+	assert.Empty(t, plan)
+	// the sizes of LIST are compared, without a stat(1) per file
+	for _, service := range f.Services() {
+		assert.False(t, strings.HasPrefix(service, "shell:stat "), service)
+	}
+
+	writeLocalFile(t, filepath.Join(local, "a.txt"), "hello!", someMtime)
+	writeLocalFile(t, filepath.Join(local, "dir", "b.txt"), "WORLD", someMtime.Add(time.Hour))
+	f.WriteFile(t, "data/res/extra/c.txt", "", someMtime)
+	f.WriteFile(t, "data/res/d.txt", "", someMtime)
+
+	plan, err = d.SyncDir(local, "/data/res", SyncDirOptions{Delete: true, DryRun: true})
+	assert.NoError(t, err)
+	want := []string{
+		"push /data/res/a.txt size",
+		"push /data/res/dir/b.txt mtime",
+		"delete /data/res/d.txt ",
+		"delete /data/res/extra ",
+	}
+	assert.Equal(t, want, syncOpsString(plan))
+	data, err = os.ReadFile(f.local("data/res/a.txt"))
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", string(data))
+
+	var pushed []string
+	plan, err = d.SyncDir(local, "/data/res", SyncDirOptions{
+		Delete: true,
+		Handler: func(totalFiles, sentFiles uint64, current string, percent, speed float64, err error) {
+			assert.NoError(t, err)
+			pushed = append(pushed, current)
+		},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, want, syncOpsString(plan))
+	assert.Equal(t, []string{"/data/res/a.txt", "/data/res/dir/b.txt"}, pushed)
+	_, err = os.Stat(f.local("data/res/extra"))
+	assert.True(t, os.IsNotExist(err))
+	data, err = os.ReadFile(f.local("data/res/dir/b.txt"))
+	assert.NoError(t, err)
+	assert.Equal(t, "WORLD", string(data))
+}
+
+func TestDevice_SyncDirSymlinks(t *testing.T) {
+	f := newFakeDevice(t)
+	f.Service = serveResumable(f, new(bool))
+	f.WriteFile(t, "data/real/a.txt", "hello", someMtime)
+	f.WriteFile(t, "data/real/dir/b.txt", "world", someMtime)
+	f.WriteFile(t, "data/real/c.txt", "old", someMtime)
+	assert.NoError(t, os.MkdirAll(f.local("data/res"), 0755))
+	for _, name := range []string{"a.txt", "dir", "c.txt"} {
+		assert.NoError(t, os.Symlink("../real/"+name, f.local("data/res/"+name)))
+	}
+	assert.NoError(t, os.Symlink("../real/missing", f.local("data/res/d.txt")))
+
+	local := t.TempDir()
+	writeLocalFile(t, filepath.Join(local, "a.txt"), "hello", someMtime)
+	writeLocalFile(t, filepath.Join(local, "dir", "b.txt"), "world", someMtime)
+	writeLocalFile(t, filepath.Join(local, "dir", "e.txt"), "new", someMtime)
+	writeLocalFile(t, filepath.Join(local, "c.txt"), "changed", someMtime)
+	writeLocalFile(t, filepath.Join(local, "d.txt"), "dangling", someMtime)
+
+	// links are compared with their targets, not as type conflicts
+	plan, err := f.Device().SyncDir(local, "/data/res", SyncDirOptions{DryRun: true})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"push /data/res/c.txt size",
+		"push /data/res/d.txt size",
+		"push /data/res/dir/e.txt missing",
+	}, syncOpsString(plan))
+}
+
+func TestParseMd5sums(t *testing.T) {
+	sums := make(map[string]string)
+	parseHashSums([]byte("5d41402abc4b2a76b9719d911017c592  /data/a b.txt\r\n"+
+		"md5sum: /data/c: No such file or directory\n"), md5.Size, sums)
+	assert.Equal(t, map[string]string{"/data/a b.txt": "5d41402abc4b2a76b9719d911017c592"}, sums)
+}
+
+func TestDevice_SyncDirChecksum(t *testing.T) {
+	f := newFakeDevice(t)
+	f.Service = serveHashSum(f)
+	f.WriteFile(t, "data/a.txt", "hello", someMtime)
+	f.WriteFile(t, "data/b.txt", "world", someMtime)
+
+	local := t.TempDir()
+	// same content, other mtime: skipped
+	writeLocalFile(t, filepath.Join(local, "a.txt"), "hello", someMtime.Add(time.Hour))
+	// same size and mtime, other content: pushed
+	writeLocalFile(t, filepath.Join(local, "b.txt"), "WORLD", someMtime)
+
+	plan, err := f.Device().SyncDir(local, "/data", SyncDirOptions{Checksum: true, DryRun: true})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"push /data/b.txt checksum"}, syncOpsString(plan))
+}
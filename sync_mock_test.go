@@ -0,0 +1,288 @@
+package adb
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prife/goadb/wire"
+)
+
+// fakeDevice plays a device over pipeServer: the sync service is served from the local
+// directory Root, like adbd does with the real filesystem, and other services are passed to Service.
+type fakeDevice struct {
+	Root string
+	// Service handles the services other than sync:, eg. shell:ls, conn is closed after it returns.
+	Service func(service string, conn *wire.Conn)
+	// Features are answered to host-serial:<serial>:features, eg. "stat_v2".
+	Features string
+
+	mu       sync.Mutex
+	services []string
+}
+
+func newFakeDevice(t *testing.T) *fakeDevice {
+	return &fakeDevice{Root: t.TempDir()}
+}
+
+// Device returns a Device talking to f.
+func (f *fakeDevice) Device() *Device {
+	s := &pipeServer{handler: f.serve}
+	return (&Adb{server: s}).Device(DeviceWithSerial("fake"))
+}
+
+// Services returns the services requested so far, each sync request is recorded after "sync:"
+// as "sync:<ID> <path>".
+func (f *fakeDevice) Services() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.services...)
+}
+
+func (f *fakeDevice) record(service string) {
+	f.mu.Lock()
+	f.services = append(f.services, service)
+	f.mu.Unlock()
+}
+
+// WriteFile creates a file under Root, with its parent dirs.
+func (f *fakeDevice) WriteFile(t *testing.T, name, content string, mtime time.Time) {
+	local := f.local(name)
+	if err := os.MkdirAll(filepath.Dir(local), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(local, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(local, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (f *fakeDevice) local(remote string) string {
+	return filepath.Join(f.Root, filepath.FromSlash(remote))
+}
+
+func (f *fakeDevice) serve(conn *wire.Conn) {
+	// the features are asked to the server, before any transport
+	msg, err := conn.ReadMessage()
+	if err != nil {
+		return
+	}
+	if _, err = conn.Write([]byte(wire.StatusSuccess)); err != nil {
+		return
+	}
+	if strings.HasSuffix(string(msg), ":features") {
+		f.record(string(msg))
+		writeHexMessage(conn, f.Features)
+		return
+	}
+	service, err := conn.ReadMessage()
+	if err != nil {
+		return
+	}
+	if _, err = conn.Write([]byte(wire.StatusSuccess)); err != nil {
+		return
+	}
+	f.record(string(service))
+	if string(service) != "sync:" {
+		if f.Service != nil {
+			f.Service(string(service), conn)
+		}
+		return
+	}
+
+	var header [8]byte
+	for {
+		if _, err := io.ReadFull(conn, header[:]); err != nil {
+			return
+		}
+		id := string(header[:4])
+		data := make([]byte, binary.LittleEndian.Uint32(header[4:]))
+		if _, err := io.ReadFull(conn, data); err != nil {
+			return
+		}
+		f.record("sync:" + id + " " + string(data))
+
+		switch id {
+		case wire.ID_LSTAT_V1:
+			err = f.stat(conn, string(data))
+		case wire.ID_LSTAT_V2:
+			err = f.lstatV2(conn, string(data))
+		case wire.ID_LIST_V1:
+			err = f.list(conn, string(data))
+		case wire.ID_RECV:
+			err = f.recv(conn, string(data))
+		case wire.ID_SEND:
+			err = f.send(conn, string(data))
+		default: // QUIT
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// adbMode converts mode to the st_mode of linux.
+func adbMode(mode fs.FileMode) uint32 {
+	m := uint32(mode.Perm())
+	switch {
+	case mode&fs.ModeSymlink != 0:
+		m |= wire.ModeSymlink
+	case mode.IsDir():
+		m |= wire.ModeDir
+	default:
+		m |= 0100000
+	}
+	return m
+}
+
+func appendStat(b []byte, id string, info fs.FileInfo) []byte {
+	b = append(b, id...)
+	if info == nil {
+		return append(b, make([]byte, 12)...)
+	}
+	b = binary.LittleEndian.AppendUint32(b, adbMode(info.Mode()))
+	b = binary.LittleEndian.AppendUint32(b, uint32(info.Size()))
+	return binary.LittleEndian.AppendUint32(b, uint32(info.ModTime().Unix()))
+}
+
+// stat keeps a trailing slash, which resolves a symlink to a directory like lstat(2).
+func (f *fakeDevice) stat(conn io.Writer, path string) error {
+	local := f.local(path)
+	if strings.HasSuffix(path, "/") {
+		local += "/"
+	}
+	info, _ := os.Lstat(local)
+	_, err := conn.Write(appendStat(nil, wire.ID_LSTAT_V1, info))
+	return err
+}
+
+// lstatV2 sends the errno ENOENT, or the mode, the 64-bit size and the mtime of path.
+func (f *fakeDevice) lstatV2(conn io.Writer, path string) error {
+	b := make([]byte, 72)
+	copy(b, wire.ID_LSTAT_V2)
+	if info, err := os.Lstat(f.local(path)); err != nil {
+		binary.LittleEndian.PutUint32(b[4:], 2)
+	} else {
+		binary.LittleEndian.PutUint32(b[24:], adbMode(info.Mode()))
+		binary.LittleEndian.PutUint64(b[40:], uint64(info.Size()))
+		binary.LittleEndian.PutUint64(b[56:], uint64(info.ModTime().Unix()))
+	}
+	_, err := conn.Write(b)
+	return err
+}
+
+// list sends "." and ".." like adbd, followed by the entries, or nothing if it can't read path.
+func (f *fakeDevice) list(conn io.Writer, path string) error {
+	var b []byte
+	local := f.local(path)
+	entries, err := os.ReadDir(local)
+	// adbd runs as shell, the tests may run as root
+	if info, serr := os.Stat(local); err != nil || serr != nil || info.Mode().Perm()&0400 == 0 {
+		b = append(b, wire.ID_DONE...)
+		_, err = conn.Write(append(b, make([]byte, 16)...))
+		return err
+	}
+	names := []string{".", ".."}
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	for _, name := range names {
+		info, err := os.Lstat(filepath.Join(local, name))
+		if err != nil {
+			continue
+		}
+		b = appendStat(b, wire.ID_DENT_V1, info)
+		b = binary.LittleEndian.AppendUint32(b, uint32(len(name)))
+		b = append(b, name...)
+	}
+	b = append(b, wire.ID_DONE...)
+	b = append(b, make([]byte, 16)...)
+	_, err = conn.Write(b)
+	return err
+}
+
+func syncFail(conn io.Writer, msg string) error {
+	b := binary.LittleEndian.AppendUint32([]byte(wire.ID_FAIL), uint32(len(msg)))
+	_, err := conn.Write(append(b, msg...))
+	return err
+}
+
+func (f *fakeDevice) recv(conn io.Writer, path string) error {
+	file, err := os.Open(f.local(path))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return syncFail(conn, "open failed: No such file or directory")
+		}
+		return syncFail(conn, err.Error())
+	}
+	defer file.Close()
+
+	buf := make([]byte, wire.SyncMaxChunkSize)
+	for {
+		n, err := file.Read(buf)
+		if n > 0 {
+			b := binary.LittleEndian.AppendUint32([]byte(wire.ID_DATA), uint32(n))
+			if _, err := conn.Write(append(b, buf[:n]...)); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return syncFail(conn, err.Error())
+		}
+	}
+	_, err = conn.Write(append([]byte(wire.ID_DONE), 0, 0, 0, 0))
+	return err
+}
+
+// send receives a file, creating the parent dirs like adbd, which removes it if the
+// connection is closed before DONE.
+func (f *fakeDevice) send(conn io.ReadWriter, pathAndMode string) error {
+	i := strings.LastIndexByte(pathAndMode, ',')
+	path := pathAndMode[:i]
+	mode, _ := strconv.Atoi(pathAndMode[i+1:])
+
+	local := f.local(path)
+	os.MkdirAll(filepath.Dir(local), 0755)
+	file, err := os.OpenFile(local, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, fs.FileMode(mode).Perm())
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var header [8]byte
+	for {
+		if _, err := io.ReadFull(conn, header[:]); err != nil {
+			file.Close()
+			os.Remove(local)
+			return err
+		}
+		n := binary.LittleEndian.Uint32(header[4:])
+		switch string(header[:4]) {
+		case wire.ID_DATA:
+			if _, err := io.CopyN(file, conn, int64(n)); err != nil {
+				return err
+			}
+		case wire.ID_DONE:
+			file.Close()
+			mtime := time.Unix(int64(n), 0)
+			os.Chtimes(local, mtime, mtime)
+			_, err := conn.Write(append([]byte(wire.ID_OKAY), 0, 0, 0, 0))
+			return err
+		default:
+			return syncFail(conn, "invalid data message")
+		}
+	}
+}
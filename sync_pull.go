@@ -0,0 +1,323 @@
+package adb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/prife/goadb/wire"
+)
+
+// SymlinkPolicy tells PullDir what to do with remote symlinks.
+type SymlinkPolicy int
+
+const (
+	// SymlinkSkip ignores symlinks.
+	SymlinkSkip SymlinkPolicy = iota
+	// SymlinkFollow pulls the target of symlinks, like `adb pull` does.
+	// Symlinks to directories are followed up to MaxSymlinkDepth nested levels, to break loops.
+	SymlinkFollow
+	// SymlinkPreserve recreates symlinks locally, the target is read by `readlink` on the device.
+	SymlinkPreserve
+)
+
+// MaxSymlinkDepth is the number of nested symlinks to directories followed by SymlinkFollow.
+const MaxSymlinkDepth = 8
+
+// PullDirOptions are the options of PullDir.
+type PullDirOptions struct {
+	// WithSrcDir creates local/<base of remote>, instead of pulling the content of remote into local.
+	WithSrcDir bool
+	Symlinks   SymlinkPolicy
+	// Handler is called after each chunk of a file, and once for each entry which failed.
+	Handler wire.SyncHandler
+	// Progress receives the bytes and files pulled, their totals are known once the tree is scanned.
+	Progress ProgressReporter
+}
+
+// PullDir pulls the remote directory to local, like `adb pull -a`: the tree is recreated
+// and the mode bits and modification times are restored.
+// Entries which can't be read are skipped, and their errors are returned joined at the end.
+func (c *Device) PullDir(remote, local string, opts PullDirOptions) error {
+	return c.PullDirCtx(context.Background(), remote, local, opts)
+}
+
+func (c *Device) PullDirCtx(ctx context.Context, remote, local string, opts PullDirOptions) error {
+	if remote != "/" {
+		remote = strings.TrimSuffix(remote, "/")
+	}
+	fsys := c.FS(remote)
+	defer fsys.Close()
+
+	info, err := fsys.Stat(".")
+	if err != nil {
+		return fmt.Errorf("pull %s: %w", remote, err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("pull %s: not dir", remote)
+	}
+	if opts.WithSrcDir {
+		local = filepath.Join(local, path.Base(remote))
+	}
+
+	p := &dirPuller{ctx: ctx, device: c, fsys: fsys, local: local, opts: opts,
+		prog: newDirProgress(opts.Progress, "pull", 0, 0)}
+	p.walk(".", info, 0)
+	if err = ctx.Err(); err != nil {
+		return fmt.Errorf("pull failed by ctx done: %w", err)
+	}
+
+	// directories are created writable, their modes are restored once filled, deepest first
+	for i := len(p.dirs) - 1; i >= 0; i-- {
+		d := p.dirs[i]
+		target := p.localPath(d.rel)
+		if err := os.Chmod(target, d.info.Mode().Perm()); err != nil {
+			p.errs = append(p.errs, err)
+		}
+		if err := os.Chtimes(target, d.info.ModTime(), d.info.ModTime()); err != nil {
+			p.errs = append(p.errs, err)
+		}
+	}
+	return errors.Join(p.errs...)
+}
+
+type pulledDir struct {
+	rel  string
+	info fs.FileInfo
+}
+
+type dirPuller struct {
+	ctx    context.Context
+	device *Device
+	fsys   *DeviceFS
+	local  string
+	opts   PullDirOptions
+	prog   *dirProgress
+
+	dirs    []pulledDir
+	errs    []error
+	total   uint64
+	pulled  uint64
+	pending []pulledFile
+}
+
+type pulledFile struct {
+	rel  string
+	info fs.FileInfo
+}
+
+func (p *dirPuller) localPath(rel string) string {
+	return filepath.Join(p.local, filepath.FromSlash(rel))
+}
+
+func (p *dirPuller) fail(rel string, err error) {
+	p.errs = append(p.errs, err)
+	if p.opts.Handler != nil {
+		p.opts.Handler(p.total, p.pulled, p.fsys.remotePath(rel), 0, 0, err)
+	}
+	p.prog.fail(p.fsys.remotePath(rel), err)
+}
+
+// walk scans the tree first to count files for progress, then pulls them.
+func (p *dirPuller) walk(rel string, info fs.FileInfo, depth int) {
+	p.scan(rel, info, depth)
+	var bytes int64
+	for _, f := range p.pending {
+		bytes += syncSize(f.info)
+	}
+	p.prog.setTotal(int64(p.total), bytes)
+	for _, f := range p.pending {
+		if p.ctx.Err() != nil {
+			return
+		}
+		p.pulled++
+		if err := p.pullFile(f.rel, f.info); err != nil {
+			p.fail(f.rel, err)
+		} else {
+			p.prog.done(p.fsys.remotePath(f.rel))
+		}
+	}
+}
+
+func (p *dirPuller) scan(rel string, info fs.FileInfo, depth int) {
+	if p.ctx.Err() != nil {
+		return
+	}
+	if err := os.MkdirAll(p.localPath(rel), 0755); err != nil {
+		p.fail(rel, err)
+		return
+	}
+	p.dirs = append(p.dirs, pulledDir{rel, info})
+
+	entries, err := p.fsys.ReadDir(rel)
+	if err != nil {
+		p.fail(rel, err)
+		return
+	}
+	for _, entry := range entries {
+		child := path.Join(rel, entry.Name())
+		childInfo, _ := entry.Info()
+
+		if entry.Type()&fs.ModeSymlink != 0 {
+			switch p.opts.Symlinks {
+			case SymlinkSkip:
+				continue
+			case SymlinkPreserve:
+				if err := p.pullSymlink(child); err != nil {
+					p.fail(child, err)
+				}
+				continue
+			}
+			// follow: Stat resolves symlinks to directories
+			target, err := p.fsys.Stat(child)
+			if err != nil {
+				p.fail(child, err)
+				continue
+			}
+			if target.IsDir() {
+				if depth >= MaxSymlinkDepth {
+					p.fail(child, fmt.Errorf("%s: too many levels of symbolic links", p.fsys.remotePath(child)))
+					continue
+				}
+				p.scan(child, target, depth+1)
+				continue
+			}
+			if target, err = p.targetInfo(child, target); err != nil {
+				p.fail(child, err)
+				continue
+			}
+			p.pending = append(p.pending, pulledFile{child, target})
+			p.total++
+			continue
+		}
+
+		switch {
+		case entry.IsDir():
+			p.scan(child, childInfo, depth)
+		case entry.Type().IsRegular():
+			p.pending = append(p.pending, pulledFile{child, childInfo})
+			p.total++
+		}
+		// devices, sockets and fifos are ignored, like adb pull
+	}
+}
+
+// symlinkTarget is the fs.FileInfo of the target of a symlink to a file.
+type symlinkTarget struct {
+	fs.FileInfo
+	size  int64
+	perm  fs.FileMode
+	mtime time.Time
+}
+
+func (t *symlinkTarget) Size() int64        { return t.size }
+func (t *symlinkTarget) Mode() fs.FileMode  { return t.perm }
+func (t *symlinkTarget) ModTime() time.Time { return t.mtime }
+func (t *symlinkTarget) IsDir() bool        { return false }
+
+// targetInfo returns the info of the target of the symlink rel, since the sync protocol only
+// has lstat. Without stat(1), before Android 6, the copy gets the default mode and the
+// mtime of the link, rather than the 0777 of the link.
+func (p *dirPuller) targetInfo(rel string, link fs.FileInfo) (fs.FileInfo, error) {
+	remote := p.fsys.remotePath(rel)
+	size, mtime, perm, err := p.device.remoteTargetStat(remote)
+	if errors.Is(err, wire.ErrFileNoExist) {
+		return nil, &fs.PathError{Op: "pull", Path: remote, Err: fs.ErrNotExist}
+	} else if err != nil {
+		return &symlinkTarget{FileInfo: link, size: link.Size(), perm: 0644, mtime: link.ModTime()}, nil
+	}
+	return &symlinkTarget{FileInfo: link, size: size, perm: perm, mtime: mtime}, nil
+}
+
+func (p *dirPuller) pullSymlink(rel string) error {
+	remote := p.fsys.remotePath(rel)
+	resp, err := p.device.RunCommand("readlink", remote)
+	if err != nil {
+		return fmt.Errorf("readlink %s: %w", remote, err)
+	}
+	target := strings.TrimRight(string(resp), "\r\n")
+	if target == "" {
+		return fmt.Errorf("readlink %s: empty target", remote)
+	}
+	return os.Symlink(target, p.localPath(rel))
+}
+
+func (p *dirPuller) pullFile(rel string, info fs.FileInfo) error {
+	remote := p.fsys.remotePath(rel)
+	src, err := p.fsys.Open(rel)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	target := p.localPath(rel)
+	dst, err := os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	totalSize := syncSize(info)
+	var sentSize int64
+	startTime := time.Now()
+	percent := -1
+	buf := make([]byte, wire.SyncMaxChunkSize)
+	for {
+		if err = p.ctx.Err(); err != nil {
+			break
+		}
+		var n int
+		n, err = src.Read(buf)
+		if n > 0 {
+			if _, werr := dst.Write(buf[:n]); werr != nil {
+				err = werr
+				break
+			}
+			sentSize += int64(n)
+			p.prog.sent(remote, int64(n))
+			p.progress(remote, totalSize, sentSize, startTime, &percent)
+		}
+		if err == io.EOF {
+			err = nil
+			break
+		} else if err != nil {
+			break
+		}
+	}
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(target)
+		return fmt.Errorf("pull %s: %w", remote, err)
+	}
+
+	if err = os.Chmod(target, info.Mode().Perm()); err != nil {
+		return err
+	}
+	return os.Chtimes(target, info.ModTime(), info.ModTime())
+}
+
+// progress reports the percent of the current file, every 5% for files bigger than 10MB,
+// and only at the end for smaller ones, like PushDir.
+func (p *dirPuller) progress(remote string, totalSize, sentSize int64, startTime time.Time, lastPercent *int) {
+	if p.opts.Handler == nil {
+		return
+	}
+	percent := 100
+	if totalSize > 0 && sentSize < totalSize {
+		percent = int(sentSize * 100 / totalSize)
+	}
+	if percent != 100 && (totalSize < 1024*1024*10 || percent-*lastPercent < 5) {
+		return
+	}
+	*lastPercent = percent
+
+	p.opts.Handler(p.total, p.pulled, remote, float64(percent), speedMBPerSecond(uint64(sentSize), startTime), nil)
+}
@@ -0,0 +1,133 @@
+package adb
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prife/goadb/wire"
+	"github.com/stretchr/testify/assert"
+)
+
+func newPullDirDevice(t *testing.T) *fakeDevice {
+	f := newFakeDevice(t)
+	f.WriteFile(t, "data/a.txt", "hello", someMtime)
+	f.WriteFile(t, "data/dir/b.sh", "#!/bin/sh", someMtime)
+	assert.NoError(t, os.Chmod(f.local("data/dir/b.sh"), 0750))
+	assert.NoError(t, os.Mkdir(f.local("data/empty"), 0700))
+	assert.NoError(t, os.Chtimes(f.local("data/empty"), someMtime, someMtime))
+	assert.NoError(t, os.Symlink("a.txt", f.local("data/link.txt")))
+	assert.NoError(t, os.Symlink("dir", f.local("data/linkdir")))
+	stat := serveResumable(f, new(bool))
+	f.Service = func(service string, conn *wire.Conn) {
+		if remote, ok := strings.CutPrefix(service, "shell:readlink "); ok {
+			target, _ := os.Readlink(f.local(remote))
+			conn.Write([]byte(target + "\n"))
+			return
+		}
+		stat(service, conn)
+	}
+	return f
+}
+
+func TestDevice_PullDir(t *testing.T) {
+	f := newPullDirDevice(t)
+	local := t.TempDir()
+
+	var files []string
+	err := f.Device().PullDir("/data/", local, PullDirOptions{
+		WithSrcDir: true,
+		Handler: func(totalFiles, sentFiles uint64, current string, percent, speed float64, err error) {
+			assert.NoError(t, err)
+			assert.Equal(t, uint64(2), totalFiles)
+			files = append(files, current)
+		},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"/data/a.txt", "/data/dir/b.sh"}, files)
+
+	data, err := os.ReadFile(filepath.Join(local, "data", "dir", "b.sh"))
+	assert.NoError(t, err)
+	assert.Equal(t, "#!/bin/sh", string(data))
+
+	info, err := os.Stat(filepath.Join(local, "data", "dir", "b.sh"))
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0750), info.Mode().Perm())
+	assert.Equal(t, someMtime, info.ModTime().UTC())
+
+	info, err = os.Stat(filepath.Join(local, "data", "empty"))
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0700), info.Mode().Perm())
+	assert.Equal(t, someMtime, info.ModTime().UTC())
+
+	_, err = os.Lstat(filepath.Join(local, "data", "link.txt"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestDevice_PullDirSymlinks(t *testing.T) {
+	f := newPullDirDevice(t)
+	assert.NoError(t, os.Chmod(f.local("data/a.txt"), 0600))
+
+	local := t.TempDir()
+	err := f.Device().PullDir("/data", local, PullDirOptions{Symlinks: SymlinkFollow})
+	assert.NoError(t, err)
+	data, err := os.ReadFile(filepath.Join(local, "link.txt"))
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", string(data))
+	// the mode and mtime of the target, not of the link
+	info, err := os.Stat(filepath.Join(local, "link.txt"))
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	assert.Equal(t, someMtime, info.ModTime().UTC())
+	data, err = os.ReadFile(filepath.Join(local, "linkdir", "b.sh"))
+	assert.NoError(t, err)
+	assert.Equal(t, "#!/bin/sh", string(data))
+
+	local = t.TempDir()
+	err = f.Device().PullDir("/data", local, PullDirOptions{Symlinks: SymlinkPreserve})
+	assert.NoError(t, err)
+	target, err := os.Readlink(filepath.Join(local, "linkdir"))
+	assert.NoError(t, err)
+	assert.Equal(t, "dir", target)
+}
+
+func TestDevice_PullDirErrors(t *testing.T) {
+	f := newPullDirDevice(t)
+	// a dangling symlink can't be pulled, the other entries are
+	assert.NoError(t, os.Symlink("missing", f.local("data/dangling")))
+
+	local := t.TempDir()
+	var failed []string
+	err := f.Device().PullDir("/data", local, PullDirOptions{
+		Symlinks: SymlinkFollow,
+		Handler: func(totalFiles, sentFiles uint64, current string, percent, speed float64, err error) {
+			if err != nil {
+				failed = append(failed, current)
+			}
+		},
+	})
+	assert.Error(t, err)
+	assert.Equal(t, []string{"/data/dangling"}, failed)
+	_, err = os.Stat(filepath.Join(local, "dir", "b.sh"))
+	assert.NoError(t, err)
+
+	// an unreadable directory is reported, not pulled as empty
+	f.WriteFile(t, "data/secret/key.txt", "secret", someMtime)
+	assert.NoError(t, os.Chmod(f.local("data/secret"), 0300))
+	defer os.Chmod(f.local("data/secret"), 0755)
+	failed = nil
+	err = f.Device().PullDir("/data", t.TempDir(), PullDirOptions{
+		Handler: func(totalFiles, sentFiles uint64, current string, percent, speed float64, err error) {
+			if err != nil {
+				failed = append(failed, current)
+			}
+		},
+	})
+	assert.ErrorIs(t, err, fs.ErrPermission)
+	assert.Equal(t, []string{"/data/secret"}, failed)
+
+	err = f.Device().PullDir("/missing", local, PullDirOptions{})
+	assert.Error(t, err)
+}
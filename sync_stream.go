@@ -0,0 +1,157 @@
+package adb
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/prife/goadb/wire"
+)
+
+// exactReader reads n bytes from r, an EOF before is io.ErrUnexpectedEOF.
+type exactReader struct {
+	r io.Reader
+	n int64
+}
+
+func (e *exactReader) Read(p []byte) (int, error) {
+	if e.n <= 0 {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > e.n {
+		p = p[:e.n]
+	}
+	n, err := e.r.Read(p)
+	e.n -= int64(n)
+	if err == io.EOF && e.n > 0 {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+// pushStream sends r to remote by sync, closing the connection if ctx is done.
+// The file is only committed by DONE, adbd removes it if r fails.
+func (c *Device) pushStream(ctx context.Context, r io.Reader, remote string, mode os.FileMode, mtime time.Time, progress func(n uint64)) error {
+	fconn, err := c.NewSyncConn()
+	if err != nil {
+		return err
+	}
+	defer fconn.Close()
+	defer closeOnDone(ctx, fconn)()
+
+	writer, err := fconn.Send(remote, mode, mtime)
+	if err != nil {
+		return err
+	}
+	buf := make([]byte, wire.SyncMaxChunkSize)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			if _, err := writer.Write(buf[:n]); err != nil {
+				return err
+			}
+			progress(uint64(n))
+		}
+		if err == io.EOF {
+			return writer.CopyDone()
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+// PushReader pushes the content of r to remotePath, created with mode and mtime, without a
+// temp file, eg. from a HTTP body. If size is not negative, exactly size bytes are read from r,
+// and the push fails if r ends before. Otherwise r is read until EOF and totalSize is 0 in
+// the calls of handler.
+func (c *Device) PushReader(ctx context.Context, r io.Reader, size int64, remotePath string, mode os.FileMode, mtime time.Time, handler wire.SyncFileHandler) error {
+	if size >= 0 {
+		if c.StoragePreflight {
+			if err := c.storagePreflight(remotePath, size); err != nil {
+				return fmt.Errorf("push failed: %w", err)
+			}
+		}
+		r = &exactReader{r: r, n: size}
+	}
+	var sent uint64
+	startTime := time.Now()
+	err := c.pushStream(ctx, r, remotePath, mode, mtime, func(n uint64) {
+		sent += n
+		if handler != nil {
+			var total uint64
+			var percent float64
+			if size > 0 {
+				total = uint64(size)
+				percent = float64(sent) * 100 / float64(size)
+			}
+			handler(total, sent, percent, speedMBPerSecond(sent, startTime))
+		}
+	})
+	if err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("push failed by ctx done: %w", ctx.Err())
+		}
+		return fmt.Errorf("push failed: %w", err)
+	}
+	return nil
+}
+
+// PullWriter pulls the remote file to w, without a temp file, and returns the number of
+// bytes written. The size for handler is the one of stat, which is truncated to 32 bits.
+func (c *Device) PullWriter(ctx context.Context, remotePath string, w io.Writer, handler wire.SyncFileHandler) (int64, error) {
+	fconn, err := c.NewSyncConn()
+	if err != nil {
+		return 0, err
+	}
+	defer fconn.Close()
+	defer closeOnDone(ctx, fconn)()
+
+	var size uint32
+	if handler != nil {
+		info, err := fconn.Stat(remotePath)
+		if err != nil {
+			return 0, fmt.Errorf("pull: stat remote file %s: %w", remotePath, err)
+		}
+		size = uint32(info.Size)
+	}
+
+	n, err := func() (int64, error) {
+		reader, err := fconn.Recv(remotePath)
+		if err != nil {
+			return 0, err
+		}
+		var received int64
+		startTime := time.Now()
+		buf := make([]byte, wire.SyncMaxChunkSize)
+		for {
+			n, err := reader.Read(buf)
+			if n > 0 {
+				if _, err := w.Write(buf[:n]); err != nil {
+					return received, err
+				}
+				received += int64(n)
+				if handler != nil {
+					percent := float64(100)
+					if size > 0 {
+						percent = float64(received) * 100 / float64(size)
+					}
+					handler(uint64(size), uint64(received), percent, speedMBPerSecond(uint64(received), startTime))
+				}
+			}
+			if err == io.EOF {
+				return received, nil
+			} else if err != nil {
+				return received, err
+			}
+		}
+	}()
+	if err != nil {
+		if ctx.Err() != nil {
+			return n, fmt.Errorf("pull failed by ctx done: %w", ctx.Err())
+		}
+		return n, fmt.Errorf("pull failed: %w", err)
+	}
+	return n, nil
+}
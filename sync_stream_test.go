@@ -0,0 +1,135 @@
+package adb
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prife/goadb/wire"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDevice_PushReader(t *testing.T) {
+	f := newFakeDevice(t)
+	d := f.Device()
+
+	var sent []uint64
+	content := strings.Repeat("x", wire.SyncMaxChunkSize+10)
+	err := d.PushReader(context.Background(), strings.NewReader(content), int64(len(content)), "/data/a.bin", 0600, someMtime,
+		func(totalSize, sentSize uint64, percent, speedMBPerSecond float64) {
+			assert.Equal(t, uint64(len(content)), totalSize)
+			sent = append(sent, sentSize)
+		})
+	assert.NoError(t, err)
+	assert.Equal(t, []uint64{wire.SyncMaxChunkSize, uint64(len(content))}, sent)
+	info, err := os.Stat(f.local("data/a.bin"))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len(content)), info.Size())
+	assert.Equal(t, fs.FileMode(0600), info.Mode().Perm())
+	assert.Equal(t, someMtime, info.ModTime().UTC())
+
+	// unknown size
+	err = d.PushReader(context.Background(), io.MultiReader(strings.NewReader("hello "), strings.NewReader("world")), -1, "/data/b.txt", 0644, someMtime, nil)
+	assert.NoError(t, err)
+	data, err := os.ReadFile(f.local("data/b.txt"))
+	assert.NoError(t, err)
+	assert.Equal(t, "hello world", string(data))
+
+	// the reader ends before size: the file is not committed
+	err = d.PushReader(context.Background(), strings.NewReader("short"), 10, "/data/c.txt", 0644, someMtime, nil)
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	assert.Eventually(t, func() bool {
+		_, err := os.Stat(f.local("data/c.txt"))
+		return os.IsNotExist(err)
+	}, time.Second, 10*time.Millisecond)
+}
+
+// blockingReader returns its data, then blocks until ctx is done.
+type blockingReader struct {
+	ctx  context.Context
+	data []byte
+}
+
+func (r *blockingReader) Read(p []byte) (int, error) {
+	if len(r.data) > 0 {
+		n := copy(p, r.data)
+		r.data = r.data[n:]
+		return n, nil
+	}
+	<-r.ctx.Done()
+	return 0, errors.New("reader closed")
+}
+
+func TestDevice_PushReaderCancel(t *testing.T) {
+	f := newFakeDevice(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	var once bool
+	err := f.Device().PushReader(ctx, &blockingReader{ctx: ctx, data: []byte("hello")}, -1, "/data/a.txt", 0644, someMtime,
+		func(totalSize, sentSize uint64, percent, speedMBPerSecond float64) {
+			assert.Equal(t, uint64(0), totalSize)
+			assert.Equal(t, float64(0), percent)
+			if !once {
+				once = true
+				cancel()
+			}
+		})
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestDevice_PullWriter(t *testing.T) {
+	f := newFakeDevice(t)
+	content := strings.Repeat("y", wire.SyncMaxChunkSize*2+1)
+	f.WriteFile(t, "data/a.bin", content, someMtime)
+
+	var buf bytes.Buffer
+	var percents []float64
+	n, err := f.Device().PullWriter(context.Background(), "/data/a.bin", &buf,
+		func(totalSize, sentSize uint64, percent, speedMBPerSecond float64) {
+			assert.Equal(t, uint64(len(content)), totalSize)
+			percents = append(percents, percent)
+		})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len(content)), n)
+	assert.Equal(t, content, buf.String())
+	assert.Equal(t, float64(100), percents[len(percents)-1])
+
+	_, err = f.Device().PullWriter(context.Background(), "/data/none", &buf, nil)
+	assert.ErrorIs(t, err, wire.ErrFileNoExist)
+}
+
+func TestDevice_RateLimit(t *testing.T) {
+	f := newFakeDevice(t)
+	d := f.Device()
+	assert.Equal(t, int64(0), d.RateLimit())
+	// the burst of 10 chunks, then one chunk per 100ms
+	limit := int64(wire.SyncMaxChunkSize * 10)
+	content := strings.Repeat("z", wire.SyncMaxChunkSize*12)
+
+	// limited during the transfer
+	startTime := time.Now()
+	err := d.PushReader(context.Background(), strings.NewReader(content), int64(len(content)), "/data/a.bin", 0644, someMtime,
+		func(totalSize, sentSize uint64, percent, speedMBPerSecond float64) {
+			if sentSize == wire.SyncMaxChunkSize {
+				d.SetRateLimit(limit)
+			}
+		})
+	assert.NoError(t, err)
+	assert.GreaterOrEqual(t, time.Since(startTime), 80*time.Millisecond)
+	assert.Equal(t, limit, d.RateLimit())
+
+	// limited by the Adb of d
+	d.SetRateLimit(0)
+	d.adbRateLimiter.SetLimit(limit)
+	var buf bytes.Buffer
+	startTime = time.Now()
+	_, err = d.PullWriter(context.Background(), "/data/a.bin", &buf, nil)
+	assert.NoError(t, err)
+	assert.GreaterOrEqual(t, time.Since(startTime), 180*time.Millisecond)
+	assert.Equal(t, content, buf.String())
+}
@@ -0,0 +1,395 @@
+package adb
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/prife/goadb/wire"
+)
+
+// openExec opens the exec: service, like `adb exec-in` and `adb exec-out`: unlike shell:,
+// the stream is raw, so binary data is not altered. cmd is run by sh.
+func (c *Device) openExec(cmd string) (wire.IConn, error) {
+	conn, err := c.dialDevice(c.CmdTimeoutShort)
+	if err != nil {
+		return nil, err
+	}
+	req := "exec:" + cmd
+	if err = conn.SendMessage([]byte(req)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if _, err = readStatusWithTimeout(conn, req, c.CmdTimeoutShort); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// hasCommand checks that the device has the command name, eg. tar which toybox only has
+// from Android 6.
+func (c *Device) hasCommand(name string) bool {
+	resp, err := c.RunCommand("command -v " + name)
+	return err == nil && len(bytes.TrimSpace(resp)) > 0
+}
+
+// tarErrFile keeps the errors of `tar -c` on the device, $$ is the pid of the exec shell.
+const tarErrFile = "/data/local/tmp/goadb-tar-$$.err"
+
+// tarTailReader keeps the last tarTailSize bytes read from r.
+type tarTailReader struct {
+	r    io.Reader
+	tail []byte
+}
+
+const tarTailSize = 4096
+
+func (t *tarTailReader) Read(p []byte) (int, error) {
+	n, err := t.r.Read(p)
+	b := p[:n]
+	if len(b) > tarTailSize {
+		b = b[len(b)-tarTailSize:]
+	}
+	t.tail = append(t.tail, b...)
+	if len(t.tail) > tarTailSize {
+		t.tail = append(t.tail[:0], t.tail[len(t.tail)-tarTailSize:]...)
+	}
+	return n, err
+}
+
+// closeOnDone closes conn when ctx is done, until the returned stop is called.
+func closeOnDone(ctx context.Context, conn io.Closer) (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+	return func() { close(done) }
+}
+
+// PushDirTar pushes the local directory like PushDir, but as a single tar archive streamed
+// into `tar -x` on the device, which is much faster for trees of many small files.
+// It falls back to PushDir when the device has no tar.
+func (c *Device) PushDirTar(ctx context.Context, local, remote string, withSrcDir bool, handler wire.SyncHandler) error {
+	if !c.hasCommand("tar") {
+		return c.PushDirCtx(ctx, local, remote, PushDirOptions{WithSrcDir: withSrcDir, Handler: handler})
+	}
+
+	local, err := filepath.Abs(local)
+	if err != nil {
+		return err
+	}
+	linfo, err := os.Stat(local)
+	if err != nil {
+		return err
+	}
+	if !linfo.IsDir() {
+		return fmt.Errorf("not dir: %s", local)
+	}
+	if err = c.dirPreflight(local, remote); err != nil {
+		return fmt.Errorf("push failed: %w", err)
+	}
+	if withSrcDir {
+		remote = path.Join(remote, filepath.Base(local))
+	}
+
+	// count the regular files for the progress, like PushDir
+	var totalFiles uint64
+	err = filepath.WalkDir(local, func(p string, d fs.DirEntry, err error) error {
+		if err == nil && d.Type().IsRegular() {
+			totalFiles++
+		}
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("walk dir %s failed: %w", local, err)
+	}
+
+	dir := shellQuote(remote)
+	conn, err := c.openExec(fmt.Sprintf("mkdir -p %s && tar -xf - -C %s 2>&1; echo %s$?", dir, dir, exitStatusMarker))
+	if err != nil {
+		return fmt.Errorf("push: %w", err)
+	}
+	defer conn.Close()
+	defer closeOnDone(ctx, conn)()
+
+	// tar prints its errors while reading the archive
+	outCh := make(chan []byte, 1)
+	go func() {
+		out, _ := io.ReadAll(conn)
+		outCh <- out
+	}()
+
+	// tar stops at the end of the archive, since exec: can't close stdin alone
+	tw := tar.NewWriter(conn)
+	err = writeTar(tw, local, totalFiles, remote, handler)
+	if err == nil {
+		err = tw.Close()
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("push failed by ctx done: %w", ctx.Err())
+		}
+		// a tar which exited early broke the stream, its message tells why
+		conn.Close()
+		if serr := parseExitStatus(<-outCh); serr != nil && !errors.Is(serr, wire.ErrParse) {
+			return fmt.Errorf("push failed: %w", serr)
+		}
+		return fmt.Errorf("push failed: %w", err)
+	}
+
+	out := <-outCh
+	if ctx.Err() != nil {
+		return fmt.Errorf("push failed by ctx done: %w", ctx.Err())
+	}
+	if err = parseExitStatus(out); err != nil {
+		return fmt.Errorf("push failed: %w", err)
+	}
+	return nil
+}
+
+// writeTar writes the directories, regular files and symlinks of local to tw.
+func writeTar(tw *tar.Writer, local string, totalFiles uint64, remote string, handler wire.SyncHandler) error {
+	var sentFiles uint64
+	buf := make([]byte, wire.SyncMaxChunkSize)
+	return filepath.WalkDir(local, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(local, p)
+		if rel == "." {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		var link string
+		switch {
+		case d.IsDir(), d.Type().IsRegular():
+		case d.Type()&fs.ModeSymlink != 0:
+			if link, err = os.Readlink(p); err != nil {
+				return err
+			}
+		default:
+			// ignore special files, like PushDir
+			return nil
+		}
+		hdr, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		// GNU long names are supported by toybox, PAX records are not all
+		hdr.Name = filepath.ToSlash(rel)
+		hdr.Format = tar.FormatGNU
+		hdr.Uid, hdr.Gid, hdr.Uname, hdr.Gname = 0, 0, "", ""
+		hdr.AccessTime, hdr.ChangeTime = time.Time{}, time.Time{}
+		if err = tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		file, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		startTime := time.Now()
+		n, err := io.CopyBuffer(tw, struct{ io.Reader }{file}, buf)
+		if err != nil {
+			return err
+		}
+		sentFiles++
+		if handler != nil {
+			handler(totalFiles, sentFiles, remote+"/"+hdr.Name, 100, speedMBPerSecond(uint64(n), startTime), nil)
+		}
+		return nil
+	})
+}
+
+// PullDirTar pulls the remote directory like PullDir with SymlinkPreserve, but as a single
+// tar archive streamed from `tar -c` on the device. The number of files is not known in
+// advance, so totalFiles is 0 in the calls of handler.
+// It falls back to PullDir when the device has no tar.
+func (c *Device) PullDirTar(ctx context.Context, remote, local string, withSrcDir bool, handler wire.SyncHandler) error {
+	if !c.hasCommand("tar") {
+		return c.PullDirCtx(ctx, remote, local, PullDirOptions{WithSrcDir: withSrcDir, Symlinks: SymlinkPreserve, Handler: handler})
+	}
+	if remote != "/" {
+		remote = strings.TrimSuffix(remote, "/")
+	}
+	if withSrcDir {
+		local = filepath.Join(local, path.Base(remote))
+	}
+
+	// errors of tar would be mixed with the archive, they are kept aside and printed after it
+	cmd := fmt.Sprintf("tar -cf - -C %s . 2>%s; s=$?; cat %s; rm -f %s; echo %s$s",
+		shellQuote(remote), tarErrFile, tarErrFile, tarErrFile, exitStatusMarker)
+	conn, err := c.openExec(cmd)
+	if err != nil {
+		return fmt.Errorf("pull: %w", err)
+	}
+	defer conn.Close()
+	defer closeOnDone(ctx, conn)()
+
+	tr := &tarTailReader{r: conn}
+	errs := extractTar(tar.NewReader(tr), local, remote, handler)
+	if ctx.Err() != nil {
+		return fmt.Errorf("pull failed by ctx done: %w", ctx.Err())
+	}
+	// the status follows the end of the archive, a broken archive consumed the errors of tar
+	out, err := io.ReadAll(conn)
+	if len(errs) > 0 {
+		out = append(tr.tail, out...)
+		if i := bytes.LastIndexByte(out, 0); i >= 0 {
+			out = out[i+1:]
+		}
+	}
+	if err == nil {
+		err = parseExitStatus(out)
+	}
+	if err != nil {
+		errs = append(errs, err)
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("pull failed: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// extractTar extracts the directories, regular files and symlinks of tr into local, restoring
+// modes and mtimes. An error reading the archive stops it, the other errors are collected.
+func extractTar(tr *tar.Reader, local, remote string, handler wire.SyncHandler) (errs []error) {
+	if err := os.MkdirAll(local, 0755); err != nil {
+		return []error{err}
+	}
+
+	var dirs []*tar.Header
+	var pulledFiles uint64
+	buf := make([]byte, wire.SyncMaxChunkSize)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			errs = append(errs, err)
+			break
+		}
+
+		name := path.Clean(hdr.Name)
+		if name == "." {
+			dirs = append(dirs, hdr)
+			continue
+		}
+		// an entry must not escape local
+		if !filepath.IsLocal(filepath.FromSlash(name)) {
+			errs = append(errs, fmt.Errorf("%w: invalid tar entry %q", wire.ErrParse, hdr.Name))
+			continue
+		}
+		target := filepath.Join(local, filepath.FromSlash(name))
+		// nor be written through a symlink of an earlier entry, which may point anywhere
+		if err = checkTarPath(local, name, hdr.Typeflag == tar.TypeDir); err == nil {
+			err = os.MkdirAll(filepath.Dir(target), 0755)
+		}
+
+		switch {
+		case err != nil:
+		case hdr.Typeflag == tar.TypeDir:
+			if err = os.MkdirAll(target, 0755); err == nil {
+				dirs = append(dirs, hdr)
+			}
+		case hdr.Typeflag == tar.TypeSymlink:
+			err = os.Symlink(hdr.Linkname, target)
+		case hdr.Typeflag == tar.TypeReg:
+			startTime := time.Now()
+			if err = extractTarFile(tr, target, hdr, buf); err == nil {
+				pulledFiles++
+				if handler != nil {
+					handler(0, pulledFiles, remote+"/"+name, 100, speedMBPerSecond(uint64(hdr.Size), startTime), nil)
+				}
+			}
+		}
+		// devices, sockets and fifos are ignored, like adb pull
+		if err != nil {
+			errs = append(errs, err)
+			if handler != nil {
+				handler(0, pulledFiles, remote+"/"+name, 0, 0, err)
+			}
+		}
+	}
+
+	// directories are created writable, their modes are restored once filled, deepest first
+	for i := len(dirs) - 1; i >= 0; i-- {
+		name := path.Clean(dirs[i].Name)
+		if name != "." && checkTarPath(local, name, true) != nil {
+			continue
+		}
+		target := filepath.Join(local, filepath.FromSlash(name))
+		if err := os.Chmod(target, dirs[i].FileInfo().Mode().Perm()); err != nil {
+			errs = append(errs, err)
+		}
+		if err := os.Chtimes(target, dirs[i].ModTime, dirs[i].ModTime); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// checkTarPath checks that no directory of the entry name under local is a symlink, nor the
+// entry itself when isDir. A symlink in place of a file or a symlink entry is removed, like
+// tar does, so that it is replaced rather than followed.
+func checkTarPath(local, name string, isDir bool) error {
+	elems := strings.Split(name, "/")
+	p := local
+	for i, elem := range elems {
+		p = filepath.Join(p, elem)
+		info, err := os.Lstat(p)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if info.Mode()&fs.ModeSymlink == 0 {
+			continue
+		}
+		if i < len(elems)-1 || isDir {
+			return fmt.Errorf("%w: tar entry %q is through the symlink %s", wire.ErrParse, name, p)
+		}
+		return os.Remove(p)
+	}
+	return nil
+}
+
+func extractTarFile(tr *tar.Reader, target string, hdr *tar.Header, buf []byte) error {
+	file, err := os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = io.CopyBuffer(file, tr, buf)
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	if err = os.Chmod(target, hdr.FileInfo().Mode().Perm()); err != nil {
+		return err
+	}
+	return os.Chtimes(target, hdr.ModTime, hdr.ModTime)
+}
@@ -0,0 +1,226 @@
+package adb
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/prife/goadb/wire"
+	"github.com/stretchr/testify/assert"
+)
+
+var tarDirRegex = regexp.MustCompile(`-C '([^']*)'`)
+
+// serveTar plays toybox tar on f: `tar -x` extracts the archive read from conn, and
+// `tar -c` writes one, both followed by the status. `tar -x` fails without reading into a dir
+// named "readonly", and `tar -c` fails without writing an archive from a missing dir.
+func serveTar(f *fakeDevice) func(service string, conn *wire.Conn) {
+	return func(service string, conn *wire.Conn) {
+		switch {
+		case service == "shell:command -v tar":
+			io.WriteString(conn, "/system/bin/tar\n")
+		case strings.HasPrefix(service, "exec:mkdir -p "):
+			dir := f.local(tarDirRegex.FindStringSubmatch(service)[1])
+			if filepath.Base(dir) == "readonly" {
+				fmt.Fprintf(conn, "tar: can't create 'a.txt': Read-only file system\n%s1\n", exitStatusMarker)
+				return
+			}
+			err := untarFake(tar.NewReader(conn), dir)
+			if err != nil {
+				fmt.Fprintf(conn, "tar: %s\n%s1\n", err, exitStatusMarker)
+				return
+			}
+			fmt.Fprintf(conn, "%s0\n", exitStatusMarker)
+		case strings.HasPrefix(service, "exec:tar -cf - "):
+			dir := f.local(tarDirRegex.FindStringSubmatch(service)[1])
+			if _, err := os.Stat(dir); err != nil {
+				fmt.Fprintf(conn, "tar: chdir '%s': No such file or directory\n%s1\n",
+					tarDirRegex.FindStringSubmatch(service)[1], exitStatusMarker)
+				return
+			}
+			tw := tar.NewWriter(conn)
+			tw.AddFS(os.DirFS(dir))
+			tw.Close()
+			fmt.Fprintf(conn, "%s0\n", exitStatusMarker)
+		}
+	}
+}
+
+func untarFake(tr *tar.Reader, dir string) error {
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		target := filepath.Join(dir, hdr.Name)
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			os.MkdirAll(target, 0755)
+		case tar.TypeSymlink:
+			os.Symlink(hdr.Linkname, target)
+		case tar.TypeReg:
+			os.MkdirAll(filepath.Dir(target), 0755)
+			data, _ := io.ReadAll(tr)
+			os.WriteFile(target, data, hdr.FileInfo().Mode().Perm())
+			os.Chtimes(target, hdr.ModTime, hdr.ModTime)
+		}
+	}
+}
+
+func TestDevice_PushDirTar(t *testing.T) {
+	f := newFakeDevice(t)
+	f.Service = serveTar(f)
+	local := t.TempDir()
+	writeLocalFile(t, filepath.Join(local, "res", "a.txt"), "hello", someMtime)
+	writeLocalFile(t, filepath.Join(local, "res", "dir", "b.txt"), "world", someMtime)
+	assert.NoError(t, os.Symlink("a.txt", filepath.Join(local, "res", "link")))
+
+	var files []string
+	err := f.Device().PushDirTar(context.Background(), filepath.Join(local, "res"), "/data/my res", true,
+		func(totalFiles, sentFiles uint64, current string, percent, speed float64, err error) {
+			assert.NoError(t, err)
+			assert.Equal(t, uint64(2), totalFiles)
+			files = append(files, current)
+		})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"/data/my res/res/a.txt", "/data/my res/res/dir/b.txt"}, files)
+
+	data, err := os.ReadFile(f.local("data/my res/res/dir/b.txt"))
+	assert.NoError(t, err)
+	assert.Equal(t, "world", string(data))
+	target, err := os.Readlink(f.local("data/my res/res/link"))
+	assert.NoError(t, err)
+	assert.Equal(t, "a.txt", target)
+	// only the probe and the exec, no sync
+	assert.Len(t, f.Services(), 2)
+}
+
+func TestDevice_PullDirTar(t *testing.T) {
+	f := newFakeDevice(t)
+	f.Service = serveTar(f)
+	f.WriteFile(t, "data/res/a.txt", "hello", someMtime)
+	f.WriteFile(t, "data/res/dir/b.txt", "world", someMtime)
+	assert.NoError(t, os.Chmod(f.local("data/res/dir/b.txt"), 0600))
+
+	local := t.TempDir()
+	var files []string
+	err := f.Device().PullDirTar(context.Background(), "/data/res/", local, true,
+		func(totalFiles, sentFiles uint64, current string, percent, speed float64, err error) {
+			assert.NoError(t, err)
+			files = append(files, current)
+		})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"/data/res/a.txt", "/data/res/dir/b.txt"}, files)
+
+	info, err := os.Stat(filepath.Join(local, "res", "dir", "b.txt"))
+	assert.NoError(t, err)
+	assert.Equal(t, fs.FileMode(0600), info.Mode().Perm())
+	assert.Equal(t, someMtime, info.ModTime().UTC())
+}
+
+func TestDevice_DirTarErrors(t *testing.T) {
+	f := newFakeDevice(t)
+	f.Service = serveTar(f)
+	local := t.TempDir()
+	writeLocalFile(t, filepath.Join(local, "a.txt"), strings.Repeat("hello", 1<<16), someMtime)
+
+	// the message of tar, not the broken stream
+	err := f.Device().PushDirTar(context.Background(), local, "/data/readonly", false, nil)
+	assert.EqualError(t, err, "push failed: exited with status 1: tar: can't create 'a.txt': Read-only file system")
+
+	err = f.Device().PullDirTar(context.Background(), "/data/missing", t.TempDir(), false, nil)
+	assert.ErrorContains(t, err, "exited with status 1: tar: chdir '/data/missing': No such file or directory")
+}
+
+func TestDevice_DirTarFallback(t *testing.T) {
+	// no tar: the files are transferred by sync
+	f := newFakeDevice(t)
+	local := t.TempDir()
+	writeLocalFile(t, filepath.Join(local, "a.txt"), "hello", someMtime)
+
+	err := f.Device().PushDirTar(context.Background(), local, "/data", false, nil)
+	assert.NoError(t, err)
+	data, err := os.ReadFile(f.local("data/a.txt"))
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", string(data))
+
+	local = t.TempDir()
+	err = f.Device().PullDirTar(context.Background(), "/data", local, false, nil)
+	assert.NoError(t, err)
+	data, err = os.ReadFile(filepath.Join(local, "a.txt"))
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", string(data))
+}
+
+func TestParseTarStatus(t *testing.T) {
+	assert.NoError(t, parseExitStatus([]byte("\x00\x00exit-status:0\n")))
+	err := parseExitStatus([]byte("tar: can't create 'a': Permission denied\nexit-status:1\n"))
+	assert.EqualError(t, err, "exited with status 1: tar: can't create 'a': Permission denied")
+	// the errors of `tar -c` follow the padding of the archive
+	err = parseExitStatus([]byte("\x00\x00tar: 'a': Permission denied\nexit-status:1\n"))
+	assert.EqualError(t, err, "exited with status 1: tar: 'a': Permission denied")
+	err = parseExitStatus([]byte("killed"))
+	assert.True(t, errors.Is(err, wire.ErrParse))
+}
+
+func TestExtractTarEscape(t *testing.T) {
+	pr, pw := io.Pipe()
+	go func() {
+		tw := tar.NewWriter(pw)
+		tw.WriteHeader(&tar.Header{Name: "../evil", Typeflag: tar.TypeReg, Mode: 0644})
+		tw.Close()
+		pw.Close()
+	}()
+	local := t.TempDir()
+	errs := extractTar(tar.NewReader(pr), filepath.Join(local, "out"), "/data", nil)
+	assert.Len(t, errs, 1)
+	_, err := os.Stat(filepath.Join(local, "evil"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestExtractTarSymlinkEscape(t *testing.T) {
+	outside := t.TempDir()
+	assert.Nil(t, os.Chmod(outside, 0755))
+	pr, pw := io.Pipe()
+	go func() {
+		tw := tar.NewWriter(pw)
+		// a link out of local, then entries written through it
+		tw.WriteHeader(&tar.Header{Name: "link", Typeflag: tar.TypeSymlink, Linkname: outside})
+		tw.WriteHeader(&tar.Header{Name: "link/evil", Typeflag: tar.TypeReg, Mode: 0644, Size: 4})
+		tw.Write([]byte("evil"))
+		tw.WriteHeader(&tar.Header{Name: "link/dir/", Typeflag: tar.TypeDir, Mode: 0755})
+		tw.WriteHeader(&tar.Header{Name: "link", Typeflag: tar.TypeDir, Mode: 0700})
+		// a link to a file, replaced rather than followed
+		tw.WriteHeader(&tar.Header{Name: "file", Typeflag: tar.TypeSymlink, Linkname: filepath.Join(outside, "file")})
+		tw.WriteHeader(&tar.Header{Name: "file", Typeflag: tar.TypeReg, Mode: 0644, Size: 4})
+		tw.Write([]byte("good"))
+		tw.Close()
+		pw.Close()
+	}()
+	local := filepath.Join(t.TempDir(), "out")
+	errs := extractTar(tar.NewReader(pr), local, "/data", nil)
+	assert.Len(t, errs, 3)
+
+	entries, err := os.ReadDir(outside)
+	assert.Nil(t, err)
+	assert.Empty(t, entries)
+	info, err := os.Stat(outside)
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0755), info.Mode().Perm())
+
+	info, err = os.Lstat(filepath.Join(local, "file"))
+	assert.Nil(t, err)
+	assert.True(t, info.Mode().IsRegular())
+	b, _ := os.ReadFile(filepath.Join(local, "file"))
+	assert.Equal(t, "good", string(b))
+}
@@ -0,0 +1,220 @@
+package adb
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/prife/goadb/wire"
+)
+
+// Hash is a hash algorithm, computed on the device by the <name>sum command of toybox.
+type Hash int
+
+const (
+	HashMD5 Hash = iota
+	HashSHA1
+	HashSHA256
+)
+
+func (h Hash) String() string {
+	switch h {
+	case HashMD5:
+		return "md5"
+	case HashSHA1:
+		return "sha1"
+	case HashSHA256:
+		return "sha256"
+	}
+	return fmt.Sprintf("Hash(%d)", int(h))
+}
+
+func (h Hash) new() hash.Hash {
+	switch h {
+	case HashSHA1:
+		return sha1.New()
+	case HashSHA256:
+		return sha256.New()
+	}
+	return md5.New()
+}
+
+// ErrChecksumMismatch is matched by errors.Is for a *ChecksumError.
+var ErrChecksumMismatch = errors.New("ChecksumMismatch")
+
+// ChecksumError is returned when a file on the device differs from the local one.
+type ChecksumError struct {
+	Hash      Hash
+	Local     string
+	Remote    string
+	LocalSum  string
+	RemoteSum string // empty if the device could not read the file
+}
+
+func (e *ChecksumError) Error() string {
+	if e.RemoteSum == "" {
+		return fmt.Sprintf("%s mismatch of %s: no %ssum from device", e.Hash, e.Remote, e.Hash)
+	}
+	return fmt.Sprintf("%s mismatch of %s: device %s, local %s", e.Hash, e.Remote, e.RemoteSum, e.LocalSum)
+}
+
+func (e *ChecksumError) Is(target error) bool {
+	return target == ErrChecksumMismatch
+}
+
+func localHash(h Hash, name string) (string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	hh := h.new()
+	if _, err = io.Copy(hh, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hh.Sum(nil)), nil
+}
+
+// remoteHashes runs `<h>sum` on the device, in batches like Rm, and returns the sums by path.
+// Paths which can't be read are missing from the result. timeout bounds each batch, 0 for
+// none, and ctx stops them.
+func (c *Device) remoteHashes(ctx context.Context, timeout time.Duration, h Hash, list []string) (map[string]string, error) {
+	lines, err := shellBatches(h.String()+"sum", list)
+	if err != nil {
+		return nil, fmt.Errorf("verify: %w", err)
+	}
+	sums := make(map[string]string, len(list))
+	for _, line := range lines {
+		// <h>sum fails on the paths which can't be read, the others are still printed
+		resp, err := c.runFileOpCtx(ctx, timeout, "verify", line+"; true")
+		if err != nil {
+			return nil, err
+		}
+		parseHashSums(resp, h.new().Size(), sums)
+	}
+	return sums, nil
+}
+
+// parseHashSums parses the lines "<sum>  <path>" of md5sum and co, errors like
+// "md5sum: /a: No such file or directory" are skipped.
+func parseHashSums(resp []byte, size int, sums map[string]string) {
+	scanner := bufio.NewScanner(bytes.NewReader(resp))
+	for scanner.Scan() {
+		sum, name, ok := strings.Cut(strings.TrimRight(scanner.Text(), "\r"), "  ")
+		if ok && len(sum) == size*2 {
+			sums[name] = sum
+		}
+	}
+}
+
+// VerifyFiles compares the local files with the remote ones, hashed on the device in batches.
+// Each mismatch is returned as a *ChecksumError, joined. A batch may take up to
+// CmdTimeoutLong.
+func (c *Device) VerifyFiles(h Hash, files []PushItem) error {
+	return c.verifyFiles(context.Background(), c.CmdTimeoutLong, h, files)
+}
+
+// verifyFiles is VerifyFiles with the timeout of remoteHashes, 0 for none, stopped when ctx is done.
+func (c *Device) verifyFiles(ctx context.Context, timeout time.Duration, h Hash, files []PushItem) error {
+	remotes := make([]string, len(files))
+	for i, f := range files {
+		remotes[i] = f.Remote
+	}
+	sums, err := c.remoteHashes(ctx, timeout, h, remotes)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, f := range files {
+		sum, err := localHash(h, f.Local)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if sums[f.Remote] != sum {
+			errs = append(errs, &ChecksumError{Hash: h, Local: f.Local, Remote: f.Remote, LocalSum: sum, RemoteSum: sums[f.Remote]})
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// VerifyDir compares the regular files of the local directory with the ones of the remote
+// directory, see VerifyFiles.
+func (c *Device) VerifyDir(h Hash, local, remote string) error {
+	return c.verifyDir(context.Background(), c.CmdTimeoutLong, h, local, remote)
+}
+
+func (c *Device) verifyDir(ctx context.Context, timeout time.Duration, h Hash, local, remote string) error {
+	var files []PushItem
+	err := filepath.WalkDir(local, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, _ := filepath.Rel(local, p)
+		files = append(files, PushItem{Local: p, Remote: path.Join(remote, filepath.ToSlash(rel))})
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("walk dir %s failed: %w", local, err)
+	}
+	if len(files) == 0 {
+		return nil
+	}
+	return c.verifyFiles(ctx, timeout, h, files)
+}
+
+// PushFileVerified is PushFileCtx followed by VerifyFiles, the hashing
+// of large files is bounded by ctx rather than CmdTimeoutLong.
+func (c *Device) PushFileVerified(ctx context.Context, localPath, remotePath string, h Hash, handler wire.SyncFileHandler) error {
+	if err := c.PushFileCtx(ctx, localPath, remotePath, handler); err != nil {
+		return err
+	}
+	// like PushFileCtx, a remote dir receives the file
+	if info, err := c.Stat(remotePath); err == nil && info.Mode.IsDir() {
+		remotePath = remotePath + "/" + filepath.Base(localPath)
+	}
+	return c.verifyFiles(ctx, 0, h, []PushItem{{Local: localPath, Remote: remotePath}})
+}
+
+// PushDirVerified is PushDirCtx followed by VerifyDir, the hashing
+// of large files is bounded by ctx rather than CmdTimeoutLong.
+func (c *Device) PushDirVerified(ctx context.Context, local, remote string, withSrcDir bool, h Hash, handler wire.SyncHandler) error {
+	if err := c.PushDirCtx(ctx, local, remote, PushDirOptions{WithSrcDir: withSrcDir, Handler: handler}); err != nil {
+		return err
+	}
+	if withSrcDir {
+		abs, err := filepath.Abs(local)
+		if err != nil {
+			return err
+		}
+		remote = remote + "/" + filepath.Base(abs)
+	}
+	return c.verifyDir(ctx, 0, h, local, remote)
+}
+
+// PullFileVerified is PullFileCtx followed by VerifyFiles, the hashing
+// of large files is bounded by ctx rather than CmdTimeoutLong.
+func (c *Device) PullFileVerified(ctx context.Context, remotePath, localPath string, h Hash, handler func(total, sent int64, duration time.Duration)) error {
+	if err := c.PullFileCtx(ctx, remotePath, localPath, handler); err != nil {
+		return err
+	}
+	return c.verifyFiles(ctx, 0, h, []PushItem{{Local: localPath, Remote: remotePath}})
+}
@@ -0,0 +1,116 @@
+package adb
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/prife/goadb/wire"
+	"github.com/stretchr/testify/assert"
+)
+
+// shellArgRegex matches the arguments quoted by shellQuote.
+var shellArgRegex = regexp.MustCompile(`'((?:[^']|'\\'')*)'`)
+
+// serveHashSum answers `md5sum`, `sha1sum` and `sha256sum <paths>` from the files of f.
+func serveHashSum(f *fakeDevice) func(service string, conn *wire.Conn) {
+	return func(service string, conn *wire.Conn) {
+		cmd, args, _ := strings.Cut(strings.TrimPrefix(service, "shell:"), " ")
+		if !strings.HasSuffix(cmd, "sum") {
+			return
+		}
+		for _, m := range shellArgRegex.FindAllStringSubmatch(args, -1) {
+			name := strings.ReplaceAll(m[1], `'\''`, "'")
+			data, err := os.ReadFile(f.local(name))
+			if err != nil {
+				fmt.Fprintf(conn, "%s: %s: No such file or directory\n", cmd, name)
+				continue
+			}
+			switch cmd {
+			case "md5sum":
+				fmt.Fprintf(conn, "%x  %s\n", md5.Sum(data), name)
+			case "sha1sum":
+				fmt.Fprintf(conn, "%x  %s\n", sha1.Sum(data), name)
+			case "sha256sum":
+				fmt.Fprintf(conn, "%x  %s\n", sha256.Sum256(data), name)
+			}
+		}
+		fmt.Fprintf(conn, "%s0\n", exitStatusMarker)
+	}
+}
+
+func TestDevice_VerifyFiles(t *testing.T) {
+	f := newFakeDevice(t)
+	f.Service = serveHashSum(f)
+	f.WriteFile(t, "data/a.txt", "hello", someMtime)
+	f.WriteFile(t, "data/b.txt", "world", someMtime)
+
+	local := t.TempDir()
+	writeLocalFile(t, filepath.Join(local, "a.txt"), "hello", someMtime)
+	writeLocalFile(t, filepath.Join(local, "b.txt"), "WORLD", someMtime)
+	writeLocalFile(t, filepath.Join(local, "c.txt"), "", someMtime)
+
+	for _, h := range []Hash{HashMD5, HashSHA1, HashSHA256} {
+		err := f.Device().VerifyDir(h, local, "/data")
+		assert.True(t, errors.Is(err, ErrChecksumMismatch))
+
+		var mismatches []string
+		for _, err := range err.(interface{ Unwrap() []error }).Unwrap() {
+			var checksumErr *ChecksumError
+			assert.True(t, errors.As(err, &checksumErr))
+			assert.Equal(t, h, checksumErr.Hash)
+			mismatches = append(mismatches, checksumErr.Remote+" "+checksumErr.RemoteSum)
+		}
+		assert.Len(t, mismatches, 2)
+		assert.True(t, strings.HasPrefix(mismatches[0], "/data/b.txt "))
+		assert.Equal(t, "/data/c.txt ", mismatches[1])
+	}
+
+	err := f.Device().VerifyFiles(HashSHA256, []PushItem{{Local: filepath.Join(local, "a.txt"), Remote: "/data/a.txt"}})
+	assert.NoError(t, err)
+
+	// the names are not interpreted by sh
+	f.WriteFile(t, `data/$HOME it's "x"`, "hello", someMtime)
+	err = f.Device().VerifyFiles(HashMD5, []PushItem{{Local: filepath.Join(local, "a.txt"), Remote: `/data/$HOME it's "x"`}})
+	assert.NoError(t, err)
+}
+
+func TestDevice_PushPullVerified(t *testing.T) {
+	f := newFakeDevice(t)
+	f.Service = serveHashSum(f)
+	local := t.TempDir()
+	writeLocalFile(t, filepath.Join(local, "res", "a.txt"), "hello", someMtime)
+	writeLocalFile(t, filepath.Join(local, "res", "dir", "b.txt"), "world", someMtime)
+	assert.NoError(t, os.MkdirAll(f.local("data"), 0755))
+
+	err := f.Device().PushFileVerified(context.Background(), filepath.Join(local, "res", "a.txt"), "/data", HashMD5, nil)
+	assert.NoError(t, err)
+	err = f.Device().PushDirVerified(context.Background(), filepath.Join(local, "res"), "/data", true, HashSHA1, nil)
+	assert.NoError(t, err)
+	data, err := os.ReadFile(f.local("data/res/dir/b.txt"))
+	assert.NoError(t, err)
+	assert.Equal(t, "world", string(data))
+
+	err = f.Device().PullFileVerified(context.Background(), "/data/res/a.txt", filepath.Join(local, "a.txt"), HashSHA256, nil)
+	assert.NoError(t, err)
+	data, err = os.ReadFile(filepath.Join(local, "a.txt"))
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", string(data))
+}
+
+func TestParseHashSums(t *testing.T) {
+	sums := make(map[string]string)
+	parseHashSums([]byte("2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824  /data/a.txt\n"+
+		"5d41402abc4b2a76b9719d911017c592  /data/b.txt\n"+
+		"sha256sum: /data/c: Permission denied\n"), sha256.Size, sums)
+	// the sums of another size are not taken
+	assert.Equal(t, map[string]string{"/data/a.txt": "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"}, sums)
+}
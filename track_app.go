@@ -0,0 +1,92 @@
+package adb
+
+import (
+	"context"
+	"fmt"
+)
+
+// AppProcess is the ProcessEntry message of adb/proto/app_processes.proto, a process
+// of an app which is debuggable or profileable.
+type AppProcess struct {
+	Pid          int64
+	Debuggable   bool
+	Profileable  bool
+	Architecture string
+	// WaitingForDebugger is only reported by Android 14 and newer.
+	WaitingForDebugger bool
+}
+
+// TrackApps streams the debuggable and profileable app processes with the 'track-app' service,
+// Android 12 or newer (FeatureTrackApp).
+// handler is called with the full list of processes each time it changes, the first call is
+// the current list. It blocks until ctx is done or the connection fails.
+func (c *Device) TrackApps(ctx context.Context, handler func([]AppProcess)) error {
+	conn, err := c.dialDevice(c.CmdTimeoutShort)
+	if err != nil {
+		return wrapClientError(err, c, "TrackApps")
+	}
+	defer conn.Close()
+
+	if err = conn.SendMessage([]byte("track-app")); err != nil {
+		return wrapClientError(err, c, "TrackApps")
+	}
+	if _, err = readStatusWithTimeout(conn, "track-app", c.CmdTimeoutShort); err != nil {
+		return wrapClientError(err, c, "TrackApps")
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	for {
+		msg, err := conn.ReadMessage()
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return wrapClientError(err, c, "TrackApps")
+		}
+		processes, err := parseAppProcesses(msg)
+		if err != nil {
+			return wrapClientError(err, c, "TrackApps")
+		}
+		handler(processes)
+	}
+}
+
+func parseAppProcesses(b []byte) (processes []AppProcess, err error) {
+	processes = []AppProcess{}
+	err = parseProto(b, func(f protoField) error {
+		if f.Num != 1 {
+			return nil
+		}
+		var p AppProcess
+		err := parseProto(f.Bytes, func(f protoField) error {
+			switch f.Num {
+			case 1:
+				p.Pid = int64(f.Varint)
+			case 2:
+				p.Debuggable = f.Varint != 0
+			case 3:
+				p.Profileable = f.Varint != 0
+			case 4:
+				p.Architecture = string(f.Bytes)
+			case 5:
+				p.WaitingForDebugger = f.Varint != 0
+			}
+			return nil
+		})
+		processes = append(processes, p)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("parse app processes: %w", err)
+	}
+	return processes, nil
+}
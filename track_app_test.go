@@ -0,0 +1,45 @@
+package adb
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/prife/goadb/wire"
+	"github.com/stretchr/testify/assert"
+)
+
+func appendAppProcess(b []byte, p AppProcess) []byte {
+	var entry []byte
+	entry = appendProtoVarint(entry, 1, uint64(p.Pid))
+	if p.Debuggable {
+		entry = appendProtoVarint(entry, 2, 1)
+	}
+	if p.Profileable {
+		entry = appendProtoVarint(entry, 3, 1)
+	}
+	entry = appendProtoBytes(entry, 4, []byte(p.Architecture))
+	return appendProtoBytes(b, 1, entry)
+}
+
+func TestDevice_TrackApps(t *testing.T) {
+	app1 := AppProcess{Pid: 1234, Debuggable: true, Architecture: "arm64"}
+	app2 := AppProcess{Pid: 5678, Profileable: true, Architecture: "arm"}
+	s := &MockServer{
+		Status: wire.StatusSuccess,
+		Messages: []string{
+			string(appendAppProcess(nil, app1)),
+			string(appendAppProcess(appendAppProcess(nil, app1), app2)),
+			"",
+		},
+	}
+	d := (&Adb{server: s}).Device(DeviceWithSerial("serial"))
+
+	var updates [][]AppProcess
+	err := d.TrackApps(context.Background(), func(processes []AppProcess) {
+		updates = append(updates, processes)
+	})
+	assert.ErrorIs(t, err, io.EOF)
+	assert.Equal(t, []string{"host:transport:serial", "track-app"}, s.Requests)
+	assert.Equal(t, [][]AppProcess{{app1}, {app1, app2}, {}}, updates)
+}
@@ -1,9 +1,13 @@
 package adb
 
 import (
+	"bytes"
 	"fmt"
 	"regexp"
+	"strconv"
 	"strings"
+
+	"github.com/prife/goadb/wire"
 )
 
 var (
@@ -25,3 +29,30 @@ func wrapClientError(err error, client *Device, operation string, args ...interf
 
 	return fmt.Errorf("%s on %s, err: %w", fmt.Sprintf(operation, args...), client.descriptor.serial, err)
 }
+
+// shellQuote quotes s as a single word for sh, even if it has single quotes.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// exitStatusMarker is echoed after a command run by sh, followed by its exit status, since
+// the shell: and exec: streams don't report it.
+const exitStatusMarker = "exit-status:"
+
+// parseExitStatus finds the exit status echoed after a command in out, the output before
+// it is returned in the error.
+func parseExitStatus(out []byte) error {
+	i := bytes.LastIndex(out, []byte(exitStatusMarker))
+	if i < 0 {
+		return fmt.Errorf("%w: exit status not found", wire.ErrParse)
+	}
+	status, err := strconv.Atoi(string(bytes.TrimSpace(out[i+len(exitStatusMarker):])))
+	if err != nil {
+		return fmt.Errorf("%w: invalid exit status: %w", wire.ErrParse, err)
+	}
+	if status != 0 {
+		msg := bytes.TrimSpace(bytes.Trim(out[:i], "\x00"))
+		return fmt.Errorf("exited with status %d: %s", status, msg)
+	}
+	return nil
+}
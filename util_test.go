@@ -1,8 +1,10 @@
 package adb
 
 import (
+	"errors"
 	"testing"
 
+	"github.com/prife/goadb/wire"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -25,3 +27,16 @@ func TestIsBlankWhenJustWhitespace(t *testing.T) {
 func TestIsBlankNo(t *testing.T) {
 	assert.False(t, isBlank("     h   "))
 }
+
+func TestShellQuote(t *testing.T) {
+	assert.Equal(t, `'/sdcard/a b'`, shellQuote("/sdcard/a b"))
+	assert.Equal(t, `'it'\''s'`, shellQuote("it's"))
+}
+
+func TestParseExitStatus(t *testing.T) {
+	assert.NoError(t, parseExitStatus([]byte("exit-status:0\n")))
+	err := parseExitStatus([]byte("mv: bad '/data/a': No such file or directory\r\nexit-status:1\r\n"))
+	assert.EqualError(t, err, "exited with status 1: mv: bad '/data/a': No such file or directory")
+	err = parseExitStatus([]byte("exit-status:x\n"))
+	assert.True(t, errors.Is(err, wire.ErrParse))
+}
@@ -0,0 +1,419 @@
+package adb
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/prife/goadb/wire"
+)
+
+// FileOp is the change of a FileEvent.
+type FileOp int
+
+const (
+	FileCreated FileOp = iota + 1
+	FileModified
+	FileDeleted
+)
+
+func (op FileOp) String() string {
+	switch op {
+	case FileCreated:
+		return "create"
+	case FileModified:
+		return "modify"
+	case FileDeleted:
+		return "delete"
+	}
+	return fmt.Sprintf("FileOp(%d)", int(op))
+}
+
+// FileEvent is a change of a remote file, see Watch.
+type FileEvent struct {
+	Op   FileOp
+	Path string
+	// Err is set on the last event, if watching failed.
+	Err error
+}
+
+// WatchPollInterval is the interval of the polling of Watch, when the device has no inotifyd.
+const WatchPollInterval = time.Second
+
+// watchPollInterval is WatchPollInterval, lowered by tests.
+var watchPollInterval = WatchPollInterval
+
+// inotifydMask is the mask of the events of inotifyd: created, modified, deleted, moved into
+// and out of a directory, and the watched path deleted or moved.
+const inotifydMask = "ncdymDM"
+
+// Watch streams the changes of the remote path, a file or the entries of a directory, not
+// recursively. It uses inotifyd of toybox if the device has it, otherwise it compares the
+// stat, and the LIST of a directory, every WatchPollInterval, so changes within an interval
+// are merged. path must exist, watch its directory to wait for a file. If path is deleted
+// or moved, FileDeleted is sent, and FileCreated once it exists again.
+// The channel is closed when ctx is done, or after an event with Err if watching fails.
+func (c *Device) Watch(ctx context.Context, path string) (<-chan FileEvent, error) {
+	if exists, err := c.Exists(path); err != nil {
+		return nil, fmt.Errorf("watch: %w", err)
+	} else if !exists {
+		return nil, &fs.PathError{Op: "watch", Path: path, Err: fs.ErrNotExist}
+	}
+	if c.hasCommand("inotifyd") {
+		return c.watchInotifyd(ctx, path)
+	}
+	return c.watchPoll(ctx, path)
+}
+
+func sendFileEvent(ctx context.Context, ch chan<- FileEvent, e FileEvent) bool {
+	select {
+	case ch <- e:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (c *Device) watchInotifyd(ctx context.Context, name string) (<-chan FileEvent, error) {
+	conn, err := c.openInotifyd(name)
+	if err != nil {
+		return nil, fmt.Errorf("watch: %w", err)
+	}
+
+	ch := make(chan FileEvent)
+	go func() {
+		defer close(ch)
+		for {
+			deleted, err := readInotifyd(ctx, conn, name, ch)
+			if ctx.Err() != nil {
+				return
+			}
+			if err != nil {
+				sendFileEvent(ctx, ch, FileEvent{Path: name, Err: fmt.Errorf("watch %s: %w", name, err)})
+				return
+			}
+
+			// inotifyd exited after name was deleted or moved, like the polling, its deletion
+			// is reported and it is watched again once it exists
+			if !deleted && !sendFileEvent(ctx, ch, FileEvent{Op: FileDeleted, Path: name}) {
+				return
+			}
+			if conn, err = c.reopenInotifyd(ctx, name); err != nil {
+				if ctx.Err() == nil {
+					sendFileEvent(ctx, ch, FileEvent{Path: name, Err: fmt.Errorf("watch %s: %w", name, err)})
+				}
+				return
+			}
+			if !sendFileEvent(ctx, ch, FileEvent{Op: FileCreated, Path: name}) {
+				conn.Close()
+				return
+			}
+		}
+	}()
+	return ch, nil
+}
+
+func (c *Device) openInotifyd(name string) (wire.IConn, error) {
+	// the exit status tells a failure from the end of the watch, eg. name was deleted
+	return c.openExec(fmt.Sprintf("inotifyd - %s; echo %s$?", shellQuote(name+":"+inotifydMask), exitStatusMarker))
+}
+
+// reopenInotifyd watches name again once it exists, polled every watchPollInterval.
+func (c *Device) reopenInotifyd(ctx context.Context, name string) (wire.IConn, error) {
+	ticker := time.NewTicker(watchPollInterval)
+	defer ticker.Stop()
+	for {
+		exists, err := c.Exists(name)
+		if err != nil {
+			return nil, err
+		}
+		if exists {
+			return c.openInotifyd(name)
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// readInotifyd sends the events of the inotifyd of conn to ch until it exits, and closes conn.
+// It returns nil once name was deleted or moved, and whether that was the last event sent.
+func readInotifyd(ctx context.Context, conn wire.IConn, name string, ch chan<- FileEvent) (deleted bool, err error) {
+	defer conn.Close()
+	defer closeOnDone(ctx, conn)()
+
+	var out []string
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		events, ok := parseInotifydLine(line)
+		if !ok {
+			out = append(out, line)
+			continue
+		}
+		for _, e := range events {
+			if !sendFileEvent(ctx, ch, e) {
+				return false, ctx.Err()
+			}
+			deleted = e.Op == FileDeleted && e.Path == name
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return false, err
+	}
+	return deleted, parseExitStatus([]byte(strings.Join(out, "\n")))
+}
+
+// parseInotifydLine parses a line "<events>\t<path>[\t<name>]" of `inotifyd -`, name is the
+// entry of a watched directory.
+func parseInotifydLine(line string) (events []FileEvent, ok bool) {
+	fields := strings.Split(line, "\t")
+	if len(fields) < 2 || len(fields) > 3 || fields[0] == "" {
+		return nil, false
+	}
+	name := fields[1]
+	if len(fields) == 3 && fields[2] != "" {
+		name = path.Join(fields[1], fields[2])
+	}
+	for _, ch := range fields[0] {
+		var op FileOp
+		switch ch {
+		case 'n', 'y':
+			op = FileCreated
+		case 'c':
+			op = FileModified
+		case 'd', 'm', 'D', 'M':
+			op = FileDeleted
+		default:
+			// not in inotifydMask
+			continue
+		}
+		events = append(events, FileEvent{Op: op, Path: name})
+	}
+	return events, true
+}
+
+// watchEntry is the stat of a file compared by the polling of Watch.
+type watchEntry struct {
+	mode  fs.FileMode
+	size  int32
+	mtime int64
+}
+
+// snapshotRemote returns the stat of name and of its entries if it is a directory, by path.
+func snapshotRemote(conn *wire.SyncConn, name string) (map[string]watchEntry, error) {
+	entries := make(map[string]watchEntry)
+	d, err := conn.Stat(name)
+	if errors.Is(err, wire.ErrFileNoExist) {
+		return entries, nil
+	} else if err != nil {
+		return nil, err
+	}
+	entries[name] = watchEntry{d.Mode, d.Size, d.ModifiedAt.Unix()}
+	if !d.Mode.IsDir() {
+		// lstat of "link/" resolves link if it points to a directory
+		if d.Mode&fs.ModeSymlink == 0 {
+			return entries, nil
+		}
+		if target, err := conn.Stat(name + "/"); err != nil || !target.Mode.IsDir() {
+			return entries, nil
+		}
+	}
+
+	dr, err := conn.SendList(name)
+	if err != nil {
+		return nil, err
+	}
+	list, err := dr.ReadDir(-1)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	for _, e := range list {
+		if e.Name != "." && e.Name != ".." {
+			entries[path.Join(name, e.Name)] = watchEntry{e.Mode, e.Size, e.ModifiedAt.Unix()}
+		}
+	}
+	return entries, nil
+}
+
+// diffSnapshots returns the changes from old to cur, sorted by path. The modifications of
+// the watched directory itself are left out, they follow the changes of its entries.
+func diffSnapshots(root string, old, cur map[string]watchEntry) (events []FileEvent) {
+	for name, e := range cur {
+		if o, ok := old[name]; !ok {
+			events = append(events, FileEvent{Op: FileCreated, Path: name})
+		} else if o != e && !(name == root && e.mode.IsDir()) {
+			events = append(events, FileEvent{Op: FileModified, Path: name})
+		}
+	}
+	for name := range old {
+		if _, ok := cur[name]; !ok {
+			events = append(events, FileEvent{Op: FileDeleted, Path: name})
+		}
+	}
+	sort.Slice(events, func(i, j int) bool {
+		if events[i].Path != events[j].Path {
+			return events[i].Path < events[j].Path
+		}
+		return events[i].Op < events[j].Op
+	})
+	return
+}
+
+func (c *Device) watchPoll(ctx context.Context, name string) (<-chan FileEvent, error) {
+	conn, err := c.NewSyncConn()
+	if err != nil {
+		return nil, fmt.Errorf("watch: %w", err)
+	}
+	old, err := snapshotRemote(conn, name)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("watch %s: %w", name, err)
+	}
+
+	ch := make(chan FileEvent)
+	go func() {
+		defer close(ch)
+		defer func() {
+			if conn != nil {
+				conn.Close()
+			}
+		}()
+
+		ticker := time.NewTicker(watchPollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			cur, err := snapshotRemote(conn, name)
+			if err != nil {
+				// reconnect once, the connection is out of sync after an error
+				conn.Close()
+				if conn, err = c.NewSyncConn(); err == nil {
+					cur, err = snapshotRemote(conn, name)
+				}
+			}
+			if err != nil {
+				sendFileEvent(ctx, ch, FileEvent{Path: name, Err: fmt.Errorf("watch %s: %w", name, err)})
+				return
+			}
+			for _, e := range diffSnapshots(name, old, cur) {
+				if !sendFileEvent(ctx, ch, e) {
+					return
+				}
+			}
+			old = cur
+		}
+	}()
+	return ch, nil
+}
+
+// tailReader stops the tail when closed.
+type tailReader struct {
+	*io.PipeReader
+	cancel context.CancelFunc
+}
+
+func (r *tailReader) Close() error {
+	r.cancel()
+	return r.PipeReader.Close()
+}
+
+// Tail returns a reader of the data appended to the remote file path after the call, like
+// `tail -F`. The data is read on the changes reported by Watch, from the last offset, or
+// from the start if the file shrank, eg. rotated by copytruncate. After a rotation which deletes
+// or moves path, the new file is read from its start, see Watch.
+// Read returns the error of ctx once it is done.
+func (c *Device) Tail(ctx context.Context, path string) (io.ReadCloser, error) {
+	size, _, _, err := c.remoteFileStat(path)
+	if err != nil {
+		return nil, err
+	}
+	if err = c.checkReadable("tail", path); err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	events, err := c.Watch(ctx, path)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		defer cancel()
+		pw.CloseWithError(c.follow(ctx, path, size, events, pw))
+	}()
+	return &tailReader{PipeReader: pr, cancel: cancel}, nil
+}
+
+// follow writes the data of path from offset to w on its events, until ctx is done.
+func (c *Device) follow(ctx context.Context, path string, offset int64, events <-chan FileEvent, w io.Writer) (err error) {
+	for e := range events {
+		if e.Err != nil {
+			return e.Err
+		}
+		if e.Path != path {
+			continue
+		}
+		if e.Op == FileDeleted {
+			offset = 0
+			continue
+		}
+		if offset, err = c.tailFrom(path, offset, w); err != nil {
+			return err
+		}
+	}
+	return ctx.Err()
+}
+
+// tailFrom writes the data of name from offset to w with dd, which skips whole blocks,
+// and returns the new offset. A missing name has no data, it is being rotated.
+func (c *Device) tailFrom(name string, offset int64, w io.Writer) (int64, error) {
+	size, _, _, err := c.remoteFileStat(name)
+	if errors.Is(err, wire.ErrFileNoExist) {
+		return 0, nil
+	} else if err != nil {
+		return offset, err
+	}
+	if size == offset {
+		return offset, nil
+	} else if size < offset {
+		offset = 0
+	}
+
+	skip := offset / RemoteFileBlockSize
+	conn, err := c.openExec(fmt.Sprintf("dd if=%s bs=%d skip=%d 2>/dev/null", shellQuote(name), RemoteFileBlockSize, skip))
+	if err != nil {
+		return offset, err
+	}
+	defer conn.Close()
+	var n int64
+	if _, err = io.CopyN(io.Discard, conn, offset-skip*RemoteFileBlockSize); err == nil {
+		n, err = io.Copy(w, conn)
+	}
+	if (err == nil && n < size-offset) || err == io.EOF {
+		// dd stopped early, tell why
+		if rerr := c.checkReadable("tail", name); rerr != nil {
+			return offset + n, rerr
+		}
+		// it shrank meanwhile, the next change reads it again
+		if err == io.EOF {
+			err = nil
+		}
+	}
+	return offset + n, err
+}
@@ -0,0 +1,260 @@
+package adb
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prife/goadb/wire"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseInotifydLine(t *testing.T) {
+	events, ok := parseInotifydLine("n\t/data/dir\ta.txt")
+	assert.True(t, ok)
+	assert.Equal(t, []FileEvent{{Op: FileCreated, Path: "/data/dir/a.txt"}}, events)
+
+	events, ok = parseInotifydLine("cD\t/data/a.txt")
+	assert.True(t, ok)
+	assert.Equal(t, []FileEvent{{Op: FileModified, Path: "/data/a.txt"}, {Op: FileDeleted, Path: "/data/a.txt"}}, events)
+
+	_, ok = parseInotifydLine("inotifyd: /data/none: No such file or directory")
+	assert.False(t, ok)
+	assert.Equal(t, "delete", FileDeleted.String())
+}
+
+// nextEvent returns the next event of events, or fails after a while.
+func nextEvent(t *testing.T, events <-chan FileEvent) FileEvent {
+	t.Helper()
+	select {
+	case e := <-events:
+		return e
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event")
+		return FileEvent{}
+	}
+}
+
+func TestDevice_WatchInotifyd(t *testing.T) {
+	f := newFakeDevice(t)
+	var status int32 // the handlers of the first watch may still run
+	f.Service = func(service string, conn *wire.Conn) {
+		switch {
+		case strings.HasPrefix(service, "shell:command -v "):
+			io.WriteString(conn, "/system/bin/inotifyd\n")
+		case strings.HasPrefix(service, "exec:inotifyd "):
+			status := atomic.LoadInt32(&status)
+			if status == 0 {
+				io.WriteString(conn, "n\t/data/dir\ta.txt\nc\t/data/dir\ta.txt\nd\t/data/dir\tb.txt\nD\t/data/dir\n")
+			} else {
+				io.WriteString(conn, "inotifyd: /data/dir: Permission denied\n")
+			}
+			fmt.Fprintf(conn, "%s%d\n", exitStatusMarker, status)
+		}
+	}
+	f.WriteFile(t, "data/dir/a.txt", "hello", someMtime)
+	d := f.Device()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	events, err := d.Watch(ctx, "/data/dir")
+	assert.NoError(t, err)
+	var got []FileEvent
+	for len(got) < 5 {
+		got = append(got, nextEvent(t, events))
+	}
+	// inotifyd exited once /data/dir was deleted, which exists again
+	assert.Equal(t, []FileEvent{
+		{Op: FileCreated, Path: "/data/dir/a.txt"},
+		{Op: FileModified, Path: "/data/dir/a.txt"},
+		{Op: FileDeleted, Path: "/data/dir/b.txt"},
+		{Op: FileDeleted, Path: "/data/dir"},
+		{Op: FileCreated, Path: "/data/dir"},
+	}, got)
+	assert.Contains(t, f.Services(), "exec:inotifyd - '/data/dir:ncdymDM'; echo exit-status:$?")
+	cancel()
+	for range events {
+	}
+
+	atomic.StoreInt32(&status, 1)
+	events, err = d.Watch(context.Background(), "/data/dir")
+	assert.NoError(t, err)
+	e := nextEvent(t, events)
+	assert.Error(t, e.Err)
+	assert.Contains(t, e.Err.Error(), "Permission denied")
+	_, ok := <-events
+	assert.False(t, ok)
+
+	_, err = d.Watch(context.Background(), "/data/none")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+}
+
+func TestDevice_WatchInotifydDeleted(t *testing.T) {
+	defer func(interval time.Duration) { watchPollInterval = interval }(watchPollInterval)
+	watchPollInterval = 10 * time.Millisecond
+
+	f := newFakeDevice(t)
+	var watches int
+	recreated := make(chan struct{})
+	f.Service = func(service string, conn *wire.Conn) {
+		switch {
+		case strings.HasPrefix(service, "shell:command -v "):
+			io.WriteString(conn, "/system/bin/inotifyd\n")
+		case strings.HasPrefix(service, "exec:inotifyd "):
+			// the watched file was removed, inotifyd exits without an event
+			if watches++; watches == 1 {
+				assert.NoError(t, os.Remove(f.local("data/a.txt")))
+				fmt.Fprintf(conn, "%s0\n", exitStatusMarker)
+				return
+			}
+			<-recreated
+			io.WriteString(conn, "c\t/data/a.txt\n")
+			io.Copy(io.Discard, conn)
+		}
+	}
+	f.WriteFile(t, "data/a.txt", "hello", someMtime)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	events, err := f.Device().Watch(ctx, "/data/a.txt")
+	assert.NoError(t, err)
+
+	// reported like the polling, and watched again once it exists
+	assert.Equal(t, FileEvent{Op: FileDeleted, Path: "/data/a.txt"}, nextEvent(t, events))
+	f.WriteFile(t, "data/a.txt", "new", someMtime)
+	assert.Equal(t, FileEvent{Op: FileCreated, Path: "/data/a.txt"}, nextEvent(t, events))
+	close(recreated)
+	assert.Equal(t, FileEvent{Op: FileModified, Path: "/data/a.txt"}, nextEvent(t, events))
+	assert.Equal(t, 2, watches)
+	cancel()
+	for range events {
+	}
+}
+
+func TestDevice_WatchPoll(t *testing.T) {
+	defer func(interval time.Duration) { watchPollInterval = interval }(watchPollInterval)
+	watchPollInterval = 10 * time.Millisecond
+
+	f := newFakeDevice(t)
+	f.WriteFile(t, "data/dir/a.txt", "hello", someMtime)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events, err := f.Device().Watch(ctx, "/data/dir")
+	assert.NoError(t, err)
+
+	// renamed into place, so that a poll never sees them half written
+	f.WriteFile(t, "data/tmp", "new", someMtime)
+	assert.NoError(t, os.Rename(f.local("data/tmp"), f.local("data/dir/b.txt")))
+	assert.Equal(t, FileEvent{Op: FileCreated, Path: "/data/dir/b.txt"}, nextEvent(t, events))
+
+	f.WriteFile(t, "data/tmp", "hello world", someMtime)
+	assert.NoError(t, os.Rename(f.local("data/tmp"), f.local("data/dir/a.txt")))
+	assert.Equal(t, FileEvent{Op: FileModified, Path: "/data/dir/a.txt"}, nextEvent(t, events))
+
+	assert.NoError(t, os.Remove(f.local("data/dir/b.txt")))
+	assert.Equal(t, FileEvent{Op: FileDeleted, Path: "/data/dir/b.txt"}, nextEvent(t, events))
+
+	cancel()
+	for range events {
+	}
+}
+
+func TestDevice_Tail(t *testing.T) {
+	defer func(interval time.Duration) { watchPollInterval = interval }(watchPollInterval)
+	watchPollInterval = 10 * time.Millisecond
+
+	f := newFakeDevice(t)
+	f.Service = serveDD(f, new(int))
+	f.WriteFile(t, "data/log.txt", "old\n", someMtime)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	r, err := f.Device().Tail(ctx, "/data/log.txt")
+	assert.NoError(t, err)
+
+	file, err := os.OpenFile(f.local("data/log.txt"), os.O_APPEND|os.O_WRONLY, 0)
+	assert.NoError(t, err)
+	_, err = file.WriteString("new line\n")
+	assert.NoError(t, err)
+	file.Close()
+	p := make([]byte, 9)
+	_, err = io.ReadFull(r, p)
+	assert.NoError(t, err)
+	assert.Equal(t, "new line\n", string(p))
+
+	// rotated, read from the start
+	f.WriteFile(t, "data/tmp", "rot\n", someMtime)
+	assert.NoError(t, os.Rename(f.local("data/tmp"), f.local("data/log.txt")))
+	_, err = io.ReadFull(r, p[:4])
+	assert.NoError(t, err)
+	assert.Equal(t, "rot\n", string(p[:4]))
+
+	assert.NoError(t, r.Close())
+	_, err = r.Read(p)
+	assert.Error(t, err)
+}
+
+func TestDevice_TailRewatch(t *testing.T) {
+	f := newFakeDevice(t)
+	dd := serveDD(f, new(int))
+	rotated, appended := make(chan struct{}), make(chan struct{})
+	var watches int
+	f.Service = func(service string, conn *wire.Conn) {
+		switch {
+		case strings.HasPrefix(service, "shell:command -v "):
+			io.WriteString(conn, "/system/bin/inotifyd\n")
+		case strings.HasPrefix(service, "exec:inotifyd "):
+			// inotifyd exits once the watched file is moved
+			if watches++; watches == 1 {
+				<-rotated
+				fmt.Fprintf(conn, "M\t/data/log.txt\n%s0\n", exitStatusMarker)
+				return
+			}
+			<-appended
+			io.WriteString(conn, "c\t/data/log.txt\n")
+			io.Copy(io.Discard, conn)
+		default:
+			dd(service, conn)
+		}
+	}
+	f.WriteFile(t, "data/log.txt", "old\n", someMtime)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	r, err := f.Device().Tail(ctx, "/data/log.txt")
+	assert.NoError(t, err)
+	defer r.Close()
+
+	// rotated by rename, the new file is read from its start
+	assert.NoError(t, os.Rename(f.local("data/log.txt"), f.local("data/log.txt.1")))
+	f.WriteFile(t, "data/log.txt", "rot\n", someMtime)
+	close(rotated)
+	p := make([]byte, 5)
+	_, err = io.ReadFull(r, p[:4])
+	assert.NoError(t, err)
+	assert.Equal(t, "rot\n", string(p[:4]))
+
+	file, err := os.OpenFile(f.local("data/log.txt"), os.O_APPEND|os.O_WRONLY, 0)
+	assert.NoError(t, err)
+	_, err = file.WriteString("more\n")
+	assert.NoError(t, err)
+	file.Close()
+	close(appended)
+	_, err = io.ReadFull(r, p)
+	assert.NoError(t, err)
+	assert.Equal(t, "more\n", string(p))
+}
+
+func TestDevice_TailUnreadable(t *testing.T) {
+	f := newFakeDevice(t)
+	f.Service = serveDD(f, new(int))
+	f.WriteFile(t, "data/log.txt", "old\n", someMtime)
+	assert.NoError(t, os.Chmod(f.local("data/log.txt"), 0200))
+
+	_, err := f.Device().Tail(context.Background(), "/data/log.txt")
+	assert.ErrorIs(t, err, fs.ErrPermission)
+	_, err = f.Device().Tail(context.Background(), "/data/none.txt")
+	assert.ErrorIs(t, err, wire.ErrFileNoExist)
+}
@@ -0,0 +1,86 @@
+package wire
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// RateLimiter is a token bucket which limits the throughput of sync transfers, in bytes per
+// second. Its burst is one second of transfer, at least one chunk. The zero value is unlimited.
+// The limit can be changed at any time, transfers in progress follow it from their next chunk.
+type RateLimiter struct {
+	mu     sync.Mutex
+	limit  int64
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter returns a RateLimiter of bytesPerSecond, 0 or less is unlimited.
+func NewRateLimiter(bytesPerSecond int64) *RateLimiter {
+	return &RateLimiter{limit: bytesPerSecond}
+}
+
+// SetLimit changes the limit to bytesPerSecond, 0 or less is unlimited.
+func (l *RateLimiter) SetLimit(bytesPerSecond int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.limit = bytesPerSecond
+}
+
+// Limit returns the limit in bytes per second, 0 or less is unlimited.
+func (l *RateLimiter) Limit() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.limit
+}
+
+// reserve takes n tokens, the bucket may go in debt, and returns the time to wait for them.
+func (l *RateLimiter) reserve(n int, now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.limit <= 0 {
+		// restart with a full bucket once limited again
+		l.last = time.Time{}
+		return 0
+	}
+
+	burst := float64(l.limit)
+	if burst < SyncMaxChunkSize {
+		burst = SyncMaxChunkSize
+	}
+	if l.last.IsZero() {
+		l.tokens = burst
+	} else {
+		l.tokens += now.Sub(l.last).Seconds() * float64(l.limit)
+		if l.tokens > burst {
+			l.tokens = burst
+		}
+	}
+	l.last = now
+
+	l.tokens -= float64(n)
+	if l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens / float64(l.limit) * float64(time.Second))
+}
+
+// WaitN blocks until n bytes can be transferred, or ctx is done. A nil RateLimiter is unlimited.
+func (l *RateLimiter) WaitN(ctx context.Context, n int) error {
+	if l == nil {
+		return nil
+	}
+	d := l.reserve(n, time.Now())
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,49 @@
+package wire
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimiter(t *testing.T) {
+	now := time.Now()
+	l := NewRateLimiter(1024 * 1024)
+	// a full bucket, then in debt
+	assert.Equal(t, time.Duration(0), l.reserve(1024*1024, now))
+	assert.Equal(t, time.Second/2, l.reserve(512*1024, now))
+	// refilled after the debt
+	assert.Equal(t, time.Duration(0), l.reserve(512*1024, now.Add(time.Second)))
+
+	// the burst is at least one chunk
+	l.SetLimit(1024)
+	assert.Equal(t, int64(1024), l.Limit())
+	now = now.Add(time.Hour)
+	assert.Equal(t, time.Duration(0), l.reserve(SyncMaxChunkSize, now))
+	assert.Equal(t, time.Second, l.reserve(1024, now))
+
+	l.SetLimit(0)
+	assert.Equal(t, time.Duration(0), l.reserve(1024*1024*1024, now))
+
+	var nilLimiter *RateLimiter
+	assert.NoError(t, nilLimiter.WaitN(context.Background(), 1024))
+}
+
+func TestRateLimiter_WaitInterrupted(t *testing.T) {
+	l := NewRateLimiter(1024)
+	assert.NoError(t, l.WaitN(context.Background(), SyncMaxChunkSize))
+
+	// an hour of debt
+	conn := NewSyncConn(makeMockConnStr(""))
+	conn.SetRateLimiters(l)
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		conn.Close()
+	}()
+	start := time.Now()
+	assert.ErrorIs(t, conn.waitRate(3600*1024), net.ErrClosed)
+	assert.Less(t, time.Since(start), time.Second)
+}
@@ -2,6 +2,7 @@ package wire
 
 import (
 	"bytes"
+	"context"
 	"encoding/binary"
 	"errors"
 	"fmt"
@@ -50,10 +51,38 @@ type SyncConn struct {
 	net.Conn
 	rbuf []byte
 	wbuf []byte
+
+	// limiters throttle the file data, see SetRateLimiters
+	limiters []*RateLimiter
+	// done by Close, it interrupts the waits for limiters
+	done   context.Context
+	cancel context.CancelFunc
 }
 
 func NewSyncConn(r net.Conn) *SyncConn {
-	return &SyncConn{r, make([]byte, 8), make([]byte, 8)}
+	done, cancel := context.WithCancel(context.Background())
+	return &SyncConn{Conn: r, rbuf: make([]byte, 8), wbuf: make([]byte, 8), done: done, cancel: cancel}
+}
+
+// Close closes the connection, a transfer waiting for its limiters returns net.ErrClosed.
+func (s *SyncConn) Close() error {
+	s.cancel()
+	return s.Conn.Close()
+}
+
+// SetRateLimiters makes the file data of SyncFileReader and SyncFileWriter wait for each
+// of limiters, eg. one per device and one shared by all the devices.
+func (s *SyncConn) SetRateLimiters(limiters ...*RateLimiter) {
+	s.limiters = limiters
+}
+
+func (s *SyncConn) waitRate(n int) error {
+	for _, l := range s.limiters {
+		if err := l.WaitN(s.done, n); err != nil {
+			return net.ErrClosed
+		}
+	}
+	return nil
 }
 
 // ReadStatus reads a 4-byte status string and returns it.
@@ -180,6 +209,59 @@ func (s *SyncConn) Stat(path string) (*DirEntry, error) {
 	return s.finishLstatV1()
 }
 
+//	struct __attribute__((packed)) {
+//		uint32_t id;
+//		uint32_t error;
+//		uint64_t dev;
+//		uint64_t ino;
+//		uint32_t mode;
+//		uint32_t nlink;
+//		uint32_t uid;
+//		uint32_t gid;
+//		uint64_t size;
+//		int64_t atime;
+//		int64_t mtime;
+//		int64_t ctime;
+//	} stat_v2;
+func unpackLstatV2(rbuf []byte, path string) (d *DirEntry, size int64, err error) {
+	id := rbuf[:4]
+	if string(id) != ID_LSTAT_V2 {
+		err = fmt.Errorf("%w: expected stat ID 'LST2', but got '%s'", ErrAssertion, id)
+		return
+	}
+	// unlike stat_v1, the errno of lstat(2) is sent
+	switch errno := binary.LittleEndian.Uint32(rbuf[4:8]); errno {
+	case 0:
+	case 2: // ENOENT
+		err = fmt.Errorf("%w: %s", ErrFileNoExist, path)
+		return
+	case 13: // EACCES
+		err = &fs.PathError{Op: "lstat", Path: path, Err: fs.ErrPermission}
+		return
+	default:
+		err = fmt.Errorf("lstat %s: errno %d", path, errno)
+		return
+	}
+	mode := ParseFileModeFromAdb(binary.LittleEndian.Uint32(rbuf[24:28]))
+	size = int64(binary.LittleEndian.Uint64(rbuf[40:48]))
+	mtime := time.Unix(int64(binary.LittleEndian.Uint64(rbuf[56:64])), 0).UTC()
+	d = &DirEntry{Mode: mode, Size: int32(size), ModifiedAt: mtime}
+	return
+}
+
+// LstatV2 is Stat with the stat_v2 of the devices which have the feature "stat_v2", from
+// Android 8: it returns the 64-bit size, which is truncated in the entry.
+func (s *SyncConn) LstatV2(path string) (entry *DirEntry, size int64, err error) {
+	if err = s.SendRequest([]byte(ID_LSTAT_V2), []byte(path)); err != nil {
+		return nil, 0, err
+	}
+	var rbuf [72]byte
+	if _, err = io.ReadFull(s, rbuf[:]); err != nil {
+		return nil, 0, err
+	}
+	return unpackLstatV2(rbuf[:], path)
+}
+
 // SendList
 // Android 5.1上，打开一个不存在文件夹，List协议并不会报错，且对其获取DENT时直接返回DONE
 // 为了确保函数行为正常，先执行STAT
@@ -354,7 +436,7 @@ func (s *SyncConn) PullFile(remotePath, localPath string, handler func(total, se
 	}
 	size := info.Size
 
-	// FIXME: need support Dir or file
+	// directories are pulled by adb.Device.PullDir
 	writer, err := os.Create(localPath)
 	if err != nil {
 		return fmt.Errorf("open local file %s: %w", localPath, err)
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/binary"
 	"errors"
+	"io/fs"
 	"math"
 	"os"
 	"testing"
@@ -64,6 +65,42 @@ func TestStatNoExist(t *testing.T) {
 	assert.True(t, errors.Is(err, ErrFileNoExist))
 }
 
+func packLstatV2(errno uint32, mode uint32, size uint64, mtime time.Time) []byte {
+	var b bytes.Buffer
+	b.Write([]byte("LST2"))
+	binary.Write(&b, binary.LittleEndian, errno)
+	b.Write(make([]byte, 16)) // dev, ino
+	binary.Write(&b, binary.LittleEndian, mode)
+	b.Write(make([]byte, 12)) // nlink, uid, gid
+	binary.Write(&b, binary.LittleEndian, size)
+	binary.Write(&b, binary.LittleEndian, mtime.Unix()) // atime
+	binary.Write(&b, binary.LittleEndian, mtime.Unix())
+	binary.Write(&b, binary.LittleEndian, mtime.Unix()) // ctime
+	return b.Bytes()
+}
+
+func TestLstatV2(t *testing.T) {
+	var buf bytes.Buffer
+	conn := NewSyncConn(makeMockConnBuf(&buf))
+	conn.Write(packLstatV2(0, 0100644, 5000000000, someTime))
+	entry, size, err := conn.LstatV2("/big")
+	assert.NoError(t, err)
+	require.NotNil(t, entry)
+	assert.Equal(t, int64(5000000000), size)
+	assert.Equal(t, os.FileMode(0644), entry.Mode)
+	assert.Equal(t, someTime, entry.ModifiedAt)
+
+	buf.Reset()
+	conn.Write(packLstatV2(2, 0, 0, time.Unix(0, 0)))
+	_, _, err = conn.LstatV2("/none")
+	assert.True(t, errors.Is(err, ErrFileNoExist))
+
+	buf.Reset()
+	conn.Write(packLstatV2(13, 0, 0, time.Unix(0, 0)))
+	_, _, err = conn.LstatV2("/data/secret")
+	assert.ErrorIs(t, err, fs.ErrPermission)
+}
+
 func TestSyncSendOctetString(t *testing.T) {
 	var buf bytes.Buffer
 	s := NewSyncConn(makeMockConnBuf(&buf))
@@ -49,6 +49,9 @@ func (r *SyncFileReader) Read(buf []byte) (n int, err error) {
 	}
 
 	r.toRead = r.toRead - n
+	if n > 0 && err == nil {
+		err = r.syncConn.waitRate(n)
+	}
 	return
 }
 
@@ -86,6 +89,9 @@ func (w *SyncFileWriter) Write(buf []byte) (n int, err error) {
 			partialBuf = partialBuf[:SyncMaxChunkSize]
 		}
 
+		if err := w.syncConn.waitRate(len(partialBuf)); err != nil {
+			return written, err
+		}
 		if err := w.syncConn.SendRequest([]byte(ID_DATA), partialBuf); err != nil {
 			return written, err
 		}
@@ -105,13 +111,12 @@ func (w *SyncFileWriter) CopyDone() error {
 		return fmt.Errorf("error sending done chunk to close stream: %w", err)
 	}
 
-	if status, err := w.syncConn.ReadStatus(""); err != nil {
+	status, err := w.syncConn.ReadStatus("")
+	if err != nil {
 		return fmt.Errorf("error reading status, should receive 'ID_OKAY': %w", err)
-	} else if status == ID_OKAY {
-		return nil
-	} else {
-		fmt.Println("sync-send with resp status: ", status)
 	}
-
+	if status != ID_OKAY {
+		return fmt.Errorf("%w: sync-send with resp status %q", ErrAssertion, status)
+	}
 	return nil
 }
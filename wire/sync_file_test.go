@@ -195,6 +195,16 @@ func TestFileWriterWriteClose(t *testing.T) {
 	assert.Equal(t, "DATA\005\000\000\000helloDONE\x01\x00\x00\x00", buf.String())
 }
 
+func TestFileWriterCopyDoneFail(t *testing.T) {
+	var buf bytes.Buffer
+	syncConn := NewSyncConn(makeMockConn2("FAIL\x07\x00\x00\x00no room", &buf))
+	writer := newSyncFileWriter(syncConn, time.Unix(1, 0))
+
+	err := writer.CopyDone()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "no room")
+}
+
 func TestFileWriterCloseAutoMtime(t *testing.T) {
 	var buf bytes.Buffer
 	syncConn := NewSyncConn(makeMockConn2("OKAY\x00\x00\x00\x00", &buf))